@@ -0,0 +1,74 @@
+package bitcaskGo
+
+import "time"
+
+// MergeWindow a period of the day in which auto merge is allowed
+// Start and End are the offsets from midnight in local time,
+// End before Start means the window crosses midnight, e.g. 22:00 - 06:00
+type MergeWindow struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// check if t is in the window
+func (w MergeWindow) contains(t time.Time) bool {
+	year, month, day := t.Date()
+	offset := t.Sub(time.Date(year, month, day, 0, 0, 0, 0, t.Location()))
+	if w.Start <= w.End {
+		return offset >= w.Start && offset < w.End
+	}
+	return offset >= w.Start || offset < w.End
+}
+
+// start the goroutine which merges in background, it's stopped by Close
+func (db *DB) startAutoMerge() {
+	db.autoMergeStop = make(chan struct{})
+	db.autoMergeDone = make(chan struct{})
+	go func() {
+		defer close(db.autoMergeDone)
+		ticker := time.NewTicker(db.options.AutoMergeInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-db.autoMergeStop:
+				return
+			case now := <-ticker.C:
+				if db.shouldAutoMerge(now) {
+					//the result is recorded by Merge, and exposed by Stat
+					_ = db.Merge()
+				}
+			}
+		}
+	}()
+}
+
+// stop the auto merge goroutine and wait for it to exit
+func (db *DB) stopAutoMerge() {
+	if db.autoMergeStop == nil {
+		return
+	}
+	close(db.autoMergeStop)
+	<-db.autoMergeDone
+	db.autoMergeStop = nil
+}
+
+// check the time windows and reclaimable size,
+// the merge ratio is checked by Merge, the finished merge must be moved in by Open first
+func (db *DB) shouldAutoMerge(now time.Time) bool {
+	if len(db.options.AutoMergeWindows) > 0 {
+		var inWindow bool
+		for _, window := range db.options.AutoMergeWindows {
+			if window.contains(now) {
+				inWindow = true
+				break
+			}
+		}
+		if !inWindow {
+			return false
+		}
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return !db.mergePending && db.reclaimSize >= db.options.AutoMergeMinReclaimBytes
+}
@@ -0,0 +1,111 @@
+package bitcaskGo
+
+import (
+	"bitcaskGo/utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMergeWindow_Contains(t *testing.T) {
+	day := time.Date(2023, 8, 1, 0, 0, 0, 0, time.Local)
+	window := MergeWindow{Start: 2 * time.Hour, End: 4 * time.Hour}
+	assert.True(t, window.contains(day.Add(2*time.Hour)))
+	assert.True(t, window.contains(day.Add(3*time.Hour)))
+	assert.False(t, window.contains(day.Add(4*time.Hour)))
+	assert.False(t, window.contains(day.Add(time.Hour)))
+
+	//crosses midnight
+	nightly := MergeWindow{Start: 22 * time.Hour, End: 6 * time.Hour}
+	assert.True(t, nightly.contains(day.Add(23*time.Hour)))
+	assert.True(t, nightly.contains(day.Add(time.Hour)))
+	assert.False(t, nightly.contains(day.Add(12*time.Hour)))
+}
+
+func TestDB_AutoMerge(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-auto-merge")
+	opts.DirPath = dir
+	opts.DataFileMergeRatio = 0
+	opts.AutoMergeInterval = 20 * time.Millisecond
+	opts.AutoMergeMinReclaimBytes = 1
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	//nothing to reclaim, the merge doesn't run
+	for i := 0; i < 100; i++ {
+		err = db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+		assert.Nil(t, err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	assert.True(t, db.Stat().LastMergeTime.IsZero())
+
+	for i := 0; i < 50; i++ {
+		err = db.Delete(utils.GetTestKey(i))
+		assert.Nil(t, err)
+	}
+	for i := 0; i < 100 && db.Stat().LastMergeTime.IsZero(); i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	stat := db.Stat()
+	assert.False(t, stat.LastMergeTime.IsZero())
+	assert.Nil(t, stat.LastMergeErr)
+	assert.Greater(t, stat.LastMergeDuration, time.Duration(0))
+	assert.Equal(t, int64(0), stat.ReclaimableSize)
+
+	//the merged files aren't moved in until the next Open, they aren't merged again
+	err = db.Delete(utils.GetTestKey(50))
+	assert.Nil(t, err)
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, stat.LastMergeTime, db.Stat().LastMergeTime)
+
+	//Close stops the auto merge goroutine
+	err = db.Close()
+	assert.Nil(t, err)
+	db2, err := Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 100; i++ {
+		_, err := db2.Get(utils.GetTestKey(i))
+		if i <= 50 {
+			assert.Equal(t, ErrKeyNotFound, err)
+		} else {
+			assert.Nil(t, err)
+		}
+	}
+	assert.Nil(t, db2.Close())
+}
+
+func TestDB_AutoMergeOutOfWindow(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-auto-merge")
+	opts.DirPath = dir
+	opts.DataFileMergeRatio = 0
+	opts.AutoMergeInterval = 20 * time.Millisecond
+	//a window which starts an hour later
+	now := time.Now()
+	year, month, day := now.Date()
+	offset := now.Sub(time.Date(year, month, day, 0, 0, 0, 0, now.Location()))
+	opts.AutoMergeWindows = []MergeWindow{{
+		Start: (offset + time.Hour) % (24 * time.Hour),
+		End:   (offset + 2*time.Hour) % (24 * time.Hour),
+	}}
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 100; i++ {
+		err = db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+		assert.Nil(t, err)
+		err = db.Delete(utils.GetTestKey(i))
+		assert.Nil(t, err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	assert.True(t, db.Stat().LastMergeTime.IsZero())
+
+	//manual merge is recorded as well
+	err = db.Merge()
+	assert.Nil(t, err)
+	assert.False(t, db.Stat().LastMergeTime.IsZero())
+}
@@ -0,0 +1,59 @@
+package bitcaskGo
+
+import (
+	"bitcaskGo/data"
+	"time"
+)
+
+// SyncedUpTo return the position which the data files are durable up to,
+// the logRecords before offset in file fileId, and those in smaller files, survive a crash
+func (db *DB) SyncedUpTo() (fileId uint32, offset int64) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.syncedPos == nil {
+		return 0, 0
+	}
+	return db.syncedPos.FileId, db.syncedPos.Offset
+}
+
+// record that the data before the position is durable, it never moves backwards
+// we must have mutex lock when we use this method
+func (db *DB) markSynced(fileId uint32, offset int64) {
+	if db.syncedPos == nil {
+		db.syncedPos = &data.LogRecordPos{}
+	}
+	if fileId > db.syncedPos.FileId || (fileId == db.syncedPos.FileId && offset > db.syncedPos.Offset) {
+		db.syncedPos.FileId = fileId
+		db.syncedPos.Offset = offset
+	}
+}
+
+// start the goroutine which syncs the active file in background, it's stopped by Close
+func (db *DB) startSync() {
+	db.syncStop = make(chan struct{})
+	db.syncDone = make(chan struct{})
+	go func() {
+		defer close(db.syncDone)
+		ticker := time.NewTicker(db.options.SyncInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-db.syncStop:
+				return
+			case <-ticker.C:
+				//a failed sync is retried next time, SyncedUpTo doesn't move until then
+				_ = db.Sync()
+			}
+		}
+	}()
+}
+
+// stop the background sync goroutine and wait for it to exit
+func (db *DB) stopSync() {
+	if db.syncStop == nil {
+		return
+	}
+	close(db.syncStop)
+	<-db.syncDone
+	db.syncStop = nil
+}
@@ -0,0 +1,95 @@
+package bitcaskGo
+
+import (
+	"bitcaskGo/utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDB_SyncedUpTo(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-synced-up-to")
+	opts.DirPath = dir
+	opts.DataFileSize = 64 * 1024
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	fileId, offset := db.SyncedUpTo()
+	assert.Equal(t, uint32(0), fileId)
+	assert.Equal(t, int64(0), offset)
+
+	//not synced yet
+	err = db.Put(utils.GetTestKey(0), utils.RandomValue(128))
+	assert.Nil(t, err)
+	_, offset = db.SyncedUpTo()
+	assert.Equal(t, int64(0), offset)
+
+	err = db.Sync()
+	assert.Nil(t, err)
+	fileId, offset = db.SyncedUpTo()
+	assert.Equal(t, db.activeFile.Fileid, fileId)
+	assert.Equal(t, db.activeFile.WriteOff, offset)
+
+	//the old active file is synced when a new one is opened
+	for i := 1; i < 1000; i++ {
+		err = db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+		assert.Nil(t, err)
+	}
+	fileId, _ = db.SyncedUpTo()
+	assert.Equal(t, db.activeFile.Fileid-1, fileId)
+
+	//synced with the write batch
+	wb, err := db.NewWriteBatch(WriteBatchOptions{MaxBatchNum: 10, SyncWrites: true})
+	assert.Nil(t, err)
+	assert.Nil(t, wb.Put(utils.GetTestKey(1000), utils.RandomValue(128)))
+	assert.Nil(t, wb.Commit())
+	fileId, offset = db.SyncedUpTo()
+	assert.Equal(t, db.activeFile.Fileid, fileId)
+	assert.Equal(t, db.activeFile.WriteOff, offset)
+
+	//the data in files is durable when open
+	err = db.Put(utils.GetTestKey(1001), utils.RandomValue(128))
+	assert.Nil(t, err)
+	err = db.Close()
+	assert.Nil(t, err)
+	db2, err := Open(opts)
+	assert.Nil(t, err)
+	fileId, offset = db2.SyncedUpTo()
+	assert.Equal(t, db2.activeFile.Fileid, fileId)
+	assert.Equal(t, db2.activeFile.WriteOff, offset)
+	assert.Nil(t, db2.Close())
+}
+
+func TestDB_SyncInterval(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-sync-interval")
+	opts.DirPath = dir
+	opts.SyncInterval = 10 * time.Millisecond
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 100; i++ {
+		err = db.Put(utils.GetTestKey(i), utils.RandomValue(24))
+		assert.Nil(t, err)
+	}
+	db.mu.RLock()
+	writeOff := db.activeFile.WriteOff
+	db.mu.RUnlock()
+	//the background goroutine syncs the writes in the next interval
+	var offset int64
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		if _, offset = db.SyncedUpTo(); offset == writeOff {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, writeOff, offset)
+
+	opts.SyncInterval = -time.Second
+	_, err = Open(opts)
+	assert.NotNil(t, err)
+}
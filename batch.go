@@ -2,6 +2,7 @@ package bitcaskGo
 
 import (
 	"bitcaskGo/data"
+	"bitcaskGo/index"
 	"encoding/binary"
 	"sync"
 	"sync/atomic"
@@ -18,10 +19,19 @@ type WriteBatch struct {
 	mu            *sync.Mutex
 	db            *DB
 	pendingWrites map[string]*data.LogRecord //temporary save the data which written by user
+	conditions    []func() error             //conditions checked under db's lock when commit
 }
 
-func (db *DB) NewWriteBatch(opts WriteBatchOptions) *WriteBatch {
+// NewWriteBatch create a write batch, it fails with ErrDatabaseReadOnly when the database is read only
+func (db *DB) NewWriteBatch(opts WriteBatchOptions) (*WriteBatch, error) {
+	if db.options.ReadOnly {
+		return nil, ErrDatabaseReadOnly
+	}
+	return db.newWriteBatch(opts), nil
+}
 
+// the batch of txn is created on the read only database as well, its writes fail with ErrDatabaseReadOnly
+func (db *DB) newWriteBatch(opts WriteBatchOptions) *WriteBatch {
 	if db.options.IndexerType == BPTree && !db.seqNoFileExists && !db.isInitial {
 		panic("can not use write batch, seq no file does not exists ")
 	}
@@ -39,6 +49,9 @@ func (wb *WriteBatch) Put(key []byte, value []byte) error {
 	if len(key) == 0 {
 		return ErrKeyIsEmpty
 	}
+	if wb.db.options.ReadOnly {
+		return ErrDatabaseReadOnly
+	}
 
 	wb.mu.Lock()
 	defer wb.mu.Unlock()
@@ -56,6 +69,9 @@ func (wb *WriteBatch) Delete(key []byte) error {
 	if len(key) == 0 {
 		return ErrKeyIsEmpty
 	}
+	if wb.db.options.ReadOnly {
+		return ErrDatabaseReadOnly
+	}
 	wb.mu.Lock()
 	defer wb.mu.Unlock()
 
@@ -76,76 +92,139 @@ func (wb *WriteBatch) Delete(key []byte) error {
 	return nil
 }
 
-func (wb *WriteBatch) Commit() error {
+// CompareAndSwap put newValue in batch, the batch only commits when the value of key equals to oldValue
+func (wb *WriteBatch) CompareAndSwap(key []byte, oldValue []byte, newValue []byte) error {
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+	if wb.db.options.ReadOnly {
+		return ErrDatabaseReadOnly
+	}
 	wb.mu.Lock()
 	defer wb.mu.Unlock()
 
-	if len(wb.pendingWrites) == 0 {
-		return nil
-	}
+	wb.conditions = append(wb.conditions, func() error {
+		return wb.db.checkValue(key, oldValue)
+	})
+	wb.pendingWrites[string(key)] = &data.LogRecord{Key: key, Value: newValue}
+	return nil
+}
 
-	if uint(len(wb.pendingWrites)) > wb.options.MaxBatchNum {
-		return ErrExceedMaxBatchNum
+// PutIfAbsent put data in batch, the batch only commits when the key doesn't exist
+func (wb *WriteBatch) PutIfAbsent(key []byte, value []byte) error {
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
 	}
-	//get a lock to ensure serialization of transaction commits.
-	wb.db.mu.Lock()
-	defer wb.db.mu.Unlock()
-
-	//get the newest transaction seqNo
-	seqNo := atomic.AddUint64(&wb.db.seqNo, 1)
+	if wb.db.options.ReadOnly {
+		return ErrDatabaseReadOnly
+	}
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
 
-	//begin to write data to the data filek
+	wb.conditions = append(wb.conditions, func() error {
+		return wb.db.checkAbsent(key)
+	})
+	wb.pendingWrites[string(key)] = &data.LogRecord{Key: key, Value: value}
+	return nil
+}
 
-	//logRecordPos's buffer, when the write process finished,
-	//can we update the position information to memory index
-	positions := make(map[string]*data.LogRecordPos)
+// DeleteIfEquals delete key in batch, the batch only commits when the value of key equals to value
+func (wb *WriteBatch) DeleteIfEquals(key []byte, value []byte) error {
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+	if wb.db.options.ReadOnly {
+		return ErrDatabaseReadOnly
+	}
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
 
-	for _, record := range wb.pendingWrites {
-		logRecordPos, err := wb.db.appendLogRecord(&data.LogRecord{
-			Key:   logRecordKeyWithSeq(record.Key, seqNo),
-			Value: record.Value,
-			Type:  record.Type,
-		})
-		if err != nil {
-			return err
-		}
+	wb.conditions = append(wb.conditions, func() error {
+		return wb.db.checkValue(key, value)
+	})
+	wb.pendingWrites[string(key)] = &data.LogRecord{Key: key, Type: data.LogRecordDeleted}
+	return nil
+}
 
-		positions[string(record.Key)] = logRecordPos
-	}
+func (wb *WriteBatch) Commit() error {
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
 
-	//write a data to signify that the transaction is completed
-	finishedRecord := &data.LogRecord{
-		Key:  logRecordKeyWithSeq(txnFinKey, seqNo),
-		Type: data.LogRecordTxnFinished,
+	if len(wb.pendingWrites) == 0 {
+		return nil
 	}
-	if _, err := wb.db.appendLogRecord(finishedRecord); err != nil {
-		return err
+	if wb.db.options.ReadOnly {
+		return ErrDatabaseReadOnly
 	}
 
-	//decide sync or not depend on the WriteBatch's options
-	if wb.options.SyncWrites && wb.db.activeFile != nil {
-		if err := wb.db.activeFile.Sync(); err != nil {
-			return err
-		}
+	if uint(len(wb.pendingWrites)) > wb.options.MaxBatchNum {
+		return ErrExceedMaxBatchNum
 	}
-
-	//update the memory index
+	//the records are written in this order, their positions are returned in the same order
+	records := make([]*data.LogRecord, 0, len(wb.pendingWrites))
 	for _, record := range wb.pendingWrites {
-		pos := positions[string(record.Key)]
-		var oldPos *data.LogRecordPos
-		if record.Type == data.LogRecordNormal {
-			oldPos = wb.db.index.Put(record.Key, pos)
-		}
-		if record.Type == data.LogRecordDeleted {
-			oldPos, _ = wb.db.index.Delete(record.Key)
-		}
-		if oldPos != nil {
-			wb.db.reclaimSize += int64(oldPos.Size)
-		}
+		records = append(records, record)
+	}
+
+	//the transaction commits are serialized by group commit
+	err := wb.db.commit(&commitRequest{
+		sync:    wb.options.SyncWrites,
+		reading: len(wb.conditions) > 0,
+		prepare: func() ([]*data.LogRecord, error) {
+			//check the conditions, if one of them fails, nothing will be written
+			for _, check := range wb.conditions {
+				if err := check(); err != nil {
+					return nil, err
+				}
+			}
+
+			//get the newest transaction seqNo
+			seqNo := atomic.AddUint64(&wb.db.seqNo, 1)
+
+			logRecords := make([]*data.LogRecord, 0, len(records)+1)
+			for _, record := range records {
+				logRecords = append(logRecords, &data.LogRecord{
+					Key:   logRecordKeyWithSeq(record.Key, seqNo),
+					Value: record.Value,
+					Type:  record.Type,
+				})
+			}
+			//write a data to signify that the transaction is completed
+			return append(logRecords, &data.LogRecord{
+				Key:  logRecordKeyWithSeq(txnFinKey, seqNo),
+				Type: data.LogRecordTxnFinished,
+			}), nil
+		},
+		apply: func(positions []*data.LogRecordPos) error {
+			//update the memory index at once, the B plus tree index does it in a single transaction
+			items := make([]*index.BatchItem, 0, len(records))
+			for i, record := range records {
+				item := &index.BatchItem{Key: record.Key}
+				if record.Type == data.LogRecordNormal {
+					item.Pos = positions[i]
+					wb.db.addLive(item.Pos)
+				}
+				items = append(items, item)
+			}
+			for _, oldPos := range wb.db.index.ApplyBatch(items) {
+				if oldPos != nil {
+					wb.db.reclaimSize += int64(oldPos.Size)
+					wb.db.removeLive(oldPos)
+				}
+			}
+			for _, record := range records {
+				wb.db.updateChunkedValue(record.Key, record)
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		return err
 	}
 
 	//clearing temporary data
 	wb.pendingWrites = make(map[string]*data.LogRecord)
+	wb.conditions = nil
 
 	return nil
 }
@@ -17,7 +17,8 @@ func TestDB_WriteBatch1(t *testing.T) {
 	assert.Nil(t, err)
 	assert.NotNil(t, db)
 
-	wb1 := db.NewWriteBatch(DefaultWriteBatchOptions)
+	wb1, err := db.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.Nil(t, err)
 	err = wb1.Put(utils.GetTestKey(1), utils.RandomValue(10))
 	assert.Nil(t, err)
 	err = wb1.Delete(utils.GetTestKey(2))
@@ -38,7 +39,8 @@ func TestDB_WriteBatch1(t *testing.T) {
 	assert.NotNil(t, val1)
 	assert.Nil(t, err)
 
-	wb2 := db.NewWriteBatch(DefaultWriteBatchOptions)
+	wb2, err := db.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.Nil(t, err)
 
 	err = wb2.Delete(utils.GetTestKey(1))
 	assert.Nil(t, err)
@@ -65,7 +67,8 @@ func TestDB_WriteBatch2(t *testing.T) {
 	err = db.Put(utils.GetTestKey(1), utils.RandomValue(10))
 	assert.Nil(t, err)
 
-	wb1 := db.NewWriteBatch(DefaultWriteBatchOptions)
+	wb1, err := db.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.Nil(t, err)
 
 	err = wb1.Put(utils.GetTestKey(2), utils.RandomValue(10))
 	assert.Nil(t, err)
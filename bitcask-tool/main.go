@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bitcaskGo"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+const usage = `usage: bitcask-tool <command> [-key hex-key] <dir>
+
+commands:
+  verify  scan the data, blob and meta files in dir, report the corrupt ranges
+  repair  truncate the torn tails and salvage the valid records after corrupt ranges,
+          the files indexed by b plus tree and the blob files only have their torn tails cut off`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run the command, return the exit code
+func run(args []string, stdout io.Writer, stderr io.Writer) int {
+	if len(args) < 1 {
+		fmt.Fprintln(stderr, usage)
+		return 2
+	}
+
+	command := args[0]
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	key := flags.String("key", "", "the encryption key of database in hex")
+	if err := flags.Parse(args[1:]); err != nil || flags.NArg() != 1 {
+		fmt.Fprintln(stderr, usage)
+		return 2
+	}
+
+	//the indexer type is found by the files in dir
+	options := bitcaskGo.DefaultOptions
+	options.DirPath = flags.Arg(0)
+	if *key != "" {
+		encryptionKey, err := hex.DecodeString(*key)
+		if err != nil {
+			fmt.Fprintf(stderr, "invalid key: %v\n", err)
+			return 2
+		}
+		options.EncryptionKey = encryptionKey
+	}
+
+	var report *bitcaskGo.VerifyReport
+	var err error
+	switch command {
+	case "verify":
+		report, err = bitcaskGo.Verify(options)
+	case "repair":
+		report, err = bitcaskGo.Repair(options)
+	default:
+		fmt.Fprintln(stderr, usage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to %s %s: %v\n", command, options.DirPath, err)
+		return 1
+	}
+
+	printReport(stdout, report)
+	//verify exits with 1 when any file is broken, thus it can be used in scripts
+	if command == "verify" && report.Corrupted() {
+		return 1
+	}
+	return 0
+}
+
+func printReport(w io.Writer, report *bitcaskGo.VerifyReport) {
+	for _, fr := range report.Files {
+		status := "ok"
+		if fr.Corrupted() {
+			status = "corrupted"
+			if fr.Repaired {
+				status = "repaired"
+			}
+		} else if fr.Repaired {
+			status = "removed"
+		}
+		fmt.Fprintf(w, "%-20s size=%-10d records=%-8d %s\n", fr.Name, fr.Size, fr.RecordNum, status)
+		for _, cr := range fr.CorruptRanges {
+			fmt.Fprintf(w, "  %s\n", cr)
+		}
+	}
+}
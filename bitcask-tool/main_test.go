@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bitcaskGo"
+	"bitcaskGo/data"
+	"bitcaskGo/utils"
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRun_RepairBPTree(t *testing.T) {
+	opts := bitcaskGo.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-tool-repair-bptree")
+	defer os.RemoveAll(dir)
+	opts.DirPath = dir
+	opts.IndexerType = bitcaskGo.BPTree
+	db, err := bitcaskGo.Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 100; i++ {
+		err = db.Put(utils.GetTestKey(i), utils.RandomValue(24))
+		assert.Nil(t, err)
+	}
+	err = db.Close()
+	assert.Nil(t, err)
+
+	//break a logRecord in the middle
+	fileName := data.GetFileName(dir, 0)
+	content, err := os.ReadFile(fileName)
+	assert.Nil(t, err)
+	content[len(content)/2] ^= 0xff
+	err = os.WriteFile(fileName, content, 0644)
+	assert.Nil(t, err)
+
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	assert.Equal(t, 1, run([]string{"verify", dir}, stdout, stderr))
+	assert.Contains(t, stdout.String(), "corrupted")
+
+	//the tool doesn't know the indexer, the records indexed by b plus tree aren't moved
+	stdout.Reset()
+	assert.Equal(t, 1, run([]string{"repair", dir}, stdout, stderr))
+	assert.True(t, strings.Contains(stderr.String(), bitcaskGo.ErrRepairWithBPTree.Error()))
+	repaired, err := os.ReadFile(fileName)
+	assert.Nil(t, err)
+	assert.Equal(t, content, repaired)
+}
+
+func TestRun_Usage(t *testing.T) {
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	assert.Equal(t, 2, run(nil, stdout, stderr))
+	assert.Equal(t, 2, run([]string{"unknown", "/tmp"}, stdout, stderr))
+	assert.Equal(t, 2, run([]string{"verify"}, stdout, stderr))
+	assert.Contains(t, stderr.String(), "usage")
+}
@@ -0,0 +1,398 @@
+package bitcaskGo
+
+import (
+	"bitcaskGo/data"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const blobCompactedKey = "blob-compacted"
+
+// BlobFileStats return the garbage statistics of all blob files, sorted by file id,
+// the compacted files which are waiting to be deleted are not included
+func (db *DB) BlobFileStats() ([]*FileStat, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.blobFileStats(true)
+}
+
+// we must have mutex lock when we use this method
+func (db *DB) blobFileStats(withActive bool) ([]*FileStat, error) {
+	stats := make([]*FileStat, 0, len(db.olderBlobFiles)+1)
+	for _, blobFile := range db.blobFiles(withActive) {
+		size, err := blobFile.IOManager.Size()
+		if err != nil {
+			return nil, err
+		}
+		liveBytes := db.blobLiveBytes[blobFile.Fileid]
+		stats = append(stats, &FileStat{
+			FileId:    blobFile.Fileid,
+			Size:      size,
+			LiveBytes: liveBytes,
+			DeadBytes: size - liveBytes,
+		})
+	}
+	return stats, nil
+}
+
+// get the blob files which aren't compacted, sorted by file id
+// we must have mutex lock when we use this method
+func (db *DB) blobFiles(withActive bool) []*data.Datafile {
+	blobFiles := make([]*data.Datafile, 0, len(db.olderBlobFiles)+1)
+	for fid, blobFile := range db.olderBlobFiles {
+		if !db.compactedBlobFiles[fid] {
+			blobFiles = append(blobFiles, blobFile)
+		}
+	}
+	if withActive && db.activeBlobFile != nil {
+		blobFiles = append(blobFiles, db.activeBlobFile)
+	}
+	sort.Slice(blobFiles, func(i, j int) bool {
+		return blobFiles[i].Fileid < blobFiles[j].Fileid
+	})
+	return blobFiles
+}
+
+// CompactBlobs rewrite the live values in the older blob files whose dead ratio reaches BlobGCRatio,
+// they are appended to the active blob file again, and the pointers to them are updated,
+// it runs independently of Merge, the compacted files are deleted when the database is opened next time
+func (db *DB) CompactBlobs() error {
+	if db.options.ReadOnly {
+		return ErrDatabaseReadOnly
+	}
+	db.mu.Lock()
+	if db.isCompactingBlobs {
+		db.mu.Unlock()
+		return ErrBlobCompactionIsRunning
+	}
+	stats, err := db.blobFileStats(false)
+	if err != nil {
+		db.mu.Unlock()
+		return err
+	}
+	var compactFiles []*data.Datafile
+	for _, stat := range stats {
+		if stat.Size > 0 && stat.DeadRatio() >= db.options.BlobGCRatio {
+			compactFiles = append(compactFiles, db.olderBlobFiles[stat.FileId])
+		}
+	}
+	if len(compactFiles) == 0 {
+		db.mu.Unlock()
+		return ErrBlobGCRatioUnreached
+	}
+	db.isCompactingBlobs = true
+	//the older blob files are never written, they can be read without lock
+	db.mu.Unlock()
+	defer func() {
+		db.mu.Lock()
+		db.isCompactingBlobs = false
+		db.mu.Unlock()
+	}()
+
+	for _, blobFile := range compactFiles {
+		if err := db.compactBlobFile(blobFile); err != nil {
+			return err
+		}
+	}
+
+	//the new pointers must be durable before the old files are deleted
+	if err := db.Sync(); err != nil {
+		return err
+	}
+	compactedFile, err := data.OpenBlobCompactedFile(db.options.FileSystem, db.options.DirPath)
+	if err != nil {
+		return err
+	}
+	compactedFile.Cipher = db.cipher
+	defer func() {
+		_ = compactedFile.Close()
+	}()
+	for _, blobFile := range compactFiles {
+		encRecord, _ := data.EncodeLogRecord(&data.LogRecord{
+			Key:   []byte(blobCompactedKey),
+			Value: []byte(strconv.FormatUint(uint64(blobFile.Fileid), 10)),
+		})
+		if err := compactedFile.Write(encRecord); err != nil {
+			return err
+		}
+	}
+	if err := compactedFile.Sync(); err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	for _, blobFile := range compactFiles {
+		db.compactedBlobFiles[blobFile.Fileid] = true
+	}
+	db.mu.Unlock()
+	return nil
+}
+
+// rewrite the live values in blob file, the values still referenced by index are written by the normal write path,
+// thus they go into the active blob file, and the index is updated like other writes
+func (db *DB) compactBlobFile(blobFile *data.Datafile) error {
+	var offset int64 = 0
+	for {
+		blobRecord, size, err := blobFile.ReadLogRecord(offset)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		recordOffset := offset
+		offset += size
+
+		realKey, _ := parselogRecordKey(blobRecord.Key)
+		err = db.writeKey(blobRecord.NamespaceId, realKey, true, func() (*data.LogRecord, error) {
+			//check if the value is still referenced, under lock right before writing
+			idx := db.indexOf(blobRecord.NamespaceId)
+			if idx == nil {
+				return nil, nil
+			}
+			pos := idx.Get(realKey)
+			if pos == nil || isExpired(pos) || pos.BlobSize == 0 || pos.BlobFileId != blobFile.Fileid {
+				return nil, nil
+			}
+			logRecord, err := db.readRawLogRecord(pos)
+			if err != nil {
+				return nil, err
+			}
+			ptr, err := data.DecodeBlobPointer(logRecord.Value)
+			if err != nil {
+				return nil, err
+			}
+			if ptr.FileId != blobFile.Fileid || ptr.Offset != recordOffset {
+				return nil, nil
+			}
+			return &data.LogRecord{
+				Key:         logRecordKeyWithSeq(realKey, nonTransactionSeqNo),
+				Value:       blobRecord.Value,
+				Type:        data.LogRecordNormal,
+				Expire:      pos.Expire,
+				NamespaceId: blobRecord.NamespaceId,
+			}, nil
+		})
+		if err != nil && err != ErrNamespaceDropped {
+			return err
+		}
+	}
+	return nil
+}
+
+// save the big values of logRecords into blob files, return the logRecords to write into data file,
+// the ones whose value is saved are replaced by the pointers to blob files
+// we must have mutex lock when we use this method
+func (db *DB) separateValues(logRecords []*data.LogRecord) ([]*data.LogRecord, error) {
+	var separated []*data.LogRecord
+	for i, logRecord := range logRecords {
+		if logRecord.Type != data.LogRecordNormal || int64(len(logRecord.Value)) <= db.options.BlobThreshold {
+			continue
+		}
+		//copy the slice once, the caller's logRecords should not be changed
+		if separated == nil {
+			separated = append([]*data.LogRecord(nil), logRecords...)
+		}
+		ptr, err := db.writeBlob(logRecord)
+		if err != nil {
+			return nil, err
+		}
+		separated[i] = &data.LogRecord{
+			Key:         logRecord.Key,
+			Value:       data.EncodeBlobPointer(ptr),
+			Type:        data.LogRecordBlob,
+			Expire:      logRecord.Expire,
+			NamespaceId: logRecord.NamespaceId,
+		}
+	}
+	if separated == nil {
+		return logRecords, nil
+	}
+	return separated, nil
+}
+
+// append the logRecord into active blob file, the key is kept for compaction to find the pointer
+// we must have mutex lock when we use this method
+func (db *DB) writeBlob(logRecord *data.LogRecord) (*data.BlobPointer, error) {
+	encRecord, length, err := db.encodeLogRecord(logRecord)
+	if err != nil {
+		return nil, err
+	}
+	if db.activeBlobFile == nil {
+		if err := db.setActiveBlobFile(); err != nil {
+			return nil, err
+		}
+	}
+	if db.activeBlobFile.WriteOff > 0 && db.activeBlobFile.WriteOff+length > db.options.DataFileSize {
+		if err := db.activeBlobFile.Sync(); err != nil {
+			return nil, err
+		}
+		db.olderBlobFiles[db.activeBlobFile.Fileid] = db.activeBlobFile
+		if err := db.setActiveBlobFile(); err != nil {
+			return nil, err
+		}
+	}
+	writeOff := db.activeBlobFile.WriteOff
+	if err := db.activeBlobFile.Write(encRecord); err != nil {
+		return nil, err
+	}
+	db.bytesWrite += uint(db.activeBlobFile.WriteOff - writeOff)
+	return &data.BlobPointer{
+		FileId: db.activeBlobFile.Fileid,
+		Offset: writeOff,
+		Size:   uint32(db.activeBlobFile.WriteOff - writeOff),
+	}, nil
+}
+
+// read the value which the blob logRecord points to, return a normal logRecord with the value
+// we must have mutex lock when we use this method
+func (db *DB) readBlob(logRecord *data.LogRecord) (*data.LogRecord, error) {
+	ptr, err := data.DecodeBlobPointer(logRecord.Value)
+	if err != nil {
+		return nil, err
+	}
+	var blobFile *data.Datafile
+	if db.activeBlobFile != nil && db.activeBlobFile.Fileid == ptr.FileId {
+		blobFile = db.activeBlobFile
+	} else {
+		blobFile = db.olderBlobFiles[ptr.FileId]
+	}
+	if blobFile == nil {
+		return nil, ErrBlobFileNotFound
+	}
+	blobRecord, _, err := blobFile.ReadLogRecord(ptr.Offset)
+	if err != nil {
+		return nil, err
+	}
+	resolved := *logRecord
+	resolved.Value = blobRecord.Value
+	resolved.Type = data.LogRecordNormal
+	return &resolved, nil
+}
+
+// sync the active blob file, the blobs must be durable before the pointers to them
+// we must have mutex lock when we use this method
+func (db *DB) syncBlobFile() error {
+	if db.activeBlobFile == nil {
+		return nil
+	}
+	return db.activeBlobFile.Sync()
+}
+
+// Set current active blob file
+// we must have mutex lock when we use this method
+func (db *DB) setActiveBlobFile() error {
+	var initialFileId uint32 = 0
+	if db.activeBlobFile != nil {
+		initialFileId = db.activeBlobFile.Fileid + 1
+	}
+	blobFile, err := data.OpenBlobFile(db.options.FileSystem, db.options.DirPath, initialFileId)
+	if err != nil {
+		return err
+	}
+	blobFile.Cipher = db.cipher
+	db.activeBlobFile = blobFile
+	return nil
+}
+
+// open the blob files which haven't been opened, the biggest one is the active blob file,
+// the files compacted before are deleted first, unless the database is read only
+func (db *DB) loadBlobFiles() error {
+	if !db.options.ReadOnly {
+		if err := db.removeCompactedBlobFiles(); err != nil {
+			return err
+		}
+	}
+
+	dirEntries, err := db.options.FileSystem.ReadDir(db.options.DirPath)
+	if err != nil {
+		return err
+	}
+	var fileIds []int
+	for _, entry := range dirEntries {
+		if !strings.HasSuffix(entry.Name(), data.BlobFileNameSuffix) {
+			continue
+		}
+		fileId, err := strconv.Atoi(strings.TrimSuffix(entry.Name(), data.BlobFileNameSuffix))
+		if err != nil {
+			return ErrDataDirectoryCorrupted
+		}
+		fileIds = append(fileIds, fileId)
+	}
+	sort.Ints(fileIds)
+
+	for _, fid := range fileIds {
+		if db.activeBlobFile != nil && uint32(fid) <= db.activeBlobFile.Fileid {
+			continue
+		}
+		blobFile, err := data.OpenBlobFile(db.options.FileSystem, db.options.DirPath, uint32(fid))
+		if err != nil {
+			return err
+		}
+		blobFile.Cipher = db.cipher
+		//the torn blob at the end is never referenced, the new blobs are written after it
+		size, err := blobFile.IOManager.Size()
+		if err != nil {
+			return err
+		}
+		blobFile.WriteOff = size
+		if db.activeBlobFile != nil {
+			db.olderBlobFiles[db.activeBlobFile.Fileid] = db.activeBlobFile
+		}
+		db.activeBlobFile = blobFile
+	}
+	return nil
+}
+
+// delete the blob files recorded in blob compacted file, it's safe to do it again if we crash in the middle
+func (db *DB) removeCompactedBlobFiles() error {
+	fileName := filepath.Join(db.options.DirPath, data.BlobCompactedFileName)
+	if _, err := db.options.FileSystem.Stat(fileName); os.IsNotExist(err) {
+		return nil
+	}
+	compactedFile, err := data.OpenBlobCompactedFile(db.options.FileSystem, db.options.DirPath)
+	if err != nil {
+		return err
+	}
+	compactedFile.Cipher = db.cipher
+	var offset int64 = 0
+	for {
+		logRecord, size, err := compactedFile.ReadLogRecord(offset)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			_ = compactedFile.Close()
+			return err
+		}
+		fid, err := strconv.ParseUint(string(logRecord.Value), 10, 32)
+		if err != nil {
+			_ = compactedFile.Close()
+			return ErrDataDirectoryCorrupted
+		}
+		if err := db.options.FileSystem.Remove(data.GetBlobFileName(db.options.DirPath, uint32(fid))); err != nil && !os.IsNotExist(err) {
+			_ = compactedFile.Close()
+			return err
+		}
+		offset += size
+	}
+	if err := compactedFile.Close(); err != nil {
+		return err
+	}
+	return db.options.FileSystem.Remove(fileName)
+}
+
+// construct the position of logRecord, the blob it points to is recorded in the position as well
+func newLogRecordPos(fileId uint32, offset int64, size int64, logRecord *data.LogRecord) *data.LogRecordPos {
+	pos := &data.LogRecordPos{FileId: fileId, Offset: offset, Size: uint32(size), Expire: logRecord.Expire}
+	if logRecord.Type == data.LogRecordBlob {
+		if ptr, err := data.DecodeBlobPointer(logRecord.Value); err == nil {
+			pos.BlobFileId, pos.BlobSize = ptr.FileId, ptr.Size
+		}
+	}
+	return pos
+}
@@ -0,0 +1,221 @@
+package bitcaskGo
+
+import (
+	"bitcaskGo/fileio"
+	"bitcaskGo/utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDB_BlobThreshold(t *testing.T) {
+	for _, indexerType := range []IndexerType{BTree, BPTree} {
+		opts := DefaultOptions
+		dir, _ := os.MkdirTemp("", "bitcask-go-blob-threshold")
+		opts.DirPath = dir
+		opts.BlobThreshold = 1024
+		opts.IndexerType = indexerType
+		db, err := Open(opts)
+		assert.Nil(t, err)
+
+		//the small value stays in data file
+		err = db.Put(utils.GetTestKey(1), utils.RandomValue(128))
+		assert.Nil(t, err)
+		assert.Nil(t, db.activeBlobFile)
+		assert.Equal(t, uint32(0), db.index.Get(utils.GetTestKey(1)).BlobSize)
+
+		//the big value is saved in blob file
+		value := utils.RandomValue(4096)
+		err = db.Put(utils.GetTestKey(2), value)
+		assert.Nil(t, err)
+		assert.NotNil(t, db.activeBlobFile)
+		assert.Greater(t, db.index.Get(utils.GetTestKey(2)).BlobSize, uint32(4096))
+		assert.Less(t, db.activeFile.WriteOff, int64(1024))
+		getValue, err := db.Get(utils.GetTestKey(2))
+		assert.Nil(t, err)
+		assert.Equal(t, value, getValue)
+
+		wb, err := db.NewWriteBatch(DefaultWriteBatchOptions)
+		assert.Nil(t, err)
+		assert.Nil(t, wb.Put(utils.GetTestKey(3), value))
+		assert.Nil(t, wb.Commit())
+		getValue, err = db.Get(utils.GetTestKey(3))
+		assert.Nil(t, err)
+		assert.Equal(t, value, getValue)
+
+		stat := db.Stat()
+		assert.Equal(t, uint(1), stat.BlobFileNum)
+		assert.Equal(t, int64(0), stat.BlobReclaimableSize)
+
+		//the overwritten value in blob file becomes garbage
+		err = db.Put(utils.GetTestKey(2), []byte("small value"))
+		assert.Nil(t, err)
+		stat = db.Stat()
+		assert.Greater(t, stat.BlobReclaimableSize, int64(4096))
+
+		//the positions and the garbage are the same after reopen
+		err = db.Close()
+		assert.Nil(t, err)
+		db, err = Open(opts)
+		assert.Nil(t, err)
+		getValue, err = db.Get(utils.GetTestKey(3))
+		assert.Nil(t, err)
+		assert.Equal(t, value, getValue)
+		getValue, err = db.Get(utils.GetTestKey(2))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("small value"), getValue)
+		assert.Equal(t, stat.BlobReclaimableSize, db.Stat().BlobReclaimableSize)
+		destroyDB(db)
+	}
+}
+
+func TestDB_BlobMerge(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-blob-merge")
+	opts.DirPath = dir
+	opts.BlobThreshold = 1024
+	opts.DataFileMergeRatio = 0
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	values := make(map[int][]byte)
+	for i := 0; i < 100; i++ {
+		values[i] = utils.RandomValue(4096)
+		err = db.Put(utils.GetTestKey(i), values[i])
+		assert.Nil(t, err)
+	}
+	for i := 0; i < 50; i++ {
+		err = db.Delete(utils.GetTestKey(i))
+		assert.Nil(t, err)
+	}
+	blobSize := db.activeBlobFile.WriteOff
+
+	//merge rewrites the pointers only, the values stay in blob file
+	err = db.Merge()
+	assert.Nil(t, err)
+	err = db.Close()
+	assert.Nil(t, err)
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, blobSize, db.activeBlobFile.WriteOff)
+	for i := 50; i < 100; i++ {
+		getValue, err := db.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+		assert.Equal(t, values[i], getValue)
+	}
+	assert.Equal(t, 50, len(db.ListKeys()))
+}
+
+func TestDB_CompactBlobs(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-compact-blobs")
+	opts.DirPath = dir
+	opts.DataFileSize = 256 * 1024
+	opts.BlobThreshold = 1024
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	err = db.CompactBlobs()
+	assert.Equal(t, ErrBlobGCRatioUnreached, err)
+
+	values := make(map[int][]byte)
+	for i := 0; i < 200; i++ {
+		values[i] = utils.RandomValue(8 * 1024)
+		err = db.Put(utils.GetTestKey(i), values[i])
+		assert.Nil(t, err)
+	}
+	for i := 0; i < 200; i += 3 {
+		values[i] = utils.RandomValue(8 * 1024)
+		err = db.Put(utils.GetTestKey(i), values[i])
+		assert.Nil(t, err)
+	}
+	for i := 1; i < 200; i += 3 {
+		err = db.Delete(utils.GetTestKey(i))
+		assert.Nil(t, err)
+		delete(values, i)
+	}
+	stats, err := db.BlobFileStats()
+	assert.Nil(t, err)
+	blobFileNum := len(stats)
+	assert.Greater(t, blobFileNum, 6)
+
+	err = db.CompactBlobs()
+	assert.Nil(t, err)
+	//the blob files with much garbage are compacted, nothing to do now
+	err = db.CompactBlobs()
+	assert.Equal(t, ErrBlobGCRatioUnreached, err)
+	stats, err = db.BlobFileStats()
+	assert.Nil(t, err)
+	for _, stat := range stats {
+		assert.Less(t, stat.DeadRatio(), opts.BlobGCRatio)
+	}
+	for i, value := range values {
+		getValue, err := db.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+		assert.Equal(t, value, getValue)
+	}
+
+	//the compacted files are deleted when open
+	sizeBefore, err := fileio.DirSize(fileio.OSFileSystem, dir)
+	assert.Nil(t, err)
+	err = db.Close()
+	assert.Nil(t, err)
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	sizeAfter, err := fileio.DirSize(fileio.OSFileSystem, dir)
+	assert.Nil(t, err)
+	assert.Less(t, sizeAfter, sizeBefore)
+	assert.Equal(t, uint(len(stats)), db.Stat().BlobFileNum)
+	for i, value := range values {
+		getValue, err := db.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+		assert.Equal(t, value, getValue)
+	}
+	assert.Equal(t, len(values), len(db.ListKeys()))
+
+	opts.BlobGCRatio = 2
+	_, err = Open(opts)
+	assert.NotNil(t, err)
+}
+
+func TestDB_CompactBlobsEncryption(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-compact-blobs-encryption")
+	opts.DirPath = dir
+	opts.DataFileSize = 256 * 1024
+	opts.BlobThreshold = 1024
+	opts.EncryptionKey = []byte(strings.Repeat("k", 32))
+	db, err := Open(opts)
+	assert.Nil(t, err)
+
+	//the blob compacted file is appended by every compaction
+	values := make(map[int][]byte)
+	for round := 0; round < 2; round++ {
+		for i := 0; i < 200; i++ {
+			values[i] = utils.RandomValue(8 * 1024)
+			err = db.Put(utils.GetTestKey(i), values[i])
+			assert.Nil(t, err)
+		}
+		for i := 0; i < 200; i += 2 {
+			values[i] = utils.RandomValue(8 * 1024)
+			err = db.Put(utils.GetTestKey(i), values[i])
+			assert.Nil(t, err)
+		}
+		err = db.CompactBlobs()
+		assert.Nil(t, err)
+	}
+	err = db.Close()
+	assert.Nil(t, err)
+
+	db, err = Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	for i, value := range values {
+		getValue, err := db.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+		assert.Equal(t, value, getValue)
+	}
+}
@@ -0,0 +1,51 @@
+package bitcaskGo
+
+import "bitcaskGo/index"
+
+// enable the bloom filter of B plus tree index by options
+func (db *DB) enableBloomFilter(idx index.Indexer) error {
+	bptree, ok := idx.(*index.BPlusTree)
+	if !ok || db.options.BloomFilterExpectedKeys == 0 {
+		return nil
+	}
+	return bptree.EnableBloomFilter(db.options.BloomFilterExpectedKeys, db.options.BloomFilterFalsePositiveRate)
+}
+
+// rebuild the bloom filters of all the namespaces, thus the deleted keys are dropped from them
+func (db *DB) rebuildBloomFilters() {
+	if db.options.BloomFilterExpectedKeys == 0 {
+		return
+	}
+	db.mu.RLock()
+	indexes := db.indexes()
+	db.mu.RUnlock()
+
+	//the index can be written while rebuilding
+	for _, idx := range indexes {
+		if bptree, ok := idx.(*index.BPlusTree); ok {
+			bptree.RebuildBloomFilter()
+		}
+	}
+}
+
+// sum up the bloom filters of indexes, return the memory used and the false positive rate of lookups
+// we must have mutex lock when we use this method
+func (db *DB) bloomFilterStat() (int64, float64) {
+	var size int64
+	var negatives, falsePositives uint64
+	for _, idx := range db.indexes() {
+		bptree, ok := idx.(*index.BPlusTree)
+		if !ok {
+			continue
+		}
+		if stat := bptree.BloomFilterStat(); stat != nil {
+			size += stat.Size
+			negatives += stat.Negatives
+			falsePositives += stat.FalsePositives
+		}
+	}
+	if negatives+falsePositives == 0 {
+		return size, 0
+	}
+	return size, float64(falsePositives) / float64(negatives+falsePositives)
+}
@@ -0,0 +1,68 @@
+package bitcaskGo
+
+import (
+	"bitcaskGo/utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func TestDB_BloomFilter(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-bloom-filter")
+	opts.DirPath = dir
+	opts.IndexerType = BPTree
+	opts.DataFileMergeRatio = 0
+	opts.BloomFilterExpectedKeys = 1000
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 1000; i++ {
+		err = db.Put(utils.GetTestKey(i), utils.RandomValue(24))
+		assert.Nil(t, err)
+	}
+	for i := 1000; i < 2000; i++ {
+		_, err = db.Get(utils.GetTestKey(i))
+		assert.Equal(t, ErrKeyNotFound, err)
+	}
+	stat := db.Stat()
+	assert.Greater(t, stat.BloomFilterSize, int64(0))
+	assert.Less(t, stat.BloomFilterFalsePositiveRate, 0.05)
+
+	//the deleted keys pass the filter until it's rebuilt by merge
+	for i := 0; i < 500; i++ {
+		err = db.Delete(utils.GetTestKey(i))
+		assert.Nil(t, err)
+	}
+	err = db.Merge()
+	assert.Nil(t, err)
+	for i := 0; i < 500; i++ {
+		_, err = db.Get(utils.GetTestKey(i))
+		assert.Equal(t, ErrKeyNotFound, err)
+	}
+	assert.Less(t, db.Stat().BloomFilterFalsePositiveRate, 0.05)
+
+	//the filter works after the merged files are moved in
+	err = db.Close()
+	assert.Nil(t, err)
+	db2, err := Open(opts)
+	assert.Nil(t, err)
+	defer func() {
+		_ = db2.Close()
+	}()
+	for i := 500; i < 1000; i++ {
+		_, err = db2.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+	}
+	for i := 0; i < 500; i++ {
+		_, err = db2.Get(utils.GetTestKey(i))
+		assert.Equal(t, ErrKeyNotFound, err)
+	}
+	assert.Less(t, db2.Stat().BloomFilterFalsePositiveRate, 0.05)
+
+	//only b plus tree index supports bloom filter
+	opts.IndexerType = BTree
+	_, err = Open(opts)
+	assert.NotNil(t, err)
+}
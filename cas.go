@@ -0,0 +1,75 @@
+package bitcaskGo
+
+import (
+	"bitcaskGo/data"
+	"bytes"
+)
+
+// CompareAndSwap set the value of key to newValue only when the current value equals to oldValue
+// return ErrValueMismatch if the current value is different
+func (db *DB) CompareAndSwap(key []byte, oldValue []byte, newValue []byte) error {
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+	//compare under lock right before writing, make it atomic
+	return db.writeKey(defaultNamespaceId, key, true, func() (*data.LogRecord, error) {
+		if err := db.checkValue(key, oldValue); err != nil {
+			return nil, err
+		}
+		return newPutRecord(defaultNamespaceId, key, newValue, 0), nil
+	})
+}
+
+// PutIfAbsent write key/value data only when the key doesn't exist
+// return ErrKeyExists if the key is already in database
+func (db *DB) PutIfAbsent(key []byte, value []byte) error {
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+	return db.writeKey(defaultNamespaceId, key, true, func() (*data.LogRecord, error) {
+		if err := db.checkAbsent(key); err != nil {
+			return nil, err
+		}
+		return newPutRecord(defaultNamespaceId, key, value, 0), nil
+	})
+}
+
+// DeleteIfEquals delete the key only when the current value equals to value
+// return ErrValueMismatch if the current value is different
+func (db *DB) DeleteIfEquals(key []byte, value []byte) error {
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+	return db.writeKey(defaultNamespaceId, key, true, func() (*data.LogRecord, error) {
+		if err := db.checkValue(key, value); err != nil {
+			return nil, err
+		}
+		return newDeleteRecord(defaultNamespaceId, key), nil
+	})
+}
+
+// check if the current value of key equals to the expected one
+// we must have mutex lock when we use this method
+func (db *DB) checkValue(key []byte, expected []byte) error {
+	value, err := db.get(key)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(value, expected) {
+		return ErrValueMismatch
+	}
+	return nil
+}
+
+// check if the key doesn't exist
+// we must have mutex lock when we use this method
+func (db *DB) checkAbsent(key []byte) error {
+	_, err := db.get(key)
+	if err == nil {
+		return ErrKeyExists
+	}
+	if err != ErrKeyNotFound {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package bitcaskGo
+
+import (
+	"bitcaskGo/utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestDB_CompareAndSwap(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-cas")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	//key doesn't exist
+	err = db.CompareAndSwap(utils.GetTestKey(1), []byte("a"), []byte("b"))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	err = db.Put(utils.GetTestKey(1), []byte("a"))
+	assert.Nil(t, err)
+	err = db.CompareAndSwap(utils.GetTestKey(1), []byte("a"), []byte("b"))
+	assert.Nil(t, err)
+	val, err := db.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("b"), val)
+
+	//value mismatch, nothing changed
+	err = db.CompareAndSwap(utils.GetTestKey(1), []byte("a"), []byte("c"))
+	assert.Equal(t, ErrValueMismatch, err)
+	val, err = db.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("b"), val)
+
+	//concurrent increment of a counter
+	err = db.Put(utils.GetTestKey(2), []byte("0"))
+	assert.Nil(t, err)
+	wg := new(sync.WaitGroup)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				for {
+					old, _ := db.Get(utils.GetTestKey(2))
+					n, _ := strconv.Atoi(string(old))
+					if db.CompareAndSwap(utils.GetTestKey(2), old, []byte(strconv.Itoa(n+1))) == nil {
+						break
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	val, err = db.Get(utils.GetTestKey(2))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("1000"), val)
+}
+
+func TestDB_PutIfAbsentAndDeleteIfEquals(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-cas-2")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	err = db.PutIfAbsent(utils.GetTestKey(1), []byte("a"))
+	assert.Nil(t, err)
+	err = db.PutIfAbsent(utils.GetTestKey(1), []byte("b"))
+	assert.Equal(t, ErrKeyExists, err)
+	val, err := db.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("a"), val)
+
+	err = db.DeleteIfEquals(utils.GetTestKey(1), []byte("b"))
+	assert.Equal(t, ErrValueMismatch, err)
+	err = db.DeleteIfEquals(utils.GetTestKey(1), []byte("a"))
+	assert.Nil(t, err)
+	_, err = db.Get(utils.GetTestKey(1))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	err = db.DeleteIfEquals(utils.GetTestKey(1), []byte("a"))
+	assert.Equal(t, ErrKeyNotFound, err)
+}
+
+func TestWriteBatch_Conditions(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-cas-batch")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	err = db.Put(utils.GetTestKey(1), []byte("a"))
+	assert.Nil(t, err)
+	err = db.Put(utils.GetTestKey(2), []byte("b"))
+	assert.Nil(t, err)
+
+	//one of the conditions fails, nothing is written
+	wb, err := db.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.Nil(t, err)
+	assert.Nil(t, wb.CompareAndSwap(utils.GetTestKey(1), []byte("a"), []byte("aa")))
+	assert.Nil(t, wb.PutIfAbsent(utils.GetTestKey(2), []byte("bb")))
+	err = wb.Commit()
+	assert.Equal(t, ErrKeyExists, err)
+	val, err := db.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("a"), val)
+
+	wb2, err := db.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.Nil(t, err)
+	assert.Nil(t, wb2.CompareAndSwap(utils.GetTestKey(1), []byte("a"), []byte("aa")))
+	assert.Nil(t, wb2.PutIfAbsent(utils.GetTestKey(3), []byte("c")))
+	assert.Nil(t, wb2.DeleteIfEquals(utils.GetTestKey(2), []byte("b")))
+	err = wb2.Commit()
+	assert.Nil(t, err)
+
+	val, err = db.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("aa"), val)
+	val, err = db.Get(utils.GetTestKey(3))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("c"), val)
+	_, err = db.Get(utils.GetTestKey(2))
+	assert.Equal(t, ErrKeyNotFound, err)
+}
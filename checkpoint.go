@@ -0,0 +1,239 @@
+package bitcaskGo
+
+import (
+	"bitcaskGo/data"
+	"bitcaskGo/fileio"
+	"bitcaskGo/index"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const checkpointKey = "index-checkpoint"
+
+// the state of database when the checkpoint is taken,
+// the logRecords before (fileId, offset) are covered by the checkpoint
+type checkpointState struct {
+	fileId      uint32
+	offset      int64
+	seqNo       uint64
+	reclaimSize int64
+}
+
+func (cs *checkpointState) encode() []byte {
+	buf := make([]byte, 2*binary.MaxVarintLen32+2*binary.MaxVarintLen64)
+	var index = 0
+	index += binary.PutUvarint(buf[index:], uint64(cs.fileId))
+	index += binary.PutVarint(buf[index:], cs.offset)
+	index += binary.PutUvarint(buf[index:], cs.seqNo)
+	index += binary.PutVarint(buf[index:], cs.reclaimSize)
+	return buf[:index]
+}
+
+func decodeCheckpointState(buf []byte) *checkpointState {
+	var index = 0
+	fileId, n := binary.Uvarint(buf[index:])
+	index += n
+	offset, n := binary.Varint(buf[index:])
+	index += n
+	seqNo, n := binary.Uvarint(buf[index:])
+	index += n
+	reclaimSize, _ := binary.Varint(buf[index:])
+	return &checkpointState{fileId: uint32(fileId), offset: offset, seqNo: seqNo, reclaimSize: reclaimSize}
+}
+
+// Checkpoint save the in-memory index into the checkpoint file,
+// thus Open only replays the logRecords written after it
+// the index is copied under lock, then written without blocking the writes
+func (db *DB) Checkpoint() error {
+	if db.options.ReadOnly {
+		return ErrDatabaseReadOnly
+	}
+	//the B plus tree index is saved on disk already
+	if db.options.IndexerType == BPTree {
+		return nil
+	}
+	db.checkpointMu.Lock()
+	defer db.checkpointMu.Unlock()
+
+	db.mu.Lock()
+	if db.activeFile == nil {
+		db.mu.Unlock()
+		return nil
+	}
+	state := &checkpointState{
+		fileId:      db.activeFile.Fileid,
+		offset:      db.activeFile.WriteOff,
+		seqNo:       db.seqNo,
+		reclaimSize: db.reclaimSize,
+	}
+	activeFile := db.activeFile
+	activeBlobFile := db.activeBlobFile
+	//the iterators copy the items of indexes
+	iterators := make(map[uint32]index.Iterator)
+	for id, idx := range db.indexes() {
+		iterators[id] = idx.Iterator(false)
+	}
+	db.mu.Unlock()
+	defer func() {
+		for _, iterator := range iterators {
+			iterator.Close()
+		}
+	}()
+
+	//the logRecords covered by checkpoint must be on disk, or the positions may point to nothing after crash
+	if activeBlobFile != nil {
+		if err := activeBlobFile.Sync(); err != nil {
+			return err
+		}
+	}
+	if err := activeFile.Sync(); err != nil {
+		return err
+	}
+	db.mu.Lock()
+	db.markSynced(state.fileId, state.offset)
+	db.mu.Unlock()
+
+	//the file left by a broken checkpoint
+	tempFileName := filepath.Join(db.options.DirPath, data.CheckpointTempFileName)
+	if err := db.options.FileSystem.Remove(tempFileName); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	checkpointFile, err := data.OpenCheckpointTempFile(db.options.FileSystem, db.options.DirPath)
+	if err != nil {
+		return err
+	}
+	checkpointFile.Cipher = db.cipher
+	defer func() {
+		_ = checkpointFile.Close()
+	}()
+
+	//the state is written first, thus a stale checkpoint can be found before loading the index
+	encRecord, _ := data.EncodeLogRecord(&data.LogRecord{
+		Key:   []byte(checkpointKey),
+		Value: state.encode(),
+	})
+	if err := checkpointFile.Write(encRecord); err != nil {
+		return err
+	}
+	for id, iterator := range iterators {
+		for iterator.Rewind(); iterator.Valid(); iterator.Next() {
+			if err := checkpointFile.WriteHintRecord(iterator.Key(), id, iterator.Value()); err != nil {
+				return err
+			}
+		}
+	}
+	if err := checkpointFile.Sync(); err != nil {
+		return err
+	}
+
+	//replace the old checkpoint at once
+	return db.options.FileSystem.Rename(tempFileName, filepath.Join(db.options.DirPath, data.CheckpointFileName))
+}
+
+// load the index from checkpoint file, return the state of it,
+// nil means there is no checkpoint or it's stale, then the index is loaded as before
+func (db *DB) loadIndexFromCheckpoint() (*checkpointState, error) {
+	fileName := filepath.Join(db.options.DirPath, data.CheckpointFileName)
+	if _, err := db.options.FileSystem.Stat(fileName); err != nil {
+		return nil, nil
+	}
+	checkpointFile, err := data.OpenCheckpointFile(db.options.FileSystem, db.options.DirPath)
+	if err != nil {
+		return nil, err
+	}
+	checkpointFile.Cipher = db.cipher
+	defer func() {
+		_ = checkpointFile.Close()
+	}()
+
+	logRecord, offset, err := checkpointFile.ReadLogRecord(0)
+	if err != nil {
+		return nil, err
+	}
+	state := decodeCheckpointState(logRecord.Value)
+
+	//the file covered by checkpoint is lost or truncated, e.g. by repair
+	var dataFile *data.Datafile
+	if db.activeFile != nil && db.activeFile.Fileid == state.fileId {
+		dataFile = db.activeFile
+	} else {
+		dataFile = db.olderFiles[state.fileId]
+	}
+	if dataFile == nil {
+		return nil, nil
+	}
+	size, err := dataFile.IOManager.Size()
+	if err != nil {
+		return nil, err
+	}
+	if size < state.offset {
+		return nil, nil
+	}
+
+	for {
+		logRecord, size, err := checkpointFile.ReadLogRecord(offset)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		offset += size
+
+		logRecordPos := data.DecodeLogRecordPos(logRecord.Value)
+		//the key expired or its namespace has been dropped after checkpoint
+		idx := db.indexOf(logRecord.NamespaceId)
+		if idx == nil || isExpired(logRecordPos) {
+			db.reclaimSize += int64(logRecordPos.Size)
+		} else {
+			idx.Put(logRecord.Key, logRecordPos)
+			db.addLive(logRecordPos)
+		}
+	}
+	db.seqNo = state.seqNo
+	db.reclaimSize += state.reclaimSize
+	return state, nil
+}
+
+// remove the checkpoint, the positions in it are invalid after the data files are replaced
+func removeCheckpoint(fs fileio.FileSystem, dirPath string) error {
+	for _, name := range []string{data.CheckpointFileName, data.CheckpointTempFileName} {
+		if err := fs.Remove(filepath.Join(dirPath, name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// start the goroutine which saves the checkpoint in background, it's stopped by Close
+func (db *DB) startCheckpoint() {
+	db.checkpointStop = make(chan struct{})
+	db.checkpointDone = make(chan struct{})
+	go func() {
+		defer close(db.checkpointDone)
+		ticker := time.NewTicker(db.options.IndexCheckpointInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-db.checkpointStop:
+				return
+			case <-ticker.C:
+				//a failed checkpoint is taken again next time, the old one is still valid
+				_ = db.Checkpoint()
+			}
+		}
+	}()
+}
+
+// stop the checkpoint goroutine and wait for it to exit
+func (db *DB) stopCheckpoint() {
+	if db.checkpointStop == nil {
+		return
+	}
+	close(db.checkpointStop)
+	<-db.checkpointDone
+	db.checkpointStop = nil
+}
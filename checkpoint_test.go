@@ -0,0 +1,155 @@
+package bitcaskGo
+
+import (
+	"bitcaskGo/data"
+	"bitcaskGo/utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDB_Checkpoint(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-checkpoint")
+	opts.DirPath = dir
+	opts.DataFileSize = 64 * 1024
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 1000; i++ {
+		err = db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+		assert.Nil(t, err)
+	}
+	ns, err := db.Namespace("users")
+	assert.Nil(t, err)
+	err = ns.Put([]byte("name"), []byte("bitcask"))
+	assert.Nil(t, err)
+	firstPos := db.index.Get(utils.GetTestKey(0))
+
+	err = db.Checkpoint()
+	assert.Nil(t, err)
+
+	//the logRecords after checkpoint are replayed when open
+	for i := 0; i < 100; i++ {
+		err = db.Put(utils.GetTestKey(i), []byte("value after checkpoint"))
+		assert.Nil(t, err)
+	}
+	for i := 100; i < 200; i++ {
+		err = db.Delete(utils.GetTestKey(i))
+		assert.Nil(t, err)
+	}
+	wb, err := db.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.Nil(t, err)
+	assert.Nil(t, wb.Put(utils.GetTestKey(2000), []byte("value in batch")))
+	assert.Nil(t, wb.Commit())
+	seqNo := db.seqNo
+	stats, err := db.FileStats()
+	assert.Nil(t, err)
+	err = db.Close()
+	assert.Nil(t, err)
+
+	//the logRecord before checkpoint is never read when open
+	fileName := data.GetFileName(dir, firstPos.FileId)
+	content, err := os.ReadFile(fileName)
+	assert.Nil(t, err)
+	content[firstPos.Offset+int64(firstPos.Size)-1] ^= 0xff
+	err = os.WriteFile(fileName, content, 0644)
+	assert.Nil(t, err)
+
+	db2, err := Open(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, 901, len(db2.ListKeys()))
+	for i := 0; i < 100; i++ {
+		val, err := db2.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("value after checkpoint"), val)
+	}
+	for i := 100; i < 200; i++ {
+		_, err := db2.Get(utils.GetTestKey(i))
+		assert.Equal(t, ErrKeyNotFound, err)
+	}
+	val, err := db2.Get(utils.GetTestKey(2000))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value in batch"), val)
+	ns2, err := db2.Namespace("users")
+	assert.Nil(t, err)
+	val, err = ns2.Get([]byte("name"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("bitcask"), val)
+	assert.Equal(t, seqNo, db2.seqNo)
+	stats2, err := db2.FileStats()
+	assert.Nil(t, err)
+	assert.Equal(t, stats, stats2)
+	err = db2.Close()
+	assert.Nil(t, err)
+
+	//all the data files are replayed without checkpoint
+	err = os.Remove(filepath.Join(dir, data.CheckpointFileName))
+	assert.Nil(t, err)
+	_, err = Open(opts)
+	assert.Equal(t, data.ErrInvalidCRC, err)
+}
+
+func TestDB_CheckpointAfterMerge(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-checkpoint-merge")
+	opts.DirPath = dir
+	opts.DataFileSize = 64 * 1024
+	opts.DataFileMergeRatio = 0
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 1000; i++ {
+		err = db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+		assert.Nil(t, err)
+	}
+	for i := 0; i < 500; i++ {
+		err = db.Delete(utils.GetTestKey(i))
+		assert.Nil(t, err)
+	}
+	err = db.Checkpoint()
+	assert.Nil(t, err)
+	err = db.Merge()
+	assert.Nil(t, err)
+	err = db.Close()
+	assert.Nil(t, err)
+
+	//the checkpoint is dropped when the merged files are moved in
+	db2, err := Open(opts)
+	assert.Nil(t, err)
+	_, err = os.Stat(filepath.Join(dir, data.CheckpointFileName))
+	assert.True(t, os.IsNotExist(err))
+	assert.Equal(t, 500, len(db2.ListKeys()))
+	for i := 500; i < 1000; i++ {
+		_, err := db2.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, db2.Close())
+}
+
+func TestDB_AutoCheckpoint(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-auto-checkpoint")
+	opts.DirPath = dir
+	opts.IndexCheckpointInterval = 10 * time.Millisecond
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 100; i++ {
+		err = db.Put(utils.GetTestKey(i), utils.RandomValue(24))
+		assert.Nil(t, err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	_, err = os.Stat(filepath.Join(dir, data.CheckpointFileName))
+	assert.Nil(t, err)
+
+	//b plus tree index needn't checkpoint
+	opts.IndexerType = BPTree
+	_, err = Open(opts)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,360 @@
+package bitcaskGo
+
+import (
+	"bitcaskGo/data"
+	"bitcaskGo/index"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"path/filepath"
+)
+
+// the chunks of big values are saved as the logRecords of a hidden namespace,
+// thus they are indexed, merged and reclaimed like other keys
+const chunkNamespaceId uint32 = math.MaxUint32
+
+// the max size of a chunk, a chunk never takes more than half of a data file
+const maxValueChunkSize = 1 << 20
+
+// the B plus tree index of chunks is saved in its own sub directory
+const chunkIndexDirName = "chunk-index"
+
+// the description of a chunked value, saved as the value of its key
+type chunkedValue struct {
+	seq   uint64 //unique id of the value, it separates the chunks of different values of the same key
+	count uint32 //number of chunks
+	size  int64  //size of the whole value
+}
+
+func (cv *chunkedValue) encode() []byte {
+	buf := make([]byte, binary.MaxVarintLen64*2+binary.MaxVarintLen32)
+	var index = 0
+	index += binary.PutUvarint(buf[index:], cv.seq)
+	index += binary.PutUvarint(buf[index:], uint64(cv.count))
+	index += binary.PutVarint(buf[index:], cv.size)
+	return buf[:index]
+}
+
+func decodeChunkedValue(buf []byte) (*chunkedValue, error) {
+	var index = 0
+	seq, n := binary.Uvarint(buf[index:])
+	if n <= 0 {
+		return nil, ErrDataDirectoryCorrupted
+	}
+	index += n
+	count, n := binary.Uvarint(buf[index:])
+	if n <= 0 {
+		return nil, ErrDataDirectoryCorrupted
+	}
+	index += n
+	size, n := binary.Varint(buf[index:])
+	if n <= 0 {
+		return nil, ErrDataDirectoryCorrupted
+	}
+	return &chunkedValue{seq: seq, count: uint32(count), size: size}, nil
+}
+
+// the key of a chunk, the chunks of a key are next to each other in index
+// -----------|-------|-------|-------------
+//
+//	key size	 key	  seq	  chunk index
+func chunkKey(key []byte, seq uint64, i uint32) []byte {
+	buf := make([]byte, binary.MaxVarintLen32+len(key)+8+4)
+	var index = binary.PutUvarint(buf, uint64(len(key)))
+	index += copy(buf[index:], key)
+	binary.BigEndian.PutUint64(buf[index:], seq)
+	binary.BigEndian.PutUint32(buf[index+8:], i)
+	return buf[:index+12]
+}
+
+// parse the key of a chunk, ok is false if it's invalid
+func parseChunkKey(buf []byte) (key []byte, seq uint64, i uint32, ok bool) {
+	keySize, n := binary.Uvarint(buf)
+	if n <= 0 || uint64(len(buf)-n) != keySize+12 {
+		return nil, 0, 0, false
+	}
+	key = buf[n : n+int(keySize)]
+	seq = binary.BigEndian.Uint64(buf[n+int(keySize):])
+	i = binary.BigEndian.Uint32(buf[n+int(keySize)+8:])
+	return key, seq, i, true
+}
+
+// PutReader write size bytes read from r as the value of key,
+// the value is split into chunks which are written one by one, thus it's never held in memory as a whole,
+// the value becomes visible after all the chunks are written
+func (db *DB) PutReader(key []byte, r io.Reader, size int64) error {
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+	if size < 0 {
+		return ErrInvalidValueSize
+	}
+	if db.options.ReadOnly {
+		return ErrDatabaseReadOnly
+	}
+
+	chunkSize := int64(maxValueChunkSize)
+	if half := db.options.DataFileSize / 2; half > 0 && half < chunkSize {
+		chunkSize = half
+	}
+	db.mu.Lock()
+	db.seqNo++
+	cv := &chunkedValue{seq: db.seqNo, count: uint32((size + chunkSize - 1) / chunkSize), size: size}
+	db.mu.Unlock()
+
+	buf := make([]byte, chunkSize)
+	for i := uint32(0); i < cv.count; i++ {
+		n := size - int64(i)*chunkSize
+		if n > chunkSize {
+			n = chunkSize
+		}
+		_, err := io.ReadFull(r, buf[:n])
+		if err == nil {
+			//the chunk is written alone, the other writes needn't wait for the whole value
+			err = db.put(chunkNamespaceId, chunkKey(key, cv.seq, i), buf[:n], 0)
+		}
+		if err != nil {
+			//the chunks written are useless now
+			db.mu.Lock()
+			db.removeChunks(key, cv.seq, i)
+			db.mu.Unlock()
+			return err
+		}
+	}
+
+	return db.writeKey(defaultNamespaceId, key, false, func() (*data.LogRecord, error) {
+		return &data.LogRecord{
+			Key:   logRecordKeyWithSeq(key, nonTransactionSeqNo),
+			Value: cv.encode(),
+			Type:  data.LogRecordChunked,
+		}, nil
+	})
+}
+
+// GetReader return a reader of the value of key, the chunks of a big value are read one by one when reading,
+// the value written by Put can be read as well
+func (db *DB) GetReader(key []byte) (io.ReadCloser, error) {
+	if len(key) == 0 {
+		return nil, ErrKeyIsEmpty
+	}
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	logRecordPos := db.index.Get(key)
+	if logRecordPos == nil || isExpired(logRecordPos) {
+		return nil, ErrKeyNotFound
+	}
+	logRecord, err := db.readLogRecord(logRecordPos)
+	if err != nil {
+		return nil, err
+	}
+	if logRecord.Type == data.LogRecordDeleted {
+		return nil, ErrLogRecordDeleted
+	}
+	if logRecord.Type != data.LogRecordChunked {
+		return io.NopCloser(bytes.NewReader(logRecord.Value)), nil
+	}
+
+	//the positions are taken now, the data files are never deleted before the database is closed,
+	//thus the value can be read after it's overwritten
+	positions, err := db.chunkPositions(key, logRecord.Value)
+	if err != nil {
+		return nil, err
+	}
+	return &chunkReader{db: db, positions: positions}, nil
+}
+
+// read the chunks of a value in order
+type chunkReader struct {
+	db        *DB
+	positions []*data.LogRecordPos //the chunks haven't been read
+	chunk     []byte               //the unread part of the current chunk
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.chunk) == 0 {
+		if len(r.positions) == 0 {
+			return 0, io.EOF
+		}
+		r.db.mu.RLock()
+		logRecord, err := r.db.readLogRecord(r.positions[0])
+		r.db.mu.RUnlock()
+		if err != nil {
+			return 0, err
+		}
+		r.chunk = logRecord.Value
+		r.positions = r.positions[1:]
+	}
+	n := copy(p, r.chunk)
+	r.chunk = r.chunk[n:]
+	return n, nil
+}
+
+func (r *chunkReader) Close() error {
+	r.positions, r.chunk = nil, nil
+	return nil
+}
+
+// get the positions of the chunks described by encValue
+// we must have mutex lock when we use this method
+func (db *DB) chunkPositions(key []byte, encValue []byte) ([]*data.LogRecordPos, error) {
+	cv, err := decodeChunkedValue(encValue)
+	if err != nil {
+		return nil, err
+	}
+	positions := make([]*data.LogRecordPos, 0, cv.count)
+	for i := uint32(0); i < cv.count; i++ {
+		pos := db.chunkIndex.Get(chunkKey(key, cv.seq, i))
+		if pos == nil {
+			return nil, ErrValueChunkMissing
+		}
+		positions = append(positions, pos)
+	}
+	return positions, nil
+}
+
+// read the whole chunked value of the logRecord
+// we must have mutex lock when we use this method
+func (db *DB) readChunkedValue(logRecord *data.LogRecord) ([]byte, error) {
+	key, _ := parselogRecordKey(logRecord.Key)
+	positions, err := db.chunkPositions(key, logRecord.Value)
+	if err != nil {
+		return nil, err
+	}
+	var value []byte
+	for _, pos := range positions {
+		chunk, err := db.readLogRecord(pos)
+		if err != nil {
+			return nil, err
+		}
+		value = append(value, chunk.Value...)
+	}
+	return value, nil
+}
+
+// the value of key is replaced by logRecord, drop the chunks of the old value,
+// and remember the new one if it's chunked
+// we must have mutex lock when we use this method
+func (db *DB) updateChunkedValue(key []byte, logRecord *data.LogRecord) {
+	var newCv *chunkedValue
+	if logRecord.Type == data.LogRecordChunked {
+		if cv, err := decodeChunkedValue(logRecord.Value); err == nil {
+			newCv = cv
+		}
+	}
+	if cv, ok := db.chunkedValues[string(key)]; ok {
+		delete(db.chunkedValues, string(key))
+		//the descriptor rewritten with a new expire still owns the chunks
+		if newCv == nil || newCv.seq != cv.seq {
+			db.removeChunks(key, cv.seq, cv.count)
+		}
+	}
+	if newCv != nil {
+		db.chunkedValues[string(key)] = newCv
+	}
+}
+
+// remove the first count chunks of the value from index, they can be reclaimed by merge
+// we must have mutex lock when we use this method
+func (db *DB) removeChunks(key []byte, seq uint64, count uint32) {
+	if count == 0 {
+		return
+	}
+	items := make([]*index.BatchItem, 0, count)
+	for i := uint32(0); i < count; i++ {
+		items = append(items, &index.BatchItem{Key: chunkKey(key, seq, i)})
+	}
+	for _, oldPos := range db.chunkIndex.ApplyBatch(items) {
+		if oldPos != nil {
+			db.reclaimSize += int64(oldPos.Size)
+			db.removeLive(oldPos)
+		}
+	}
+}
+
+// find the chunked values from index, and drop the chunks which don't belong to any of them,
+// e.g. the chunks of an overwritten value, or those written by a PutReader which didn't finish
+func (db *DB) loadChunkedValues() error {
+	if db.chunkIndex.Size() == 0 {
+		return nil
+	}
+	var chunkKeys [][]byte
+	iterator := db.chunkIndex.Iterator(false)
+	for iterator.Rewind(); iterator.Valid(); iterator.Next() {
+		//copy the key, it may be invalid after the iterator is closed
+		chunkKeys = append(chunkKeys, append([]byte(nil), iterator.Key()...))
+	}
+	iterator.Close()
+
+	//key ---> the chunked value, nil means the value isn't chunked
+	values := make(map[string]*chunkedValue)
+	var items []*index.BatchItem
+	for _, ck := range chunkKeys {
+		key, seq, i, ok := parseChunkKey(ck)
+		if !ok {
+			items = append(items, &index.BatchItem{Key: ck})
+			continue
+		}
+		//the seq of a value is never reused
+		if seq > db.seqNo {
+			db.seqNo = seq
+		}
+		cv, found := values[string(key)]
+		if !found {
+			var err error
+			if cv, err = db.findChunkedValue(key); err != nil {
+				return err
+			}
+			values[string(key)] = cv
+			if cv != nil {
+				db.chunkedValues[string(key)] = cv
+			}
+		}
+		if cv == nil || cv.seq != seq || i >= cv.count {
+			items = append(items, &index.BatchItem{Key: ck})
+		}
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	for _, oldPos := range db.chunkIndex.ApplyBatch(items) {
+		if oldPos != nil {
+			db.reclaimSize += int64(oldPos.Size)
+			db.removeLive(oldPos)
+		}
+	}
+	return nil
+}
+
+// read the value of key, return nil if it isn't chunked
+func (db *DB) findChunkedValue(key []byte) (*chunkedValue, error) {
+	logRecordPos := db.index.Get(key)
+	if logRecordPos == nil || isExpired(logRecordPos) {
+		return nil, nil
+	}
+	logRecord, err := db.readLogRecord(logRecordPos)
+	if err != nil {
+		return nil, err
+	}
+	if logRecord.Type != data.LogRecordChunked {
+		return nil, nil
+	}
+	return decodeChunkedValue(logRecord.Value)
+}
+
+// create the index of chunks
+func (db *DB) newChunkIndex() (index.Indexer, error) {
+	dirPath := db.options.DirPath
+	if db.options.IndexerType == BPTree {
+		dirPath = filepath.Join(dirPath, chunkIndexDirName)
+		if err := db.options.FileSystem.MkdirAll(dirPath); err != nil {
+			return nil, err
+		}
+	}
+	idx := index.NewIndexer(db.options.IndexerType, dirPath, db.options.SyncWrites)
+	if err := db.enableBloomFilter(idx); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
@@ -0,0 +1,203 @@
+package bitcaskGo
+
+import (
+	"bitcaskGo/fileio"
+	"bitcaskGo/utils"
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDB_PutReader(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-put-reader")
+	opts.DirPath = dir
+	opts.DataFileSize = 1024 * 1024
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	//the value is split into chunks across data files
+	value := utils.RandomValue(3*1024*1024 + 100)
+	err = db.PutReader(utils.GetTestKey(1), bytes.NewReader(value), int64(len(value)))
+	assert.Nil(t, err)
+	assert.Equal(t, 7, db.chunkIndex.Size())
+	assert.Equal(t, 1, len(db.ListKeys()))
+
+	reader, err := db.GetReader(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	readValue, err := io.ReadAll(reader)
+	assert.Nil(t, err)
+	assert.Nil(t, reader.Close())
+	assert.Equal(t, value, readValue)
+	getValue, err := db.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, value, getValue)
+
+	//the value written by Put can be read by reader too
+	err = db.Put(utils.GetTestKey(2), []byte("small value"))
+	assert.Nil(t, err)
+	reader, err = db.GetReader(utils.GetTestKey(2))
+	assert.Nil(t, err)
+	readValue, err = io.ReadAll(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("small value"), readValue)
+
+	//the reader is shorter than size, nothing is visible
+	err = db.PutReader(utils.GetTestKey(3), bytes.NewReader(value[:100]), int64(len(value)))
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+	_, err = db.GetReader(utils.GetTestKey(3))
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Equal(t, 7, db.chunkIndex.Size())
+
+	err = db.PutReader(nil, bytes.NewReader(value), int64(len(value)))
+	assert.Equal(t, ErrKeyIsEmpty, err)
+	err = db.PutReader(utils.GetTestKey(3), bytes.NewReader(value), -1)
+	assert.Equal(t, ErrInvalidValueSize, err)
+
+	//the value is durable after reopen
+	err = db.Close()
+	assert.Nil(t, err)
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, 7, db.chunkIndex.Size())
+	getValue, err = db.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, value, getValue)
+}
+
+func TestDB_PutReaderOverwrite(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-put-reader-overwrite")
+	opts.DirPath = dir
+	opts.DataFileSize = 1024 * 1024
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	value := utils.RandomValue(2 * 1024 * 1024)
+	err = db.PutReader(utils.GetTestKey(1), bytes.NewReader(value), int64(len(value)))
+	assert.Nil(t, err)
+	reader, err := db.GetReader(utils.GetTestKey(1))
+	assert.Nil(t, err)
+
+	//the chunks of the old value are reclaimable after overwrite
+	reclaimSize := db.reclaimSize
+	err = db.Put(utils.GetTestKey(1), []byte("small value"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, db.chunkIndex.Size())
+	assert.Greater(t, db.reclaimSize-reclaimSize, int64(len(value)))
+
+	//the reader opened before still reads the old value
+	readValue, err := io.ReadAll(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, value, readValue)
+
+	//the chunks of a value which isn't finished are dropped when open
+	err = db.put(chunkNamespaceId, chunkKey(utils.GetTestKey(2), 100, 0), []byte("chunk"), 0)
+	assert.Nil(t, err)
+	newValue := utils.RandomValue(1024 * 1024)
+	err = db.PutReader(utils.GetTestKey(1), bytes.NewReader(newValue), int64(len(newValue)))
+	assert.Nil(t, err)
+	err = db.Delete(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	err = db.PutReader(utils.GetTestKey(3), bytes.NewReader(newValue), int64(len(newValue)))
+	assert.Nil(t, err)
+	err = db.Close()
+	assert.Nil(t, err)
+
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, db.chunkIndex.Size())
+	_, err = db.Get(utils.GetTestKey(1))
+	assert.Equal(t, ErrKeyNotFound, err)
+	getValue, err := db.Get(utils.GetTestKey(3))
+	assert.Nil(t, err)
+	assert.Equal(t, newValue, getValue)
+}
+
+func TestDB_PutReaderExpire(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-put-reader-expire")
+	opts.DirPath = dir
+	opts.DataFileSize = 1024 * 1024
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	value := utils.RandomValue(2*1024*1024 + 100)
+	err = db.PutReader(utils.GetTestKey(1), bytes.NewReader(value), int64(len(value)))
+	assert.Nil(t, err)
+	chunkNum := db.chunkIndex.Size()
+
+	//only the descriptor is rewritten, the chunks are kept
+	writeOff := db.activeFile.WriteOff
+	err = db.Expire(utils.GetTestKey(1), time.Hour)
+	assert.Nil(t, err)
+	assert.Less(t, db.activeFile.WriteOff-writeOff, int64(1024))
+	assert.Equal(t, chunkNum, db.chunkIndex.Size())
+	err = db.Persist(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, chunkNum, db.chunkIndex.Size())
+	getValue, err := db.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, value, getValue)
+
+	//the chunks of the expired value are reclaimed with it
+	err = db.Expire(utils.GetTestKey(1), 10*time.Millisecond)
+	assert.Nil(t, err)
+	time.Sleep(20 * time.Millisecond)
+	db.mu.Lock()
+	db.reclaimExpiredKeys()
+	db.mu.Unlock()
+	assert.Equal(t, 0, db.chunkIndex.Size())
+	_, err = db.Get(utils.GetTestKey(1))
+	assert.Equal(t, ErrKeyNotFound, err)
+}
+
+func TestDB_PutReaderMerge(t *testing.T) {
+	for _, indexerType := range []IndexerType{BTree, BPTree} {
+		opts := DefaultOptions
+		dir, _ := os.MkdirTemp("", "bitcask-go-put-reader-merge")
+		opts.DirPath = dir
+		opts.DataFileSize = 1024 * 1024
+		opts.DataFileMergeRatio = 0
+		opts.IndexerType = indexerType
+		db, err := Open(opts)
+		assert.Nil(t, err)
+
+		oldValue := utils.RandomValue(2 * 1024 * 1024)
+		err = db.PutReader(utils.GetTestKey(1), bytes.NewReader(oldValue), int64(len(oldValue)))
+		assert.Nil(t, err)
+		value := utils.RandomValue(3 * 1024 * 1024)
+		err = db.PutReader(utils.GetTestKey(1), bytes.NewReader(value), int64(len(value)))
+		assert.Nil(t, err)
+		for i := 0; i < 100; i++ {
+			err = db.Put(utils.GetTestKey(i+10), utils.RandomValue(128))
+			assert.Nil(t, err)
+		}
+
+		err = db.Merge()
+		assert.Nil(t, err)
+		err = db.Close()
+		assert.Nil(t, err)
+
+		//the chunks of the old value are dropped, the live ones are kept
+		db, err = Open(opts)
+		assert.Nil(t, err)
+		sizeAfterMerge, err := fileio.DirSize(fileio.OSFileSystem, dir)
+		assert.Nil(t, err)
+		assert.Less(t, sizeAfterMerge, int64(len(value)+256*1024))
+		assert.Equal(t, 7, db.chunkIndex.Size())
+		reader, err := db.GetReader(utils.GetTestKey(1))
+		assert.Nil(t, err)
+		readValue, err := io.ReadAll(reader)
+		assert.Nil(t, err)
+		assert.Equal(t, value, readValue)
+		assert.Equal(t, 101, len(db.ListKeys()))
+		destroyDB(db)
+	}
+}
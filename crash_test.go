@@ -0,0 +1,288 @@
+package bitcaskGo
+
+import (
+	"bitcaskGo/data"
+	"bitcaskGo/fileio"
+	"bitcaskGo/utils"
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// the values a key may have after crash, nil means the key doesn't exist
+type crashModel map[string][][]byte
+
+// the key is written, the value may or may not survive a crash before the next sync
+func (m crashModel) write(key []byte, value []byte) {
+	values, ok := m[string(key)]
+	if !ok {
+		//the key doesn't exist before
+		values = [][]byte{nil}
+	}
+	m[string(key)] = append(values, value)
+}
+
+// all the writes before are durable, only the last value survives
+func (m crashModel) sync() {
+	for key, values := range m {
+		m[key] = values[len(values)-1:]
+	}
+}
+
+func TestDB_CrashRecovery(t *testing.T) {
+	for seed := int64(0); seed < 40; seed++ {
+		t.Run(fmt.Sprintf("seed-%d", seed), func(t *testing.T) {
+			testCrashRecovery(t, seed)
+		})
+	}
+}
+
+func testCrashRecovery(t *testing.T, seed int64) {
+	r := rand.New(rand.NewSource(seed))
+	ffs := fileio.NewFaultFileSystem(fileio.NewMemFileSystem(), seed)
+	opts := DefaultOptions
+	opts.DirPath = "/bitcask-go-crash"
+	opts.FileSystem = ffs
+	opts.DataFileSize = 16 * 1024
+	opts.DataFileMergeRatio = 0
+	opts.IndexLoadConcurrency = 1 + r.Intn(4)
+	if seed%4 == 1 {
+		opts.EncryptionKey = []byte(strings.Repeat("k", 32))
+	}
+	if seed%4 == 2 {
+		opts.Compression = Snappy
+	}
+	//half of the seeds merge only the older files with much dead data
+	if seed%8 >= 4 {
+		opts.MergeFileDeadRatio = 0.3
+	}
+
+	model := make(crashModel)
+	for round := 0; round < 5; round++ {
+		db, err := Open(opts)
+		if !assert.Nil(t, err, "round %d", round) {
+			return
+		}
+		//every key has one of the values allowed, the durable ones are never lost
+		for key, values := range model {
+			value, err := db.Get([]byte(key))
+			if err == ErrKeyNotFound {
+				value = nil
+			} else if !assert.Nil(t, err) {
+				return
+			}
+			if !assert.True(t, containsValue(values, value), "round %d key %s", round, key) {
+				return
+			}
+			model[key] = [][]byte{value}
+		}
+		assert.LessOrEqual(t, len(db.ListKeys()), len(model))
+
+		//the faults happen in the middle of the workload
+		fault := &fileio.Fault{Skip: r.Intn(200), TornWrite: true}
+		switch r.Intn(4) {
+		case 0:
+			fault.Op, fault.Err = fileio.FaultWrite, syscall.ENOSPC
+		case 1:
+			fault.Op, fault.Err = fileio.FaultSync, syscall.EIO
+		case 2:
+			//the disk gets full when merging
+			fault.Op, fault.Err, fault.Pattern = fileio.FaultWrite, syscall.ENOSPC, "*"+data.DataFileNameSuffix
+		}
+		if fault.Err != nil {
+			ffs.Inject(fault)
+		}
+		runCrashWorkload(r, db, model)
+
+		//crash, a part of the bytes which aren't synced is left
+		ffs.ClearFaults()
+		if r.Intn(2) == 0 {
+			assert.Nil(t, ffs.Crash())
+		} else {
+			assert.Nil(t, ffs.DropUnsynced())
+		}
+	}
+}
+
+func TestDB_CrashRecoveryBPTree(t *testing.T) {
+	for seed := int64(0); seed < 10; seed++ {
+		t.Run(fmt.Sprintf("seed-%d", seed), func(t *testing.T) {
+			testCrashRecoveryBPTree(t, seed)
+		})
+	}
+}
+
+// the b plus tree index is a file of os, thus the process crashes instead of the disk,
+// the bytes written are kept by the os and every acknowledged write survives
+func testCrashRecoveryBPTree(t *testing.T, seed int64) {
+	r := rand.New(rand.NewSource(seed))
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-crash-bptree")
+	defer os.RemoveAll(dir)
+	opts.DirPath = dir
+	opts.IndexerType = BPTree
+	opts.DataFileSize = 16 * 1024
+	opts.DataFileMergeRatio = 0
+	if seed%2 == 1 {
+		opts.MergeFileDeadRatio = 0.3
+	}
+
+	model := make(crashModel)
+	for round := 0; round < 5; round++ {
+		db, err := Open(opts)
+		if !assert.Nil(t, err, "round %d", round) {
+			return
+		}
+		for key, values := range model {
+			value, err := db.Get([]byte(key))
+			if err == ErrKeyNotFound {
+				value = nil
+			} else if !assert.Nil(t, err) {
+				crashDB(db)
+				return
+			}
+			if !assert.True(t, containsValue(values, value), "round %d key %s", round, key) {
+				crashDB(db)
+				return
+			}
+		}
+		assert.Equal(t, len(db.ListKeys()), countLiveKeys(model))
+
+		runCrashWorkload(r, db, model)
+		model.sync()
+		crashDB(db)
+	}
+}
+
+// the keys whose last value isn't a delete
+func countLiveKeys(model crashModel) int {
+	n := 0
+	for _, values := range model {
+		if values[len(values)-1] != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// the process crashes, the files are left without saving the seq no
+func crashDB(db *DB) {
+	db.stopAutoMerge()
+	db.stopCheckpoint()
+	db.stopSync()
+	db.mu.Lock()
+	if db.activeFile != nil {
+		_ = db.activeFile.Close()
+	}
+	for _, olderFile := range db.olderFiles {
+		_ = olderFile.Close()
+	}
+	if db.activeBlobFile != nil {
+		_ = db.activeBlobFile.Close()
+	}
+	for _, blobFile := range db.olderBlobFiles {
+		_ = blobFile.Close()
+	}
+	db.mu.Unlock()
+	_ = db.index.Close()
+	for _, ns := range db.namespaces {
+		_ = ns.index.Close()
+	}
+	_ = db.chunkIndex.Close()
+	if db.fileLock != nil {
+		_ = db.fileLock.Unlock()
+	}
+}
+
+// write to database until an operation fails
+func runCrashWorkload(r *rand.Rand, db *DB, model crashModel) {
+	for i := 0; i < 300; i++ {
+		key := utils.GetTestKey(r.Intn(100))
+		var err error
+		switch n := r.Intn(100); {
+		case n < 50:
+			value := utils.RandomValue(r.Intn(512))
+			model.write(key, value)
+			err = db.Put(key, value)
+		case n < 65:
+			model.write(key, nil)
+			err = db.Delete(key)
+		case n < 80:
+			//the b plus tree database can't use write batch after a crash, the seq no isn't saved
+			if db.options.IndexerType == BPTree && !db.seqNoFileExists && !db.isInitial {
+				continue
+			}
+			wbOpts := DefaultWriteBatchOptions
+			wbOpts.SyncWrites = r.Intn(2) == 0
+			var wb *WriteBatch
+			if wb, err = db.NewWriteBatch(wbOpts); err != nil {
+				break
+			}
+			for j := 0; j < 1+r.Intn(10); j++ {
+				key := utils.GetTestKey(r.Intn(100))
+				value := utils.RandomValue(r.Intn(512))
+				model.write(key, value)
+				if err = wb.Put(key, value); err != nil {
+					break
+				}
+			}
+			if err == nil {
+				err = wb.Commit()
+			}
+			if err == nil && wbOpts.SyncWrites {
+				model.sync()
+			}
+		case n < 95:
+			if err = db.Sync(); err == nil {
+				model.sync()
+			}
+		default:
+			if err = db.Merge(); errors.Is(err, ErrMergeRatioUnreached) {
+				err = nil
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func containsValue(values [][]byte, value []byte) bool {
+	for _, v := range values {
+		if (v == nil) == (value == nil) && bytes.Equal(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDB_FlipBit(t *testing.T) {
+	ffs := fileio.NewFaultFileSystem(fileio.NewMemFileSystem(), 0)
+	opts := DefaultOptions
+	opts.DirPath = "/bitcask-go-flip-bit"
+	opts.FileSystem = ffs
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 100; i++ {
+		err = db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+		assert.Nil(t, err)
+	}
+	pos := db.index.Get(utils.GetTestKey(50))
+	err = db.Close()
+	assert.Nil(t, err)
+
+	//the broken logRecord in the middle is found
+	err = ffs.FlipBit(data.GetFileName(opts.DirPath, 0), pos.Offset+int64(pos.Size)-1, 3)
+	assert.Nil(t, err)
+	_, err = Open(opts)
+	assert.Equal(t, data.ErrInvalidCRC, err)
+	report, err := Verify(opts)
+	assert.Nil(t, err)
+	assert.True(t, report.Corrupted())
+}
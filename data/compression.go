@@ -0,0 +1,56 @@
+package data
+
+import (
+	"errors"
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+type CompressionType = byte
+
+const (
+	// NoCompression save the value as it is
+	NoCompression CompressionType = iota
+	// SnappyCompression compress the value by snappy, fast but lower ratio
+	SnappyCompression
+	// ZstdCompression compress the value by zstd, higher ratio
+	ZstdCompression
+)
+
+var (
+	ErrUnsupportedCompression = errors.New("unsupported compression type")
+)
+
+// the encoder and decoder are safe for concurrent use when using EncodeAll and DecodeAll
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+// Compress the value by using the compression type
+func Compress(typ CompressionType, value []byte) ([]byte, error) {
+	switch typ {
+	case NoCompression:
+		return value, nil
+	case SnappyCompression:
+		return snappy.Encode(nil, value), nil
+	case ZstdCompression:
+		return zstdEncoder.EncodeAll(value, nil), nil
+	default:
+		return nil, ErrUnsupportedCompression
+	}
+}
+
+// Decompress the value which is compressed by the compression type
+func Decompress(typ CompressionType, value []byte) ([]byte, error) {
+	switch typ {
+	case NoCompression:
+		return value, nil
+	case SnappyCompression:
+		return snappy.Decode(nil, value)
+	case ZstdCompression:
+		return zstdDecoder.DecodeAll(value, nil)
+	default:
+		return nil, ErrUnsupportedCompression
+	}
+}
@@ -2,6 +2,7 @@ package data
 
 import (
 	"bitcaskGo/fileio"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"hash/crc32"
@@ -11,19 +12,29 @@ import (
 
 const (
 	DataFileNameSuffix    = ".data"
+	BlobFileNameSuffix    = ".blob"
 	HintFileName          = "hint-index"
 	MergeFinishedFileName = "merge-finished"
 	SeqNoFileName         = "seq-no"
+	NamespaceFileName     = "namespaces"
+	MergeSelectedFileName = "merge-selected"
+	CheckpointFileName    = "index-checkpoint"
+	//the checkpoint is written into this file first, then renamed to CheckpointFileName
+	CheckpointTempFileName = CheckpointFileName + ".tmp"
+	//the ids of blob files which are compacted, they are deleted when open
+	BlobCompactedFileName = "blob-compacted"
 )
 
 var (
-	ErrInvalidCRC = errors.New("invalid crc value, the log record may be broken")
+	ErrInvalidCRC         = errors.New("invalid crc value, the log record may be broken")
+	ErrInvalidBlobPointer = errors.New("invalid blob pointer, the log record may be broken")
 )
 
 type Datafile struct {
 	Fileid    uint32           //File id
 	WriteOff  int64            //The position file write to 文件写到了哪个位置
 	IOManager fileio.IOManager //io write & read manage  io读写管理
+	Cipher    *Cipher          //encrypt every record written to the file, nil means no encryption
 }
 
 func GetFileName(dirPath string, fileId uint32) string {
@@ -31,33 +42,74 @@ func GetFileName(dirPath string, fileId uint32) string {
 }
 
 // OpenDataFile open a new data file
-func OpenDataFile(dirPath string, fileId uint32, ioType fileio.FileIOType) (*Datafile, error) {
+func OpenDataFile(fs fileio.FileSystem, dirPath string, fileId uint32, ioType fileio.FileIOType) (*Datafile, error) {
 	//Construct the file name
 	fileName := GetFileName(dirPath, fileId)
-	return newDataFile(fileName, fileId, ioType)
+	return newDataFile(fs, fileName, fileId, ioType)
+}
+
+// GetBlobFileName get the name of blob file by id
+func GetBlobFileName(dirPath string, fileId uint32) string {
+	return filepath.Join(dirPath, fmt.Sprintf("%09d", fileId)+BlobFileNameSuffix)
+}
+
+// OpenBlobFile open the blob file which saves the big values
+func OpenBlobFile(fs fileio.FileSystem, dirPath string, fileId uint32) (*Datafile, error) {
+	fileName := GetBlobFileName(dirPath, fileId)
+	return newDataFile(fs, fileName, fileId, fileio.StandardFIO)
+}
+
+// OpenBlobCompactedFile open the file which saves the ids of compacted blob files
+func OpenBlobCompactedFile(fs fileio.FileSystem, dirPath string) (*Datafile, error) {
+	fileName := filepath.Join(dirPath, BlobCompactedFileName)
+	return openAppendFile(fs, fileName)
 }
 
 // OpenHintFile open hint index file
-func OpenHintFile(dirPath string) (*Datafile, error) {
+func OpenHintFile(fs fileio.FileSystem, dirPath string) (*Datafile, error) {
 	fileName := filepath.Join(dirPath, HintFileName)
-	return newDataFile(fileName, 0, fileio.StandardFIO)
+	return newDataFile(fs, fileName, 0, fileio.StandardFIO)
 }
 
 // OpenSeqNoFile  open seqno file
-func OpenSeqNoFile(dirPath string) (*Datafile, error) {
+func OpenSeqNoFile(fs fileio.FileSystem, dirPath string) (*Datafile, error) {
 	fileName := filepath.Join(dirPath, SeqNoFileName)
-	return newDataFile(fileName, 0, fileio.StandardFIO)
+	return newDataFile(fs, fileName, 0, fileio.StandardFIO)
+}
+
+// OpenNamespaceFile open the file which saves the name and id of namespaces
+func OpenNamespaceFile(fs fileio.FileSystem, dirPath string) (*Datafile, error) {
+	fileName := filepath.Join(dirPath, NamespaceFileName)
+	return openAppendFile(fs, fileName)
+}
+
+// OpenMergeSelectedFile open the file which saves the ids of files compacted by selective merge
+func OpenMergeSelectedFile(fs fileio.FileSystem, dirPath string) (*Datafile, error) {
+	fileName := filepath.Join(dirPath, MergeSelectedFileName)
+	return newDataFile(fs, fileName, 0, fileio.StandardFIO)
+}
+
+// OpenCheckpointFile open the file which saves the snapshot of in-memory index
+func OpenCheckpointFile(fs fileio.FileSystem, dirPath string) (*Datafile, error) {
+	fileName := filepath.Join(dirPath, CheckpointFileName)
+	return newDataFile(fs, fileName, 0, fileio.StandardFIO)
 }
 
-func OpenMergeFinishedFile(dirPath string) (*Datafile, error) {
+// OpenCheckpointTempFile open the file which the checkpoint is being written into
+func OpenCheckpointTempFile(fs fileio.FileSystem, dirPath string) (*Datafile, error) {
+	fileName := filepath.Join(dirPath, CheckpointTempFileName)
+	return newDataFile(fs, fileName, 0, fileio.StandardFIO)
+}
+
+func OpenMergeFinishedFile(fs fileio.FileSystem, dirPath string) (*Datafile, error) {
 	fileName := filepath.Join(dirPath, MergeFinishedFileName)
-	return newDataFile(fileName, 0, fileio.StandardFIO)
+	return newDataFile(fs, fileName, 0, fileio.StandardFIO)
 }
 
 // abstract from OpenDataFile
-func newDataFile(fileName string, fileId uint32, ioType fileio.FileIOType) (*Datafile, error) {
+func newDataFile(fs fileio.FileSystem, fileName string, fileId uint32, ioType fileio.FileIOType) (*Datafile, error) {
 	//Construct the IOManager interface
-	ioManager, err := fileio.NewIOManager(fileName, ioType)
+	ioManager, err := fs.OpenFile(fileName, ioType)
 	if err != nil {
 		return nil, err
 	}
@@ -72,6 +124,46 @@ func newDataFile(fileName string, fileId uint32, ioType fileio.FileIOType) (*Dat
 	return dataFile, nil
 }
 
+// open the file which is appended every time it's opened,
+// the logRecords are written at the end of file, the offset is a part of the encrypted frame
+func openAppendFile(fs fileio.FileSystem, fileName string) (*Datafile, error) {
+	dataFile, err := newDataFile(fs, fileName, 0, fileio.StandardFIO)
+	if err != nil {
+		return nil, err
+	}
+	size, err := dataFile.IOManager.Size()
+	if err != nil {
+		_ = dataFile.Close()
+		return nil, err
+	}
+	dataFile.WriteOff = size
+	return dataFile, nil
+}
+
+// Preallocate reserve the space of file up to size, it does nothing if the IOManager doesn't support it
+func (df *Datafile) Preallocate(size int64) error {
+	if preallocator, ok := df.IOManager.(fileio.Preallocator); ok {
+		return preallocator.Preallocate(size)
+	}
+	return nil
+}
+
+// ValidSize get the size of the logRecords read from the beginning of file,
+// the bytes after them are torn or preallocated
+func (df *Datafile) ValidSize() (int64, error) {
+	var offset int64 = 0
+	for {
+		_, size, err := df.ReadLogRecord(offset)
+		if err != nil {
+			if err == io.EOF {
+				return offset, nil
+			}
+			return 0, err
+		}
+		offset += size
+	}
+}
+
 func (df *Datafile) ReadLogRecord(offset int64) (*LogRecord, int64, error) {
 	//get the file size
 	fileSize, err := df.IOManager.Size()
@@ -79,6 +171,106 @@ func (df *Datafile) ReadLogRecord(offset int64) (*LogRecord, int64, error) {
 		return nil, 0, err
 	}
 
+	//the encrypted logRecord is wrapped in a frame, decrypt it first
+	if df.Cipher != nil {
+		return df.readEncryptedLogRecord(offset, fileSize)
+	}
+	return decodeLogRecordAt(df.readNBytes, fileSize, offset)
+}
+
+// read the encrypted frame at offset and decode the logRecord in it
+//
+//	4 bytes		4 bytes		12 bytes	  variant
+//	+-------------+------------+-----------+----------------+
+//	| frame size  |	  key id   |	nonce  |	ciphertext  |
+//	+-------------+------------+-----------+----------------+
+func (df *Datafile) readEncryptedLogRecord(offset int64, fileSize int64) (*LogRecord, int64, error) {
+	plainBuf, frameSize, err := df.readFrame(offset, fileSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	logRecord, _, err := decodeLogRecordAt(readPlain(plainBuf), int64(len(plainBuf)), 0)
+	if err != nil {
+		return nil, 0, err
+	}
+	return logRecord, frameSize, nil
+}
+
+// read the encrypted frame at offset and decrypt it, the size of frame in file is returned as well
+func (df *Datafile) readFrame(offset int64, fileSize int64) ([]byte, int64, error) {
+	if offset+frameSizeLen > fileSize {
+		return nil, 0, io.EOF
+	}
+	sizeBuf, err := df.readNBytes(frameSizeLen, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	frameSize := int64(binary.LittleEndian.Uint32(sizeBuf))
+	//the frame which is not completely written is treated as the end of file
+	if frameSize == 0 || offset+frameSizeLen+frameSize > fileSize {
+		return nil, 0, io.EOF
+	}
+
+	frame, err := df.readNBytes(frameSize, offset+frameSizeLen)
+	if err != nil {
+		return nil, 0, err
+	}
+	plainBuf, err := df.Cipher.open(frame, df.Fileid, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	return plainBuf, frameSizeLen + frameSize, nil
+}
+
+func readPlain(plainBuf []byte) func(n int64, offset int64) ([]byte, error) {
+	return func(n int64, offset int64) ([]byte, error) {
+		if offset+n > int64(len(plainBuf)) {
+			return nil, io.EOF
+		}
+		return plainBuf[offset : offset+n], nil
+	}
+}
+
+// ReadEncodedLogRecord read the encoded logRecord at offset, it's decrypted when the file has a Cipher,
+// the size of it in file is returned as well, the logRecord is checked as ReadLogRecord does
+func (df *Datafile) ReadEncodedLogRecord(offset int64) ([]byte, int64, error) {
+	fileSize, err := df.IOManager.Size()
+	if err != nil {
+		return nil, 0, err
+	}
+	if df.Cipher != nil {
+		plainBuf, frameSize, err := df.readFrame(offset, fileSize)
+		if err != nil {
+			return nil, 0, err
+		}
+		if _, _, err := decodeLogRecordAt(readPlain(plainBuf), int64(len(plainBuf)), 0); err != nil {
+			return nil, 0, err
+		}
+		return plainBuf, frameSize, nil
+	}
+	_, size, err := decodeLogRecordAt(df.readNBytes, fileSize, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	encRecord, err := df.readNBytes(size, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	return encRecord, size, nil
+}
+
+// IsPlainLogRecord check if there is a valid logRecord written without encryption at offset
+func (df *Datafile) IsPlainLogRecord(offset int64) bool {
+	fileSize, err := df.IOManager.Size()
+	if err != nil {
+		return false
+	}
+	_, _, err = decodeLogRecordAt(df.readNBytes, fileSize, offset)
+	return err == nil
+}
+
+// decode the logRecord at offset, readNBytes read n bytes from the offset of the source
+func decodeLogRecordAt(readNBytes func(n int64, offset int64) ([]byte, error), fileSize int64, offset int64) (*LogRecord, int64, error) {
 	var headerSize int64 = maxLogRecordHeaderSize
 
 	//when we handle the last logRecord at the data file,
@@ -97,7 +289,7 @@ func (df *Datafile) ReadLogRecord(offset int64) (*LogRecord, int64, error) {
 	}
 
 	//get the encoded header  of logRecord
-	encoHeaderBuf, err := df.readNBytes(headerSize, offset)
+	encoHeaderBuf, err := readNBytes(headerSize, offset)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -119,10 +311,16 @@ func (df *Datafile) ReadLogRecord(offset int64) (*LogRecord, int64, error) {
 	keySize, valueSize := int64(header.keySize), int64(header.valueSize)
 
 	var logRecordSize = headerSize + keySize + valueSize
+	//the logRecord isn't completely written, or the size in header is broken
+	if offset+logRecordSize > fileSize {
+		return nil, 0, io.EOF
+	}
 
 	//set logRecord's type
 	logRecord := &LogRecord{
-		Type: header.logRecordType,
+		Type:        header.logRecordType,
+		Expire:      header.expire,
+		NamespaceId: header.namespaceId,
 	}
 	if keySize > 0 || valueSize > 0 {
 		//read after the logRecordHeader, and get the kvBuf that contains key and value
@@ -132,7 +330,7 @@ func (df *Datafile) ReadLogRecord(offset int64) (*LogRecord, int64, error) {
 							      |     kvBuf    |
 		*/
 
-		kvBuf, err := df.readNBytes(keySize+valueSize, offset+headerSize)
+		kvBuf, err := readNBytes(keySize+valueSize, offset+headerSize)
 		if err != nil {
 			return nil, 0, err
 		}
@@ -150,10 +348,28 @@ func (df *Datafile) ReadLogRecord(offset int64) (*LogRecord, int64, error) {
 	if crc != header.crc {
 		return nil, 0, ErrInvalidCRC
 	}
+
+	//the crc is calculated by the compressed value, decompress it after checking
+	if header.compression != NoCompression {
+		value, err := Decompress(header.compression, logRecord.Value)
+		if err != nil {
+			return nil, 0, err
+		}
+		logRecord.Value = value
+	}
 	return logRecord, logRecordSize, nil
 }
 
+// Write the buf into file, when the file has a Cipher,
+// the buf must be exactly one encoded logRecord, it is encrypted into a frame
 func (df *Datafile) Write(buf []byte) error {
+	if df.Cipher != nil {
+		frame, err := df.Cipher.seal(buf, df.Fileid, df.WriteOff)
+		if err != nil {
+			return err
+		}
+		buf = frame
+	}
 	n, err := df.IOManager.Write(buf)
 	if err != nil {
 		return err
@@ -163,11 +379,12 @@ func (df *Datafile) Write(buf []byte) error {
 	return nil
 }
 
-// WriteHintRecord write index information into hint file
-func (df *Datafile) WriteHintRecord(key []byte, pos *LogRecordPos) error {
+// WriteHintRecord write index information of the key in namespace into hint file
+func (df *Datafile) WriteHintRecord(key []byte, namespaceId uint32, pos *LogRecordPos) error {
 	record := &LogRecord{
-		Key:   key,
-		Value: EncodeLogRecordPos(pos),
+		Key:         key,
+		Value:       EncodeLogRecordPos(pos),
+		NamespaceId: namespaceId,
 	}
 	encRecord, _ := EncodeLogRecord(record)
 	return df.Write(encRecord)
@@ -181,11 +398,11 @@ func (df *Datafile) Close() error {
 	return df.IOManager.Close()
 }
 
-func (df *Datafile) SetIOManager(dirPath string, ioType fileio.FileIOType) error {
+func (df *Datafile) SetIOManager(fs fileio.FileSystem, dirPath string, ioType fileio.FileIOType) error {
 	if err := df.IOManager.Close(); err != nil {
 		return err
 	}
-	ioManager, err := fileio.NewIOManager(GetFileName(dirPath, df.Fileid), ioType)
+	ioManager, err := fs.OpenFile(GetFileName(dirPath, df.Fileid), ioType)
 	if err != nil {
 		return err
 	}
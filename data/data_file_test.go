@@ -2,21 +2,23 @@ package data
 
 import (
 	"bitcaskGo/fileio"
+	"bytes"
 	"github.com/stretchr/testify/assert"
+	"io"
 	"os"
 	"testing"
 )
 
 func TestOpenDataFile(t *testing.T) {
-	dataFile1, err := OpenDataFile(os.TempDir(), 0, fileio.StandardFIO)
+	dataFile1, err := OpenDataFile(fileio.OSFileSystem, os.TempDir(), 0, fileio.StandardFIO)
 	assert.Nil(t, err)
 	assert.NotNil(t, dataFile1)
 
-	dataFile2, err := OpenDataFile(os.TempDir(), 11, fileio.StandardFIO)
+	dataFile2, err := OpenDataFile(fileio.OSFileSystem, os.TempDir(), 11, fileio.StandardFIO)
 	assert.Nil(t, err)
 	assert.NotNil(t, dataFile2)
 
-	dataFile3, err := OpenDataFile(os.TempDir(), 11, fileio.StandardFIO)
+	dataFile3, err := OpenDataFile(fileio.OSFileSystem, os.TempDir(), 11, fileio.StandardFIO)
 	assert.Nil(t, err)
 	assert.NotNil(t, dataFile3)
 
@@ -24,7 +26,7 @@ func TestOpenDataFile(t *testing.T) {
 }
 
 func TestDatafile_Write(t *testing.T) {
-	dataFile, err := OpenDataFile(os.TempDir(), 0, fileio.StandardFIO)
+	dataFile, err := OpenDataFile(fileio.OSFileSystem, os.TempDir(), 0, fileio.StandardFIO)
 	assert.Nil(t, err)
 	assert.NotNil(t, dataFile)
 
@@ -39,7 +41,7 @@ func TestDatafile_Write(t *testing.T) {
 }
 
 func TestDatafile_Close(t *testing.T) {
-	dataFile, err := OpenDataFile(os.TempDir(), 22, fileio.StandardFIO)
+	dataFile, err := OpenDataFile(fileio.OSFileSystem, os.TempDir(), 22, fileio.StandardFIO)
 	assert.Nil(t, err)
 	assert.NotNil(t, dataFile)
 
@@ -51,7 +53,7 @@ func TestDatafile_Close(t *testing.T) {
 }
 
 func TestDatafile_Sync(t *testing.T) {
-	dataFile, err := OpenDataFile(os.TempDir(), 33, fileio.StandardFIO)
+	dataFile, err := OpenDataFile(fileio.OSFileSystem, os.TempDir(), 33, fileio.StandardFIO)
 	assert.Nil(t, err)
 	assert.NotNil(t, dataFile)
 
@@ -63,7 +65,7 @@ func TestDatafile_Sync(t *testing.T) {
 }
 
 func TestDatafile_ReadLogRecord(t *testing.T) {
-	datafile, err := OpenDataFile(os.TempDir(), 77, fileio.StandardFIO)
+	datafile, err := OpenDataFile(fileio.OSFileSystem, os.TempDir(), 77, fileio.StandardFIO)
 	assert.Nil(t, err)
 	assert.NotNil(t, datafile)
 
@@ -119,3 +121,100 @@ func TestDatafile_ReadLogRecord(t *testing.T) {
 	assert.Equal(t, logRecord3, readLogRecord3)
 	assert.Equal(t, size3, readSize3)
 }
+
+func TestDatafile_ReadCompressedLogRecord(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "bitcask-go-compression")
+	defer os.RemoveAll(dir)
+	datafile, err := OpenDataFile(fileio.OSFileSystem, dir, 0, fileio.StandardFIO)
+	assert.Nil(t, err)
+	assert.NotNil(t, datafile)
+
+	value := bytes.Repeat([]byte("bitcask-value"), 100)
+	var offset int64
+	for _, typ := range []CompressionType{SnappyCompression, ZstdCompression} {
+		compressed, err := Compress(typ, value)
+		assert.Nil(t, err)
+		assert.Less(t, len(compressed), len(value))
+
+		encoLogRecord, size := EncodeLogRecord(&LogRecord{
+			Key:         []byte("name"),
+			Value:       compressed,
+			Type:        LogRecordNormal,
+			Compression: typ,
+		})
+		err = datafile.Write(encoLogRecord)
+		assert.Nil(t, err)
+
+		//the value read from file is decompressed
+		readLogRecord, readSize, err := datafile.ReadLogRecord(offset)
+		assert.Nil(t, err)
+		assert.Equal(t, value, readLogRecord.Value)
+		assert.Equal(t, LogRecordNormal, readLogRecord.Type)
+		assert.Equal(t, size, readSize)
+		offset += size
+	}
+}
+
+func TestDatafile_ReadEncryptedLogRecord(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "bitcask-go-encryption")
+	defer os.RemoveAll(dir)
+	oldKey := bytes.Repeat([]byte("o"), 16)
+	newKey := bytes.Repeat([]byte("n"), 32)
+
+	datafile, err := OpenDataFile(fileio.OSFileSystem, dir, 0, fileio.StandardFIO)
+	assert.Nil(t, err)
+	datafile.Cipher, err = NewCipher(oldKey)
+	assert.Nil(t, err)
+
+	logRecord1 := &LogRecord{Key: []byte("name"), Value: []byte("bitcask-go"), Type: LogRecordNormal}
+	encoLogRecord1, _ := EncodeLogRecord(logRecord1)
+	err = datafile.Write(encoLogRecord1)
+	assert.Nil(t, err)
+	size1 := datafile.WriteOff
+
+	//the records encrypted by the old key are readable after rotation
+	datafile.Cipher, err = NewCipher(newKey, oldKey)
+	assert.Nil(t, err)
+	logRecord2 := &LogRecord{Key: []byte("name"), Value: []byte("new-value"), Type: LogRecordDeleted}
+	encoLogRecord2, _ := EncodeLogRecord(logRecord2)
+	err = datafile.Write(encoLogRecord2)
+	assert.Nil(t, err)
+
+	readLogRecord1, readSize1, err := datafile.ReadLogRecord(0)
+	assert.Nil(t, err)
+	assert.Equal(t, logRecord1, readLogRecord1)
+	assert.Equal(t, size1, readSize1)
+
+	readLogRecord2, readSize2, err := datafile.ReadLogRecord(readSize1)
+	assert.Nil(t, err)
+	assert.Equal(t, logRecord2, readLogRecord2)
+	assert.Equal(t, datafile.WriteOff, readSize1+readSize2)
+
+	_, _, err = datafile.ReadLogRecord(datafile.WriteOff)
+	assert.Equal(t, io.EOF, err)
+
+	//the plain data isn't in the file
+	buf := make([]byte, datafile.WriteOff)
+	_, err = datafile.IOManager.Read(buf, 0)
+	assert.Nil(t, err)
+	assert.False(t, bytes.Contains(buf, []byte("bitcask-go")))
+
+	//without the old key, the first record can't be decrypted
+	datafile.Cipher, err = NewCipher(newKey)
+	assert.Nil(t, err)
+	_, _, err = datafile.ReadLogRecord(0)
+	assert.Equal(t, ErrUnknownEncryptionKey, err)
+
+	//the frame moved to another file can't be decrypted
+	datafile2, err := OpenDataFile(fileio.OSFileSystem, dir, 1, fileio.StandardFIO)
+	assert.Nil(t, err)
+	defer datafile2.Close()
+	datafile2.Cipher = datafile.Cipher
+	_, err = datafile2.IOManager.Write(buf[readSize1:])
+	assert.Nil(t, err)
+	_, _, err = datafile2.ReadLogRecord(0)
+	assert.Equal(t, ErrDecryptFailed, err)
+
+	_, err = NewCipher([]byte("short"))
+	assert.NotNil(t, err)
+}
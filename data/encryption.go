@@ -0,0 +1,105 @@
+package data
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	frameSizeLen = 4
+	keyIdLen     = 4
+)
+
+var (
+	ErrUnknownEncryptionKey = errors.New("the record is encrypted by an unknown key")
+	ErrDecryptFailed        = errors.New("failed to decrypt the record, the key is wrong or the record is broken")
+)
+
+// Cipher encrypt records by AES-GCM with the current key,
+// and decrypt records by the key which encrypted them, thus the keys can be rotated
+type Cipher struct {
+	currentId uint32                 //id of the key used to encrypt
+	aeads     map[uint32]cipher.AEAD //key id ---> AEAD
+}
+
+// NewCipher create a cipher which encrypts with key, and is able to decrypt with key and oldKeys
+// the length of key must be 16, 24 or 32 bytes, to select AES-128, AES-192, or AES-256
+func NewCipher(key []byte, oldKeys ...[]byte) (*Cipher, error) {
+	c := &Cipher{aeads: make(map[uint32]cipher.AEAD)}
+	for _, k := range append([][]byte{key}, oldKeys...) {
+		block, err := aes.NewCipher(k)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		c.aeads[keyId(k)] = aead
+	}
+	c.currentId = keyId(key)
+	return c, nil
+}
+
+// the key id is saved in each frame to find the key when decrypt,
+// it's part of the key's sha256, the key itself can't be recovered from it
+func keyId(key []byte) uint32 {
+	sum := sha256.Sum256(key)
+	return binary.LittleEndian.Uint32(sum[:keyIdLen])
+}
+
+// SealedSize get the size of frame which n bytes are sealed into
+func (c *Cipher) SealedSize(n int64) int64 {
+	aead := c.aeads[c.currentId]
+	return frameSizeLen + keyIdLen + int64(aead.NonceSize()+aead.Overhead()) + n
+}
+
+// the position of frame is authenticated together with it,
+// thus a frame can't be moved to another file or offset without being detected
+func associatedData(fileId uint32, offset int64) []byte {
+	ad := make([]byte, 12)
+	binary.LittleEndian.PutUint32(ad[:4], fileId)
+	binary.LittleEndian.PutUint64(ad[4:], uint64(offset))
+	return ad
+}
+
+// encrypt the plain buf which is written at offset of file, return the frame including the frame size
+func (c *Cipher) seal(plainBuf []byte, fileId uint32, offset int64) ([]byte, error) {
+	aead := c.aeads[c.currentId]
+	nonceSize := aead.NonceSize()
+	frameSize := keyIdLen + nonceSize + len(plainBuf) + aead.Overhead()
+
+	frame := make([]byte, frameSizeLen+keyIdLen+nonceSize, frameSizeLen+frameSize)
+	binary.LittleEndian.PutUint32(frame[:frameSizeLen], uint32(frameSize))
+	binary.LittleEndian.PutUint32(frame[frameSizeLen:], c.currentId)
+	nonce := frame[frameSizeLen+keyIdLen:]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(frame, nonce, plainBuf, associatedData(fileId, offset)), nil
+}
+
+// decrypt the frame read from offset of file, the frame doesn't include the frame size
+func (c *Cipher) open(frame []byte, fileId uint32, offset int64) ([]byte, error) {
+	if len(frame) < keyIdLen {
+		return nil, ErrDecryptFailed
+	}
+	aead, ok := c.aeads[binary.LittleEndian.Uint32(frame[:keyIdLen])]
+	if !ok {
+		return nil, ErrUnknownEncryptionKey
+	}
+	nonceSize := aead.NonceSize()
+	if len(frame) < keyIdLen+nonceSize {
+		return nil, ErrDecryptFailed
+	}
+	nonce := frame[keyIdLen : keyIdLen+nonceSize]
+	plainBuf, err := aead.Open(nil, nonce, frame[keyIdLen+nonceSize:], associatedData(fileId, offset))
+	if err != nil {
+		return nil, ErrDecryptFailed
+	}
+	return plainBuf, nil
+}
@@ -11,6 +11,26 @@ const (
 	LogRecordNormal LogRecordType = iota
 	LogRecordDeleted
 	LogRecordTxnFinished
+	//the value is split into chunks, the logRecord only describes them
+	LogRecordChunked
+	//the value is saved in a blob file, the logRecord only points to it
+	LogRecordBlob
+)
+
+// the high bits of the type byte are used as flags,
+// records written before the flags existed never set them, thus they stay readable
+const (
+	logRecordTypeMask byte = 0x0f
+
+	//two bits saving the compression type of the value
+	logRecordCompressionMask  byte = 0x30
+	logRecordCompressionShift      = 4
+
+	//the header carries an expire timestamp after the value size
+	logRecordExpireFlag byte = 1 << 7
+
+	//the header carries a namespace id after the expire timestamp
+	logRecordNamespaceFlag byte = 1 << 6
 )
 
 // logRecordHeader:
@@ -18,14 +38,21 @@ const (
 // type -- 1 byte
 // key size --dynamic size max to 5 bytes
 // value size -- dynamic size, max to 5 bytes
+// expire -- dynamic size, max to 10 bytes, only exists when the expire flag is set
+// namespace id -- dynamic size, max to 5 bytes, only exists when the namespace flag is set
 //
-//total:15bytes
-const maxLogRecordHeaderSize = 4 + 1 + binary.MaxVarintLen32*2
+//total:30bytes
+const maxLogRecordHeaderSize = 4 + 1 + binary.MaxVarintLen32*3 + binary.MaxVarintLen64
 
 type LogRecord struct {
-	Key   []byte
-	Value []byte
-	Type  LogRecordType
+	Key    []byte
+	Value  []byte
+	Type   LogRecordType
+	Expire int64 //the unix nano timestamp that record expire, 0 means never
+
+	NamespaceId uint32 //the namespace the record belongs to, 0 is the default namespace
+
+	Compression CompressionType //how the value is compressed, the value read from file is always decompressed
 }
 
 type logRecordHeader struct {
@@ -33,13 +60,26 @@ type logRecordHeader struct {
 	logRecordType LogRecordType //type of logRecord(deleted or normal)
 	keySize       uint32        //size of key
 	valueSize     uint32        //size of value
+	expire        int64         //expire timestamp, 0 means never
+	namespaceId   uint32        //namespace id, 0 means the default namespace
+	compression   CompressionType
 }
 
 // LogRecordPos 数据内存索引，表示数据在磁盘上的位置
 type LogRecordPos struct {
-	FileId uint32 //文件id，代表数据在哪个文件当中
-	Offset int64  //数据存储在文件中的哪个位置
-	Size   uint32 //标识数据在磁盘上的大小
+	FileId     uint32 //文件id，代表数据在哪个文件当中
+	BlobFileId uint32 //the blob file which saves the value, only valid when BlobSize isn't 0
+	Offset     int64  //数据存储在文件中的哪个位置
+	Size       uint32 //标识数据在磁盘上的大小
+	BlobSize   uint32 //size of the value in blob file, 0 means the value isn't in blob file
+	Expire     int64  //the unix nano timestamp that data expire, 0 means never
+}
+
+// BlobPointer where the value is saved in blob file, it's the value of the logRecord which type is blob
+type BlobPointer struct {
+	FileId uint32
+	Offset int64
+	Size   uint32
 }
 
 // TransactionRecord the data save temporary in one transaction
@@ -51,16 +91,16 @@ type TransactionRecord struct {
 
 // EncodeLogRecord Encode LogRecord, return a byte array and length
 //
-//		4 bytes    1byte    variant(max 5)	variant(max 5)
-//	-----------+----------+--------------+----------------+-----------+-----------+
-//	|  crc   |    type   |	  key size  |	 value size   |	    key    |	value  |
-//	----------+--------- +--------------+-----------------+----------+-----------+
+//		4 bytes    1byte    variant(max 5)	variant(max 5)	variant(max 10)	variant(max 5)
+//	-----------+----------+--------------+----------------+-------------+----------------+-----------+-----------+
+//	|  crc   |    type   |	  key size  |	 value size   |	 expire(opt) |	namespace(opt) |    key    |	value  |
+//	----------+--------- +--------------+-----------------+-------------+----------------+----------+-----------+
 func EncodeLogRecord(logRecord *LogRecord) ([]byte, int64) {
 	//construct a header byte array
 	header := make([]byte, maxLogRecordHeaderSize)
 
 	//save type value after 4 bytes(crc size)
-	header[4] = logRecord.Type
+	header[4] = logRecord.Type | logRecord.Compression<<logRecordCompressionShift
 	var index = 5
 
 	//save the key size and value size after 5 bytes
@@ -68,6 +108,16 @@ func EncodeLogRecord(logRecord *LogRecord) ([]byte, int64) {
 	//update the index after every save operation
 	index += binary.PutVarint(header[index:], int64(len(logRecord.Key)))
 	index += binary.PutVarint(header[index:], int64(len(logRecord.Value)))
+	//only records with a deadline carry the expire field
+	if logRecord.Expire != 0 {
+		header[4] |= logRecordExpireFlag
+		index += binary.PutVarint(header[index:], logRecord.Expire)
+	}
+	//the records of default namespace don't carry the namespace id
+	if logRecord.NamespaceId != 0 {
+		header[4] |= logRecordNamespaceFlag
+		index += binary.PutVarint(header[index:], int64(logRecord.NamespaceId))
+	}
 
 	//get the size of encoded bytes array
 	var encoBytesSize = index + len(logRecord.Key) + len(logRecord.Value)
@@ -93,11 +143,17 @@ func EncodeLogRecord(logRecord *LogRecord) ([]byte, int64) {
 
 // EncodeLogRecordPos encode the logRecord position
 func EncodeLogRecordPos(pos *LogRecordPos) []byte {
-	encPos := make([]byte, binary.MaxVarintLen32*2+binary.MaxVarintLen64)
+	encPos := make([]byte, binary.MaxVarintLen32*4+binary.MaxVarintLen64*2)
 	var index = 0
 	index += binary.PutVarint(encPos[index:], int64(pos.FileId))
 	index += binary.PutVarint(encPos[index:], pos.Offset)
 	index += binary.PutVarint(encPos[index:], int64(pos.Size))
+	index += binary.PutVarint(encPos[index:], pos.Expire)
+	//only the positions referencing a blob carry the blob file id and size
+	if pos.BlobSize > 0 {
+		index += binary.PutVarint(encPos[index:], int64(pos.BlobFileId))
+		index += binary.PutVarint(encPos[index:], int64(pos.BlobSize))
+	}
 	return encPos[:index]
 }
 
@@ -109,13 +165,56 @@ func DecodeLogRecordPos(encPos []byte) *LogRecordPos {
 	index += n
 	offset, n := binary.Varint(encPos[index:])
 	index += n
-	size, _ := binary.Varint(encPos[index:])
+	size, n := binary.Varint(encPos[index:])
+	index += n
+	//positions encoded before expire existed have no more bytes, expire is 0 then
+	expire, n := binary.Varint(encPos[index:])
+	index += n
 
-	return &LogRecordPos{
+	pos := &LogRecordPos{
 		FileId: uint32(fileId),
 		Offset: offset,
 		Size:   uint32(size),
+		Expire: expire,
+	}
+	if index < len(encPos) {
+		blobFileId, n := binary.Varint(encPos[index:])
+		index += n
+		blobSize, _ := binary.Varint(encPos[index:])
+		pos.BlobFileId = uint32(blobFileId)
+		pos.BlobSize = uint32(blobSize)
+	}
+	return pos
+}
+
+// EncodeBlobPointer encode the position of value in blob file
+func EncodeBlobPointer(ptr *BlobPointer) []byte {
+	buf := make([]byte, binary.MaxVarintLen32*2+binary.MaxVarintLen64)
+	var index = 0
+	index += binary.PutVarint(buf[index:], int64(ptr.FileId))
+	index += binary.PutVarint(buf[index:], ptr.Offset)
+	index += binary.PutVarint(buf[index:], int64(ptr.Size))
+	return buf[:index]
+}
+
+// DecodeBlobPointer decode the position of value in blob file
+func DecodeBlobPointer(buf []byte) (*BlobPointer, error) {
+	var index = 0
+	fileId, n := binary.Varint(buf[index:])
+	if n <= 0 {
+		return nil, ErrInvalidBlobPointer
+	}
+	index += n
+	offset, n := binary.Varint(buf[index:])
+	if n <= 0 {
+		return nil, ErrInvalidBlobPointer
+	}
+	index += n
+	size, n := binary.Varint(buf[index:])
+	if n <= 0 {
+		return nil, ErrInvalidBlobPointer
 	}
+	return &BlobPointer{FileId: uint32(fileId), Offset: offset, Size: uint32(size)}, nil
 }
 
 // decode the header information in the byte array
@@ -127,19 +226,48 @@ func decodeLogRecordHeader(buf []byte) (*logRecordHeader, int64) {
 
 	header := &logRecordHeader{
 		crc:           binary.LittleEndian.Uint32(buf[:4]),
-		logRecordType: buf[4],
+		logRecordType: buf[4] & logRecordTypeMask,
+		compression:   (buf[4] & logRecordCompressionMask) >> logRecordCompressionShift,
 	}
 
 	var index = 5
+	//the header is cut off if a size can't be decoded, e.g. the tail of a file torn by a crash
 	//get the keySize
 	keySize, n := binary.Varint(buf[index:])
+	if n <= 0 {
+		return nil, 0
+	}
 	header.keySize = uint32(keySize)
 	index += n
 
 	//get the value size
 	valueSize, n := binary.Varint(buf[index:])
+	if n <= 0 {
+		return nil, 0
+	}
 	header.valueSize = uint32(valueSize)
-	index += n //index is the size of logRecordHeader now
+	index += n
+
+	//get the expire timestamp if the record has one
+	if buf[4]&logRecordExpireFlag != 0 {
+		expire, n := binary.Varint(buf[index:])
+		if n <= 0 {
+			return nil, 0
+		}
+		header.expire = expire
+		index += n
+	}
+
+	//get the namespace id if the record has one
+	if buf[4]&logRecordNamespaceFlag != 0 {
+		namespaceId, n := binary.Varint(buf[index:])
+		if n <= 0 {
+			return nil, 0
+		}
+		header.namespaceId = uint32(namespaceId)
+		index += n
+	}
+	//index is the size of logRecordHeader now
 
 	return header, int64(index)
 }
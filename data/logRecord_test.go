@@ -109,3 +109,37 @@ func TestGetlogRecordCRC(t *testing.T) {
 	assert.Equal(t, uint32(1805825810), crc3)
 
 }
+
+func TestEncodeLogRecord_Expire(t *testing.T) {
+	logRecord := &LogRecord{
+		Key:    []byte("name"),
+		Value:  []byte("chenyi"),
+		Type:   LogRecordNormal,
+		Expire: 1700000000000000000,
+	}
+	encBytes, size := EncodeLogRecord(logRecord)
+	assert.NotNil(t, encBytes)
+
+	header, headerSize := decodeLogRecordHeader(encBytes)
+	assert.NotNil(t, header)
+	assert.Equal(t, LogRecordNormal, header.logRecordType)
+	assert.Equal(t, uint32(4), header.keySize)
+	assert.Equal(t, uint32(6), header.valueSize)
+	assert.Equal(t, logRecord.Expire, header.expire)
+	assert.Equal(t, size, headerSize+4+6)
+
+	//the record without expire keeps the old layout
+	header2, headerSize2 := decodeLogRecordHeader([]byte{151, 110, 52, 182, 0, 8, 12})
+	assert.Equal(t, int64(7), headerSize2)
+	assert.Equal(t, int64(0), header2.expire)
+}
+
+func TestDecodeLogRecordPos(t *testing.T) {
+	pos := &LogRecordPos{FileId: 3, Offset: 1024, Size: 88, Expire: 1700000000000000000}
+	assert.Equal(t, pos, DecodeLogRecordPos(EncodeLogRecordPos(pos)))
+
+	//position encoded without expire
+	oldEncPos := []byte{6, 128, 16, 176, 1}
+	oldPos := DecodeLogRecordPos(oldEncPos)
+	assert.Equal(t, &LogRecordPos{FileId: 3, Offset: 1024, Size: 88}, oldPos)
+}
@@ -4,10 +4,8 @@ import (
 	"bitcaskGo/data"
 	"bitcaskGo/fileio"
 	"bitcaskGo/index"
-	"bitcaskGo/utils"
 	"errors"
 	"fmt"
-	"github.com/gofrs/flock"
 	"io"
 	"os"
 	"path/filepath"
@@ -15,6 +13,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 const (
@@ -22,6 +21,9 @@ const (
 	fileLockName = "flock"
 )
 
+// the records without namespace belong to the default namespace, its index is db.index
+const defaultNamespaceId uint32 = 0
+
 type DB struct {
 	options         Options
 	mu              *sync.RWMutex
@@ -33,91 +35,238 @@ type DB struct {
 	isMerging       bool                      //check if the database is in the process of merging
 	seqNoFileExists bool                      //signify that if the file which save the transaction seqNo exists
 	isInitial       bool                      //if is the first time to initial this data directory
-	fileLock        *flock.Flock              //file lock ensure the mutex of different processes
+	fileLock        fileio.Locker             //file lock ensure the mutex of different processes
+	cipher          *data.Cipher              //encrypt the files, nil means no encryption
 	bytesWrite      uint                      //the total number of bytes that were written
 	reclaimSize     int64                     //signify the size that need to be merged/reclaimed
+	namespaces      map[uint32]*Namespace     //named namespaces map by namespace id
+	maxNamespaceId  uint32                    //the biggest namespace id ever used, dropped ones included
+
+	//logRecords of the transactions whose finished logRecord hasn't been read, seqNo ---> logRecords
+	txnRecords map[uint64][]*data.TransactionRecord
+
+	liveBytes map[uint32]int64 //file id ---> size of the logRecords referenced by indexes
+
+	mergeFinishedFile os.FileInfo            //the merge finished file when the read only database is opened
+	dataFileInfos     map[uint32]os.FileInfo //the data files loaded by the read only database
+
+	lastMergeTime     time.Time     //when the last merge started
+	lastMergeDuration time.Duration //how long the last merge took
+	lastMergeErr      error         //the result of the last merge
+	mergePending      bool          //a finished merge waits for the next Open to move its files in
+	autoMergeStop     chan struct{} //close it to stop the auto merge goroutine
+	autoMergeDone     chan struct{} //closed when the auto merge goroutine exits
+
+	checkpointMu   *sync.Mutex   //only one checkpoint is written at a time
+	checkpointStop chan struct{} //close it to stop the checkpoint goroutine
+	checkpointDone chan struct{} //closed when the checkpoint goroutine exits
+
+	valueCache *valueCache //nil means the values aren't cached
+	fileCache  *fileCache  //nil means all the older files are kept open
+
+	commitMu    *sync.Mutex      //protect the commit queue
+	commitQueue []*commitRequest //the writes waiting for group commit, the first one is the leader
+
+	chunkIndex    index.Indexer            //index of the chunks of big values
+	chunkedValues map[string]*chunkedValue //the keys whose value is chunked, key ---> the chunks
+
+	syncedPos *data.LogRecordPos //the data before this position is durable, only FileId and Offset are used
+	syncStop  chan struct{}      //close it to stop the background sync goroutine
+	syncDone  chan struct{}      //closed when the background sync goroutine exits
+
+	activeBlobFile     *data.Datafile            //current blob file to write the big values
+	olderBlobFiles     map[uint32]*data.Datafile //the older blob files map by file id, only for read
+	blobLiveBytes      map[uint32]int64          //blob file id ---> size of the values referenced by indexes
+	compactedBlobFiles map[uint32]bool           //the blob files compacted, they are deleted when open
+	isCompactingBlobs  bool                      //check if the blob files are in the process of compaction
 }
 
 type Stat struct {
-	KeyNum          uint  //number of keys in database
-	DataFileNum     uint  //number of data files
-	ReclaimableSize int64 //number of data that can be merged (in bytes)
-	DiskSize        int64 //Disk space occupied by the data directory
+	KeyNum          uint            //number of keys in database, all namespaces included
+	DataFileNum     uint            //number of data files
+	ReclaimableSize int64           //number of data that can be merged (in bytes on disk, after compression)
+	DiskSize        int64           //Disk space occupied by the data directory
+	NamespaceKeyNum map[string]uint //number of keys in each named namespace
+
+	LastMergeTime     time.Time     //when the last merge started, zero means no merge has run since open
+	LastMergeDuration time.Duration //how long the last merge took
+	LastMergeErr      error         //the result of the last merge, nil means succeeded
+
+	BloomFilterSize              int64   //memory used by the bloom filters of all namespaces
+	BloomFilterFalsePositiveRate float64 //share of the lookups for absent keys which pass the bloom filters
+
+	ValueCacheHits   uint64 //number of values read from the value cache
+	ValueCacheMisses uint64 //number of values read from data files when the value cache is enabled
+
+	BlobFileNum         uint  //number of blob files, the compacted ones not included
+	BlobReclaimableSize int64 //size of the values in blob files which aren't referenced, reclaimed by CompactBlobs
+
+	OpenDataFileNum    uint    //number of data files open, the older ones are limited by MaxOpenFiles
+	DataFileReopenRate float64 //share of the reads of older files which open the file again
 }
 
 // Open Open a Bitcask storage engine instance.
 // 打开bitcask存储引擎实例
-func Open(options Options) (*DB, error) {
+func Open(options Options) (_ *DB, err error) {
 	//Check the user's database options
 	if err := CheckOptions(options); err != nil {
 		return nil, err
 	}
+	if options.FileSystem == nil {
+		options.FileSystem = fileio.OSFileSystem
+	}
+
+	var cipher *data.Cipher
+	if len(options.EncryptionKey) > 0 {
+		if cipher, err = data.NewCipher(options.EncryptionKey, options.OldEncryptionKeys...); err != nil {
+			return nil, err
+		}
+	}
 	var isInitial bool
 	//Check if the data directory exist, if not, create a new one
-	if _, err := os.Stat(options.DirPath); os.IsNotExist(err) {
+	if _, err := options.FileSystem.Stat(options.DirPath); os.IsNotExist(err) {
+		//there is nothing to read
+		if options.ReadOnly {
+			return nil, err
+		}
 		isInitial = true
-		if err := os.MkdirAll(options.DirPath, os.ModePerm); err != nil {
+		if err := options.FileSystem.MkdirAll(options.DirPath); err != nil {
 			return nil, err
 		}
 	}
 
 	//check if the current data directory is using
-	fileLock := flock.New(filepath.Join(options.DirPath, fileLockName))
-	hold, err := fileLock.TryLock()
-	if err != nil {
-		return nil, err
-	}
-	if !hold {
-		return nil, ErrDataBaseisUsing
+	//the read only database doesn't take the lock, thus it can coexist with the writer
+	var fileLock fileio.Locker
+	if !options.ReadOnly {
+		fileLock = options.FileSystem.Lock(filepath.Join(options.DirPath, fileLockName))
+		hold, err := fileLock.TryLock()
+		if err != nil {
+			return nil, err
+		}
+		if !hold {
+			return nil, ErrDataBaseisUsing
+		}
 	}
+	//release the lock if we fail to open, e.g. the encryption key is wrong
+	defer func() {
+		if err != nil && fileLock != nil {
+			_ = fileLock.Unlock()
+		}
+	}()
 
 	//if the data directory exists, but it's empty,
 	//we still need to set isInitial to true
-	entries, err := os.ReadDir(options.DirPath)
+	entries, err := options.FileSystem.ReadDir(options.DirPath)
 	if err != nil {
 		return nil, err
 	}
-	if len(entries) == 0 {
+	//the file lock has been created above, it doesn't count
+	if len(entries) == 0 || (len(entries) == 1 && entries[0].Name() == fileLockName) {
 		isInitial = true
 	}
 
+	if cipher != nil && !isInitial {
+		if err := checkEncrypted(options, cipher); err != nil {
+			return nil, err
+		}
+	}
+
 	db := &DB{
 		options:    options,
 		mu:         new(sync.RWMutex),
 		olderFiles: make(map[uint32]*data.Datafile),
+		namespaces: make(map[uint32]*Namespace),
 		index:      index.NewIndexer(options.IndexerType, options.DirPath, options.SyncWrites),
 		isInitial:  isInitial,
 		fileLock:   fileLock,
+		cipher:     cipher,
+		txnRecords: make(map[uint64][]*data.TransactionRecord),
+		liveBytes:  make(map[uint32]int64),
+
+		chunkedValues: make(map[string]*chunkedValue),
+
+		olderBlobFiles:     make(map[uint32]*data.Datafile),
+		blobLiveBytes:      make(map[uint32]int64),
+		compactedBlobFiles: make(map[uint32]bool),
+
+		checkpointMu: new(sync.Mutex),
+		commitMu:     new(sync.Mutex),
+	}
+	if options.ValueCacheSize > 0 {
+		db.valueCache = newValueCache(options.ValueCacheSize)
+	}
+	if options.MaxOpenFiles > 0 {
+		db.fileCache = newFileCache(options.MaxOpenFiles)
+	}
+	if err := db.enableBloomFilter(db.index); err != nil {
+		return nil, err
+	}
+	if db.chunkIndex, err = db.newChunkIndex(); err != nil {
+		return nil, err
 	}
 
-	//load merge data directory
-	if err := db.loadMergeFiles(); err != nil {
+	//load namespaces, their indexes are needed when loading index and merge files
+	if err := db.loadNamespaces(); err != nil {
 		return nil, err
 	}
 
+	if options.ReadOnly {
+		//the merged files are moved into data directory by the writer,
+		//remember the merge finished file, thus Refresh can find out the data files are replaced
+		db.mergeFinishedFile, _ = db.options.FileSystem.Stat(filepath.Join(options.DirPath, data.MergeFinishedFileName))
+		//the selective merge replaces the data files with the new ones of the same ids, remember the files too
+		if db.dataFileInfos, err = db.statDataFiles(); err != nil {
+			return nil, err
+		}
+	} else {
+		//load merge data directory
+		if err := db.loadMergeFiles(); err != nil {
+			return nil, err
+		}
+	}
+
 	//Load the data file
 	if err := db.loadDataFiles(); err != nil {
 
 		return nil, err
 	}
+	//load the blob files, the values of logRecords are read from them
+	if err := db.loadBlobFiles(); err != nil {
+		return nil, err
+	}
 
 	//if we use b plus tree as the indexer
 	//we don't need to load index from data files
 	if options.IndexerType != BPTree {
-		//load index from hint file
-		if err := db.loadIndexFromHintFile(); err != nil {
+		//load index from checkpoint, the hint file is covered by it
+		checkpoint, err := db.loadIndexFromCheckpoint()
+		if err != nil {
 			return nil, err
 		}
 
-		//load index from data files
-		if err := db.loadIndexFromDataFiles(); err != nil {
+		//load index from hint file
+		if checkpoint == nil {
+			if err := db.loadIndexFromHintFile(); err != nil {
+				return nil, err
+			}
+		}
+
+		//load index from data files, only the logRecords after checkpoint
+		if err := db.loadIndexFromDataFiles(checkpoint); err != nil {
 			return nil, err
 		}
+		//the new logRecords are appended right after the valid ones
+		if !options.ReadOnly {
+			if err := db.truncateActiveFile(); err != nil {
+				return nil, err
+			}
+		}
+
 		//reset the ioType to standard file io
 		if err := db.resetIOType(); err != nil {
 			return nil, err
 		}
-
 	}
 
 	//retrieve the current seqNo when indexer is B Plus Tree
@@ -125,6 +274,8 @@ func Open(options Options) (*DB, error) {
 		if err := db.loadSeqNo(); err != nil {
 			return nil, err
 		}
+		//the positions are kept in the index file, count the live bytes from them
+		db.loadLiveBytes()
 		//because we jump out the loadIndex function,
 		//thus we need to update the writeoff in active file manually
 		if db.activeFile != nil {
@@ -134,6 +285,48 @@ func Open(options Options) (*DB, error) {
 			}
 			db.activeFile.WriteOff = size
 		}
+		//the preallocated tail may be left by a crash, it isn't covered by the index
+		if db.activeIOType() != fileio.StandardFIO && db.activeFile != nil {
+			if db.activeFile.WriteOff, err = db.activeFile.ValidSize(); err != nil {
+				return nil, err
+			}
+			if err := db.truncateActiveFile(); err != nil {
+				return nil, err
+			}
+		}
+		//the files may be opened by mmap at startup, which can't be written
+		if err := db.resetIOType(); err != nil {
+			return nil, err
+		}
+	}
+
+	//reserve the space of active file again, it's cut off when the file is closed
+	if options.PreallocateDataFile && !options.ReadOnly && db.activeFile != nil {
+		if err := db.activeFile.Preallocate(options.DataFileSize); err != nil {
+			return nil, err
+		}
+	}
+
+	//the read only database only reads the chunks by the values
+	if !options.ReadOnly {
+		if err := db.loadChunkedValues(); err != nil {
+			return nil, err
+		}
+	}
+
+	if options.AutoMergeInterval > 0 && !options.ReadOnly {
+		db.startAutoMerge()
+	}
+	if options.IndexCheckpointInterval > 0 && !options.ReadOnly {
+		db.startCheckpoint()
+	}
+
+	//the data in files when open is regarded as durable
+	if db.activeFile != nil {
+		db.markSynced(db.activeFile.Fileid, db.activeFile.WriteOff)
+	}
+	if options.SyncInterval > 0 && !options.ReadOnly {
+		db.startSync()
 	}
 	return db, nil
 }
@@ -146,17 +339,61 @@ func (db *DB) Stat() *Stat {
 	if db.activeFile != nil {
 		dataFileNum += 1
 	}
+	openDataFileNum := dataFileNum
+	var reopenRate float64
+	if db.fileCache != nil {
+		var openOlderFileNum int
+		openOlderFileNum, reopenRate = db.fileCache.stat()
+		openDataFileNum = dataFileNum - uint(len(db.olderFiles)) + uint(openOlderFileNum)
+	}
 
-	dirSize, err := utils.DirSize(db.options.DirPath)
+	dirSize, err := fileio.DirSize(db.options.FileSystem, db.options.DirPath)
 	if err != nil {
 		panic(fmt.Sprintf("failed to get dir size : %v", err))
 	}
 
+	var keyNum = uint(db.index.Size())
+	namespaceKeyNum := make(map[string]uint, len(db.namespaces))
+	for _, ns := range db.namespaces {
+		namespaceKeyNum[ns.name] = uint(ns.index.Size())
+		keyNum += uint(ns.index.Size())
+	}
+
+	bloomFilterSize, bloomFilterFPRate := db.bloomFilterStat()
+	var cacheHits, cacheMisses uint64
+	if db.valueCache != nil {
+		cacheHits, cacheMisses = db.valueCache.stat()
+	}
+	blobStats, err := db.blobFileStats(true)
+	if err != nil {
+		panic(fmt.Sprintf("failed to get blob file stats : %v", err))
+	}
+	var blobReclaimableSize int64
+	for _, stat := range blobStats {
+		blobReclaimableSize += stat.DeadBytes
+	}
 	return &Stat{
-		KeyNum:          uint(db.index.Size()),
+		KeyNum:          keyNum,
 		DataFileNum:     dataFileNum,
 		ReclaimableSize: db.reclaimSize,
 		DiskSize:        dirSize, //
+		NamespaceKeyNum: namespaceKeyNum,
+
+		LastMergeTime:     db.lastMergeTime,
+		LastMergeDuration: db.lastMergeDuration,
+		LastMergeErr:      db.lastMergeErr,
+
+		BloomFilterSize:              bloomFilterSize,
+		BloomFilterFalsePositiveRate: bloomFilterFPRate,
+
+		ValueCacheHits:   cacheHits,
+		ValueCacheMisses: cacheMisses,
+
+		BlobFileNum:         uint(len(blobStats)),
+		BlobReclaimableSize: blobReclaimableSize,
+
+		OpenDataFileNum:    openDataFileNum,
+		DataFileReopenRate: reopenRate,
 	}
 }
 
@@ -164,33 +401,12 @@ func (db *DB) Stat() *Stat {
 func (db *DB) Backup(dir string) error {
 	db.mu.RLock()
 	defer db.mu.RUnlock()
-	return utils.CopyDir(db.options.DirPath, dir, []string{fileLockName})
+	return fileio.CopyDir(db.options.FileSystem, db.options.DirPath, dir, []string{fileLockName})
 }
 
 // Put Write key/value data , the key can't be empty
 func (db *DB) Put(key []byte, value []byte) error {
-	//Check the key is available
-	if len(key) == 0 {
-		return ErrKeyIsEmpty
-	}
-
-	//Construct LogRecord struct
-	logRecord := &data.LogRecord{
-		Key:   logRecordKeyWithSeq(key, nonTransactionSeqNo),
-		Value: value,
-		Type:  data.LogRecordNormal,
-	}
-	//Append(Write) logRecord to activeFile
-	pos, err := db.appendLogRecordWithLock(logRecord)
-	if err != nil {
-		return err
-	}
-
-	if oldPos := db.index.Put(key, pos); oldPos != nil {
-		db.reclaimSize += int64(oldPos.Size)
-	}
-
-	return nil
+	return db.putWithExpire(key, value, 0)
 }
 
 func (db *DB) Get(key []byte) ([]byte, error) {
@@ -201,13 +417,25 @@ func (db *DB) Get(key []byte) ([]byte, error) {
 	if len(key) == 0 {
 		return nil, ErrKeyIsEmpty
 	}
+	return db.get(key)
+}
+
+// get the value of the key
+// we must have mutex lock when we use this method
+func (db *DB) get(key []byte) ([]byte, error) {
+	return db.getFromIndex(db.index, key)
+}
+
+// get the value of the key by using the given index
+func (db *DB) getFromIndex(idx index.Indexer, key []byte) ([]byte, error) {
 	//Get the logRecordPos from index by using key
 	//从内存数据结构中取出key对应的索引信息
-	logRecordPos := db.index.Get(key)
+	logRecordPos := idx.Get(key)
 
 	//If key doesn't in memory data indexer, this key isn't exist
 	//如果key不在内存索引中，说明key不存在
-	if logRecordPos == nil {
+	//an expired key is treated as not exist either
+	if logRecordPos == nil || isExpired(logRecordPos) {
 		return nil, ErrKeyNotFound
 	}
 
@@ -217,9 +445,15 @@ func (db *DB) Get(key []byte) ([]byte, error) {
 
 // Close the database
 func (db *DB) Close() error {
+	//wait for the running auto merge and checkpoint, they use the files
+	db.stopAutoMerge()
+	db.stopCheckpoint()
+	db.stopSync()
 	defer func() {
-		if err := db.fileLock.Unlock(); err != nil {
-			panic(fmt.Sprintf("failed to unlock the directory, %v", err))
+		if db.fileLock != nil {
+			if err := db.fileLock.Unlock(); err != nil {
+				panic(fmt.Sprintf("failed to unlock the directory, %v", err))
+			}
 		}
 
 		//when the indexer is bptree, we need to close the indexer when close the db
@@ -227,6 +461,14 @@ func (db *DB) Close() error {
 		if err := db.index.Close(); err != nil {
 			panic(fmt.Sprintf("failed to close the index"))
 		}
+		for _, ns := range db.namespaces {
+			if err := ns.index.Close(); err != nil {
+				panic(fmt.Sprintf("failed to close the index of namespace %s", ns.name))
+			}
+		}
+		if err := db.chunkIndex.Close(); err != nil {
+			panic(fmt.Sprintf("failed to close the index of chunks"))
+		}
 	}()
 	if db.activeFile == nil {
 		return nil
@@ -235,22 +477,25 @@ func (db *DB) Close() error {
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
-	//save the current seq no
-	seqNoFile, err := data.OpenSeqNoFile(db.options.DirPath)
-	if err != nil {
-		return err
-	}
-	seqNoRecord := &data.LogRecord{
-		Key:   []byte(seqNoKey),
-		Value: []byte(strconv.FormatUint(db.seqNo, 10)), //converse the seqNo into a decimal string
-	}
-	encLogRecord, _ := data.EncodeLogRecord(seqNoRecord)
-	if err := seqNoFile.Write(encLogRecord); err != nil {
-		return err
-	}
+	//save the current seq no, the seq no belongs to the writer
+	if !db.options.ReadOnly {
+		seqNoFile, err := data.OpenSeqNoFile(db.options.FileSystem, db.options.DirPath)
+		if err != nil {
+			return err
+		}
+		seqNoFile.Cipher = db.cipher
+		seqNoRecord := &data.LogRecord{
+			Key:   []byte(seqNoKey),
+			Value: []byte(strconv.FormatUint(db.seqNo, 10)), //converse the seqNo into a decimal string
+		}
+		encLogRecord, _ := data.EncodeLogRecord(seqNoRecord)
+		if err := seqNoFile.Write(encLogRecord); err != nil {
+			return err
+		}
 
-	if err := seqNoFile.Sync(); err != nil {
-		return err
+		if err := seqNoFile.Sync(); err != nil {
+			return err
+		}
 	}
 
 	//close the active data file
@@ -264,28 +509,54 @@ func (db *DB) Close() error {
 			return err
 		}
 	}
+
+	//close blob files
+	if db.activeBlobFile != nil {
+		if err := db.activeBlobFile.Close(); err != nil {
+			return err
+		}
+	}
+	for _, blobFile := range db.olderBlobFiles {
+		if err := blobFile.Close(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 // Sync Persisting data files, sync active file's data into disk
 func (db *DB) Sync() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
 	if db.activeFile == nil {
 		return nil
 	}
-	db.mu.Lock()
-	defer db.mu.Unlock()
-	return db.activeFile.Sync()
+	if err := db.syncBlobFile(); err != nil {
+		return err
+	}
+	if err := db.activeFile.Sync(); err != nil {
+		return err
+	}
+	db.markSynced(db.activeFile.Fileid, db.activeFile.WriteOff)
+	return nil
 }
 
 // ListKeys get all keys in the database
 func (db *DB) ListKeys() [][]byte {
-	iterator := db.index.Iterator(false) //use index iterator, because index have all keys' information
+	return db.listKeys(db.index)
+}
+
+// get all keys in the given index
+func (db *DB) listKeys(idx index.Indexer) [][]byte {
+	iterator := idx.Iterator(false) //use index iterator, because index have all keys' information
 	defer iterator.Close()
-	keys := make([][]byte, db.index.Size())
-	var idx int
+	keys := make([][]byte, 0, idx.Size())
 	for iterator.Rewind(); iterator.Valid(); iterator.Next() {
-		keys[idx] = iterator.Key()
-		idx++
+		//jump out the expired keys
+		if isExpired(iterator.Value()) {
+			continue
+		}
+		keys = append(keys, iterator.Key())
 	}
 	return keys
 }
@@ -295,10 +566,17 @@ func (db *DB) ListKeys() [][]byte {
 func (db *DB) Fold(fn func(key []byte, value []byte) bool) error {
 	db.mu.RLock()
 	defer db.mu.RUnlock()
+	return db.fold(db.index, fn)
+}
 
-	iterator := db.index.Iterator(false)
+// traverse the given index, we must have mutex lock when we use this method
+func (db *DB) fold(idx index.Indexer, fn func(key []byte, value []byte) bool) error {
+	iterator := idx.Iterator(false)
 	defer iterator.Close()
 	for iterator.Rewind(); iterator.Valid(); iterator.Next() {
+		if isExpired(iterator.Value()) {
+			continue
+		}
 		value, err := db.getValueByPosition(iterator.Value())
 		if err != nil {
 			return err
@@ -312,7 +590,47 @@ func (db *DB) Fold(fn func(key []byte, value []byte) bool) error {
 
 // get value by using logRecordPos
 func (db *DB) getValueByPosition(logRecordPos *data.LogRecordPos) ([]byte, error) {
+	//the cached value is shared, return a copy of it
+	if db.valueCache != nil {
+		if value, ok := db.valueCache.get(logRecordPos); ok {
+			return append([]byte(nil), value...), nil
+		}
+	}
 
+	logRecord, err := db.readLogRecord(logRecordPos)
+	if err != nil {
+		return nil, err
+	}
+	if logRecord.Type == data.LogRecordDeleted {
+		return nil, ErrLogRecordDeleted
+	}
+	//the big value isn't cached
+	if logRecord.Type == data.LogRecordChunked {
+		return db.readChunkedValue(logRecord)
+	}
+
+	if db.valueCache != nil {
+		db.valueCache.put(logRecordPos, append([]byte(nil), logRecord.Value...))
+	}
+	return logRecord.Value, nil
+}
+
+// read the logRecord at the position, the value saved in blob file is read as well
+// we must have mutex lock when we use this method
+func (db *DB) readLogRecord(logRecordPos *data.LogRecordPos) (*data.LogRecord, error) {
+	logRecord, err := db.readRawLogRecord(logRecordPos)
+	if err != nil {
+		return nil, err
+	}
+	if logRecord.Type == data.LogRecordBlob {
+		return db.readBlob(logRecord)
+	}
+	return logRecord, nil
+}
+
+// read the logRecord at the position as it is in data file
+// we must have mutex lock when we use this method
+func (db *DB) readRawLogRecord(logRecordPos *data.LogRecordPos) (*data.LogRecord, error) {
 	//Get the datafile from correspond FileId
 	var dataFile *data.Datafile
 
@@ -331,14 +649,7 @@ func (db *DB) getValueByPosition(logRecordPos *data.LogRecordPos) ([]byte, error
 	//Read the data by using correspond offset from logRecordPos
 
 	logRecord, _, err := dataFile.ReadLogRecord(logRecordPos.Offset)
-	if err != nil {
-		return nil, err
-	}
-	if logRecord.Type == data.LogRecordDeleted {
-		return nil, ErrLogRecordDeleted
-	}
-
-	return logRecord.Value, nil
+	return logRecord, err
 }
 
 func (db *DB) Delete(key []byte) error {
@@ -346,43 +657,119 @@ func (db *DB) Delete(key []byte) error {
 	if len(key) == 0 {
 		return ErrKeyIsEmpty
 	}
+	return db.delete(defaultNamespaceId, key)
+}
 
-	//Check if the key exists, if it doesn't, return directly
-	if logRecordPos := db.index.Get(key); logRecordPos == nil {
-		return nil
-	}
+// write a deleted logRecord of the key in namespace and remove it from index
+func (db *DB) delete(namespaceId uint32, key []byte) error {
+	return db.writeKey(namespaceId, key, true, func() (*data.LogRecord, error) {
+		//Check if the key exists, if it doesn't, return directly
+		idx := db.indexOf(namespaceId)
+		if idx == nil {
+			return nil, ErrNamespaceDropped
+		}
+		if logRecordPos := idx.Get(key); logRecordPos == nil {
+			return nil, nil
+		}
+		return newDeleteRecord(namespaceId, key), nil
+	})
+}
 
-	//Construct the logRecord which type is deleted
-	logRecord := &data.LogRecord{
-		Key:  logRecordKeyWithSeq(key, nonTransactionSeqNo),
-		Type: data.LogRecordDeleted,
-	}
+// write a normal logRecord of the key in namespace and update the index
+func (db *DB) put(namespaceId uint32, key []byte, value []byte, expire int64) error {
+	logRecord := newPutRecord(namespaceId, key, value, expire)
+	return db.writeKey(namespaceId, key, false, func() (*data.LogRecord, error) {
+		return logRecord, nil
+	})
+}
 
-	//Write(append) this logRecord to data file
-	pos, err := db.appendLogRecordWithLock(logRecord)
-	if err != nil {
-		return err
-	}
-	db.reclaimSize += int64(pos.Size)
-	//Delete the correspond key in index
-	oldPos, success := db.index.Delete(key)
-	if !success {
-		return ErrIndexUpdateFailed
+// write a logRecord of the key in namespace by group commit, then update the index
+// prepare is called under lock right before writing, it returns the logRecord to write, nil means nothing to write,
+// reading means prepare reads the database, e.g. compare the current value
+func (db *DB) writeKey(namespaceId uint32, key []byte, reading bool, prepare func() (*data.LogRecord, error)) error {
+	if db.options.ReadOnly {
+		return ErrDatabaseReadOnly
 	}
-	if oldPos != nil {
-		db.reclaimSize += int64(oldPos.Size)
+	var logRecord *data.LogRecord
+	return db.commit(&commitRequest{
+		reading: reading,
+		prepare: func() ([]*data.LogRecord, error) {
+			var err error
+			if logRecord, err = prepare(); err != nil || logRecord == nil {
+				return nil, err
+			}
+			return []*data.LogRecord{logRecord}, nil
+		},
+		apply: func(positions []*data.LogRecordPos) error {
+			pos := positions[0]
+			idx := db.indexOf(namespaceId)
+			//the namespace is dropped before the logRecord is written
+			if idx == nil {
+				db.reclaimSize += int64(pos.Size)
+				return ErrNamespaceDropped
+			}
+
+			var oldPos *data.LogRecordPos
+			if logRecord.Type == data.LogRecordDeleted {
+				db.reclaimSize += int64(pos.Size)
+				//Delete the correspond key in index
+				var success bool
+				if oldPos, success = idx.Delete(key); !success {
+					return ErrIndexUpdateFailed
+				}
+			} else {
+				db.addLive(pos)
+				oldPos = idx.Put(key, pos)
+			}
+			if oldPos != nil {
+				db.reclaimSize += int64(oldPos.Size)
+				db.removeLive(oldPos)
+			}
+			if namespaceId == defaultNamespaceId {
+				db.updateChunkedValue(key, logRecord)
+			}
+			return nil
+		},
+	})
+}
+
+// construct the logRecord which writes the value of key
+func newPutRecord(namespaceId uint32, key []byte, value []byte, expire int64) *data.LogRecord {
+	return &data.LogRecord{
+		Key:         logRecordKeyWithSeq(key, nonTransactionSeqNo),
+		Value:       value,
+		Type:        data.LogRecordNormal,
+		Expire:      expire,
+		NamespaceId: namespaceId,
 	}
-	return nil
 }
 
-func (db *DB) appendLogRecordWithLock(logRecord *data.LogRecord) (*data.LogRecordPos, error) {
-	db.mu.Lock()
-	defer db.mu.Unlock()
-	return db.appendLogRecord(logRecord)
+// construct the logRecord which type is deleted
+func newDeleteRecord(namespaceId uint32, key []byte) *data.LogRecord {
+	return &data.LogRecord{
+		Key:         logRecordKeyWithSeq(key, nonTransactionSeqNo),
+		Type:        data.LogRecordDeleted,
+		NamespaceId: namespaceId,
+	}
 }
 
-// Append logRecord to activeFile
+// Append logRecord to activeFile, and sync it depends on options
+// we must have mutex lock when we use this method
 func (db *DB) appendLogRecord(logRecord *data.LogRecord) (*data.LogRecordPos, error) {
+	positions, err := db.appendLogRecords([]*data.LogRecord{logRecord})
+	if err != nil {
+		return nil, err
+	}
+	if err := db.syncActiveFile(false); err != nil {
+		return nil, err
+	}
+	return positions[0], nil
+}
+
+// Append logRecords to activeFile in order, the logRecords in the same file are written at once,
+// return the positions of them, they are not synced
+// we must have mutex lock when we use this method
+func (db *DB) appendLogRecords(logRecords []*data.LogRecord) ([]*data.LogRecordPos, error) {
 
 	//Check if the current active datafile is existed,
 	//because when database have no write, the active datafile is empty
@@ -394,54 +781,142 @@ func (db *DB) appendLogRecord(logRecord *data.LogRecord) (*data.LogRecordPos, er
 		}
 	}
 
-	//Encode logRecord, get ready for writing
-	encLogRecord, length := data.EncodeLogRecord(logRecord)
-
-	//Check if the data size bigger than activefile's limit
-	if db.activeFile.WriteOff+length > db.options.DataFileSize {
-		//if so, in order to save the data to disk, we need to sync the datafile to disk
-		//先持久化数据文件，保证数据都持久化到磁盘中
-		if err := db.activeFile.Sync(); err != nil {
+	//the big values are saved into blob files first, the logRecords written point to them
+	if db.options.BlobThreshold > 0 {
+		var err error
+		if logRecords, err = db.separateValues(logRecords); err != nil {
 			return nil, err
 		}
+	}
 
-		//Transform the activefile to olderfile
-		db.olderFiles[db.activeFile.Fileid] = db.activeFile
+	positions := make([]*data.LogRecordPos, 0, len(logRecords))
+	//the encoded logRecords waiting to be written into active file
+	var buf []byte
+	var lengths []int64
+	flush := func() error {
+		var err error
+		if db.cipher == nil {
+			positions, err = db.writeEncoded(buf, lengths, positions, logRecords)
+		} else {
+			//each logRecord is sealed alone, thus it can be read by its position
+			var offset int64
+			for i, length := range lengths {
+				if positions, err = db.writeEncoded(buf[offset:offset+length], lengths[i:i+1], positions, logRecords); err != nil {
+					break
+				}
+				offset += length
+			}
+		}
+		buf, lengths = buf[:0], lengths[:0]
+		return err
+	}
 
-		//Open a new activefile
-		if err := db.setActiveDataFile(); err != nil {
+	var pendingSize int64
+	for _, logRecord := range logRecords {
+		//Encode logRecord, get ready for writing
+		encLogRecord, length, err := db.encodeLogRecord(logRecord)
+		if err != nil {
 			return nil, err
 		}
+		//the size on disk, the encrypted logRecord is bigger
+		diskSize := length
+		if db.cipher != nil {
+			diskSize = db.cipher.SealedSize(length)
+		}
+
+		//Check if the data size bigger than activefile's limit
+		//the logRecord bigger than the limit is written into an empty file alone
+		fileSize := db.activeFile.WriteOff + pendingSize
+		if fileSize > 0 && fileSize+diskSize > db.options.DataFileSize {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			pendingSize = 0
+
+			//if so, in order to save the data to disk, we need to sync the datafile to disk
+			//先持久化数据文件，保证数据都持久化到磁盘中
+			if err := db.syncBlobFile(); err != nil {
+				return nil, err
+			}
+			if err := db.activeFile.Sync(); err != nil {
+				return nil, err
+			}
+			db.markSynced(db.activeFile.Fileid, db.activeFile.WriteOff)
+
+			//Transform the activefile to olderfile
+			db.olderFiles[db.activeFile.Fileid] = db.activeFile
+
+			//Open a new activefile
+			if err := db.setActiveDataFile(); err != nil {
+				return nil, err
+			}
+		}
+		buf = append(buf, encLogRecord...)
+		lengths = append(lengths, length)
+		pendingSize += diskSize
 	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return positions, nil
+}
 
+// write the encoded logRecords into active file, append their positions to positions,
+// the logRecords are the ones which positions will belong to
+func (db *DB) writeEncoded(buf []byte, lengths []int64, positions []*data.LogRecordPos,
+	logRecords []*data.LogRecord) ([]*data.LogRecordPos, error) {
+	if len(buf) == 0 {
+		return positions, nil
+	}
 	writeoff := db.activeFile.WriteOff
-	if err := db.activeFile.Write(encLogRecord); err != nil {
-		return nil, err
+	if err := db.activeFile.Write(buf); err != nil {
+		//a part of buf may be written, e.g. the disk is full, cut it off
+		_ = db.truncateActiveFile()
+		return positions, err
 	}
+	db.bytesWrite += uint(db.activeFile.WriteOff - writeoff)
 
-	db.bytesWrite += uint(length)
+	//Construct memory index information
+	//构造内存索引信息
+	if len(lengths) == 1 {
+		//the size on disk may be bigger than the encoded logRecord when it's encrypted
+		logRecord := logRecords[len(positions)]
+		pos := newLogRecordPos(db.activeFile.Fileid, writeoff, db.activeFile.WriteOff-writeoff, logRecord)
+		return append(positions, pos), nil
+	}
+	offset := writeoff
+	for _, length := range lengths {
+		logRecord := logRecords[len(positions)]
+		pos := newLogRecordPos(db.activeFile.Fileid, offset, length, logRecord)
+		positions = append(positions, pos)
+		offset += length
+	}
+	return positions, nil
+}
 
+// sync the active file when it's forced, or required by options
+// we must have mutex lock when we use this method
+func (db *DB) syncActiveFile(force bool) error {
 	//Do the sync() options depends on user's option
-	var needSync = db.options.SyncWrites
+	var needSync = force || db.options.SyncWrites
 	if !needSync && db.options.BytesPerSync > 0 && db.bytesWrite >= db.options.BytesPerSync {
 		needSync = true
 	}
 	if needSync {
+		if err := db.syncBlobFile(); err != nil {
+			return err
+		}
 		if err := db.activeFile.Sync(); err != nil {
-			return nil, err
+			return err
 		}
+		db.markSynced(db.activeFile.Fileid, db.activeFile.WriteOff)
 
 		//reset the bytesWrite
 		if db.bytesWrite > 0 {
 			db.bytesWrite = 0
 		}
 	}
-
-	//Construct memory index information
-	//构造内存索引信息
-	pos := &data.LogRecordPos{FileId: db.activeFile.Fileid, Offset: writeoff, Size: uint32(length)}
-	return pos, nil
-
+	return nil
 }
 
 // Set current active datafile
@@ -452,47 +927,87 @@ func (db *DB) setActiveDataFile() error {
 		//if there was an active datafile
 		//the new active datafile's FileId should plus 1
 		initialFileId = db.activeFile.Fileid + 1
+
+		if err := db.sealDataFile(db.activeFile); err != nil {
+			return err
+		}
 	}
-	dataFile, err := data.OpenDataFile(db.options.DirPath, initialFileId, fileio.StandardFIO)
+	dataFile, err := data.OpenDataFile(db.options.FileSystem, db.options.DirPath, initialFileId, db.activeIOType())
 	if err != nil {
 		return err
 	}
+	if db.options.PreallocateDataFile {
+		if err := dataFile.Preallocate(db.options.DataFileSize); err != nil {
+			_ = dataFile.Close()
+			return err
+		}
+	}
+	dataFile.Cipher = db.cipher
 	db.activeFile = dataFile
 	return nil
 }
 
-func (db *DB) loadDataFiles() error {
-	dirEntries, err := os.ReadDir(db.options.DirPath)
+// the data files written without encryption look like torn frames to the cipher,
+// the database would be opened as empty and the data overwritten, thus the first logRecord is checked
+func checkEncrypted(options Options, cipher *data.Cipher) error {
+	fileIds, err := getDataFileIds(options.FileSystem, options.DirPath)
 	if err != nil {
 		return err
 	}
-
-	var fileIds []int
-	for _, entry := range dirEntries {
-		//Get the file id
-		if strings.HasSuffix(entry.Name(), data.DataFileNameSuffix) {
-			splitFileName := strings.Split(entry.Name(), ".")
-			fileId, err := strconv.Atoi(splitFileName[0])
+	for _, fid := range fileIds {
+		dataFile, err := data.OpenDataFile(options.FileSystem, options.DirPath, uint32(fid), fileio.StandardFIO)
+		if err != nil {
+			return err
+		}
+		dataFile.Cipher = cipher
+		size, err := dataFile.IOManager.Size()
+		if err != nil || size == 0 {
+			_ = dataFile.Close()
 			if err != nil {
-				return ErrDataDirectoryCorrupted
+				return err
 			}
-			fileIds = append(fileIds, fileId)
+			continue
+		}
+		_, _, readErr := dataFile.ReadLogRecord(0)
+		plain := readErr != nil && dataFile.IsPlainLogRecord(0)
+		if err := dataFile.Close(); err != nil {
+			return err
 		}
+		if plain {
+			return ErrDataNotEncrypted
+		}
+		return nil
+	}
+	return nil
+}
+
+func (db *DB) loadDataFiles() error {
+	fileIds, err := getDataFileIds(db.options.FileSystem, db.options.DirPath)
+	if err != nil {
+		return err
 	}
-	//Sort the file id
-	sort.Ints(fileIds)
 	db.fileIds = fileIds
 
 	//Go through each file id and open the correspond data file
 	for i, fid := range fileIds {
+		//the older files are opened by the file cache when they're read
+		if db.fileCache != nil && i < len(fileIds)-1 {
+			dataFile := &data.Datafile{Fileid: uint32(fid), Cipher: db.cipher}
+			if err := db.fileCache.cacheDataFile(db.options.FileSystem, db.options.DirPath, dataFile); err != nil {
+				return err
+			}
+			db.olderFiles[uint32(fid)] = dataFile
+			continue
+		}
 		ioType := fileio.StandardFIO
 		if db.options.MMapAtStartup {
 			ioType = fileio.MemoryMap
 		}
-		dataFile, err := data.OpenDataFile(db.options.DirPath, uint32(fid), ioType)
+		dataFile, err := data.OpenDataFile(db.options.FileSystem, db.options.DirPath, uint32(fid), ioType)
 		if err != nil {
 			return err
 		}
+		dataFile.Cipher = db.cipher
 		//If it's the last one, means that the file id is biggest
 		//thus, the data file is active data file
 		if i == len(fileIds)-1 {
@@ -504,7 +1019,7 @@ func (db *DB) loadDataFiles() error {
 	return nil
 }
 
-func (db *DB) loadIndexFromDataFiles() error {
+func (db *DB) loadIndexFromDataFiles(checkpoint *checkpointState) error {
 	//The database is empty, no datafile
 	if len(db.fileIds) == 0 {
 		return nil
@@ -513,7 +1028,7 @@ func (db *DB) loadIndexFromDataFiles() error {
 	//check if the merge process happened
 	hasMerge, nonMergeFileId := false, uint32(0)
 	mergeFinishedFileName := filepath.Join(db.options.DirPath, data.MergeFinishedFileName)
-	if _, err := os.Stat(mergeFinishedFileName); err == nil {
+	if _, err := db.options.FileSystem.Stat(mergeFinishedFileName); err == nil {
 		//means that merge is finished
 		//thus we already get some index from hint file
 		fid, err := db.getNonMergeFileId(db.options.DirPath)
@@ -523,26 +1038,11 @@ func (db *DB) loadIndexFromDataFiles() error {
 		hasMerge = true
 		nonMergeFileId = fid
 	}
-	updateIndex := func(key []byte, typ data.LogRecordType, pos *data.LogRecordPos) {
-		//Check if the logRecord has been deleted
-		var oldPos *data.LogRecordPos
-		if typ == data.LogRecordDeleted {
-			oldPos, _ = db.index.Delete(key)
-			db.reclaimSize += int64(pos.Size)
-		} else { //Save the key---logRecordPos index to memory indexer
-			oldPos = db.index.Put(key, pos)
-		}
-		if oldPos != nil {
-			db.reclaimSize += int64(oldPos.Size)
-		}
-	}
-
-	//two dimension slice, one seqNo(uint64) map to a list of transactionRecords
-	var TransactionBuffer = make(map[uint64][]*data.TransactionRecord)
-	var currentSeqNo = nonTransactionSeqNo
-	//Go through fileIds and handle the logRecords in each file
+	//Go through fileIds and pick the files to load
 	//Go through each file:
-	for i, fid := range db.fileIds {
+	var loadFiles []*data.Datafile
+	var offsets []int64
+	for _, fid := range db.fileIds {
 		var fileid = uint32(fid)
 		//if we have merged, means that we already load those index
 		//which file id less than nonMergeFileId from hint file,
@@ -553,74 +1053,153 @@ func (db *DB) loadIndexFromDataFiles() error {
 		if hasMerge && fileid < nonMergeFileId {
 			continue
 		}
-		var dataFile *data.Datafile
+		//the logRecords before checkpoint have been loaded as well
+		var offset int64 = 0
+		if checkpoint != nil {
+			if fileid < checkpoint.fileId {
+				continue
+			}
+			if fileid == checkpoint.fileId {
+				offset = checkpoint.offset
+			}
+		}
 		if fileid == db.activeFile.Fileid {
-			dataFile = db.activeFile
+			loadFiles = append(loadFiles, db.activeFile)
 		} else {
-			dataFile = db.olderFiles[fileid]
+			loadFiles = append(loadFiles, db.olderFiles[fileid])
 		}
-		//Handle logRecords in each dataFile
-		var offset int64 = 0 //In each datafile, the offset stars from 0
-		for {
-			logRecord, size, err := dataFile.ReadLogRecord(offset)
-			//Check the type of err: when we hit the last record, it's correct to get an EOF err
-			if err != nil {
-				if err == io.EOF {
-					break //jump out of the loop
-				}
-				return err
+		//In each datafile, the offset stars from 0, except the one of checkpoint
+		offsets = append(offsets, offset)
+	}
+	if len(loadFiles) == 0 {
+		return nil
+	}
+
+	var offset int64
+	var err error
+	if db.options.IndexLoadConcurrency > 1 && len(loadFiles) > 1 {
+		offset, err = db.loadIndexConcurrently(loadFiles, offsets)
+	} else {
+		for i, dataFile := range loadFiles {
+			if offset, err = db.loadIndexFromDataFile(dataFile, offsets[i]); err != nil {
+				break
 			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+	//If we are in the active(last) file, we need to update the active file's WriteOff by using offset
+	//make sure that we can append the logRecord in a right position
+	if loadFiles[len(loadFiles)-1] == db.activeFile {
+		db.activeFile.WriteOff = offset
+	}
+	return nil
+}
 
-			//Construct and save the memory index
-			logRecordPos := &data.LogRecordPos{FileId: fileid, Offset: offset, Size: uint32(size)}
+// encode the logRecord, the value is compressed depends on user's option
+func (db *DB) encodeLogRecord(logRecord *data.LogRecord) ([]byte, int64, error) {
+	//copy the logRecord, the caller's value should not be changed
+	if db.options.Compression != NoCompression && len(logRecord.Value) > 0 {
+		compressed, err := data.Compress(db.options.Compression, logRecord.Value)
+		if err != nil {
+			return nil, 0, err
+		}
+		//keep the raw value if it can't be compressed smaller
+		if len(compressed) < len(logRecord.Value) {
+			compressedRecord := *logRecord
+			compressedRecord.Value = compressed
+			compressedRecord.Compression = db.options.Compression
+			logRecord = &compressedRecord
+		}
+	}
+	encLogRecord, length := data.EncodeLogRecord(logRecord)
+	return encLogRecord, length, nil
+}
 
-			//parse the key, get the real key and seqNo
-			realKey, seqNo := parselogRecordKey(logRecord.Key)
+// handle the logRecords in dataFile from offset, return the offset where the reading stops
+func (db *DB) loadIndexFromDataFile(dataFile *data.Datafile, offset int64) (int64, error) {
+	for {
+		logRecord, size, err := dataFile.ReadLogRecord(offset)
+		//Check the type of err: when we hit the last record, it's correct to get an EOF err
+		if err != nil {
+			if err == io.EOF {
+				break //jump out of the loop
+			}
+			return 0, err
+		}
 
-			if seqNo == nonTransactionSeqNo {
-				//non transaction action, update immediately
-				updateIndex(realKey, logRecord.Type, logRecordPos)
-			} else {
+		//Construct and save the memory index
+		logRecordPos := newLogRecordPos(dataFile.Fileid, offset, size, logRecord)
+		db.applyLogRecord(logRecord, logRecordPos)
 
-				//if this logRecord's type is TxnFinished,
-				//means the transaction finished,
-				//thus update the batch of data which belong to the seqNo into index
-				if logRecord.Type == data.LogRecordTxnFinished {
-					//use for loop to update one by one
-					for _, txnRecord := range TransactionBuffer[seqNo] {
-						updateIndex(txnRecord.Record.Key, txnRecord.Record.Type, txnRecord.Position)
-					}
-					//delete those batch of data belong to the seqNo
-					delete(TransactionBuffer, seqNo)
-				} else {
-					//if this logRecord's type is not TxnFinished,
-					//means that we don't know if this transaction is succeeded
-					//thus we need to put it in the TxnBuffer
-					logRecord.Key = realKey
-					TransactionBuffer[seqNo] = append(TransactionBuffer[seqNo], &data.TransactionRecord{
-						Record:   logRecord,
-						Position: logRecordPos,
-					})
-				}
+		//Update the offset , read in a new position next time
+		offset += size
+	}
+	return offset, nil
+}
 
+// update the index by a logRecord read from data file,
+// the logRecords of a transaction are held until its finished logRecord is read
+func (db *DB) applyLogRecord(logRecord *data.LogRecord, logRecordPos *data.LogRecordPos) {
+	//parse the key, get the real key and seqNo
+	realKey, seqNo := parselogRecordKey(logRecord.Key)
+
+	if seqNo == nonTransactionSeqNo {
+		//non transaction action, update immediately
+		db.updateIndex(realKey, logRecord, logRecordPos)
+	} else {
+
+		//if this logRecord's type is TxnFinished,
+		//means the transaction finished,
+		//thus update the batch of data which belong to the seqNo into index
+		if logRecord.Type == data.LogRecordTxnFinished {
+			//use for loop to update one by one
+			for _, txnRecord := range db.txnRecords[seqNo] {
+				db.updateIndex(txnRecord.Record.Key, txnRecord.Record, txnRecord.Position)
 			}
-			//update the transaction seqNo
-			if seqNo > currentSeqNo {
-				currentSeqNo = seqNo
-			}
-			//Update the offset , read in a new position next time
-			offset += size
-		}
-		//If we are in the active(last) file, we need to update the active file's WriteOff by using offset
-		//make sure that we can append the logRecord in a right position
-		if i == len(db.fileIds)-1 {
-			db.activeFile.WriteOff = offset
+			//delete those batch of data belong to the seqNo
+			delete(db.txnRecords, seqNo)
+		} else {
+			//if this logRecord's type is not TxnFinished,
+			//means that we don't know if this transaction is succeeded
+			//thus we need to put it in the TxnBuffer
+			logRecord.Key = realKey
+			db.txnRecords[seqNo] = append(db.txnRecords[seqNo], &data.TransactionRecord{
+				Record:   logRecord,
+				Position: logRecordPos,
+			})
 		}
 
 	}
 	//update the transaction seqNo
-	db.seqNo = currentSeqNo
-	return nil
+	if seqNo > db.seqNo {
+		db.seqNo = seqNo
+	}
+}
+
+// update the index by the logRecord loaded from data file
+func (db *DB) updateIndex(key []byte, logRecord *data.LogRecord, pos *data.LogRecordPos) {
+	//the namespace has been dropped, the logRecord is useless
+	idx := db.indexOf(logRecord.NamespaceId)
+	if idx == nil {
+		db.reclaimSize += int64(pos.Size)
+		return
+	}
+	//Check if the logRecord has been deleted
+	//an expired logRecord is handled as deleted, it shadows the older values as well
+	var oldPos *data.LogRecordPos
+	if logRecord.Type == data.LogRecordDeleted || isExpired(pos) {
+		oldPos, _ = idx.Delete(key)
+		db.reclaimSize += int64(pos.Size)
+	} else { //Save the key---logRecordPos index to memory indexer
+		oldPos = idx.Put(key, pos)
+		db.addLive(pos)
+	}
+	if oldPos != nil {
+		db.reclaimSize += int64(oldPos.Size)
+		db.removeLive(oldPos)
+	}
 }
 
 func CheckOptions(options Options) error {
@@ -636,18 +1215,93 @@ func CheckOptions(options Options) error {
 		return errors.New("invalid merge ratio, must between 0 and 1")
 	}
 
+	//bbolt saves the b plus tree index in a file of operating system
+	if options.IndexerType == BPTree && options.FileSystem != nil && options.FileSystem != fileio.OSFileSystem {
+		return errors.New("b plus tree index only works on the file system of operating system")
+	}
+
+	if options.MergeFileDeadRatio < 0 || options.MergeFileDeadRatio > 1 {
+		return errors.New("invalid merge file dead ratio, must between 0 and 1")
+	}
+
+	if options.Compression > Zstd {
+		return errors.New("unsupported compression type")
+	}
+
+	if len(options.OldEncryptionKeys) > 0 && len(options.EncryptionKey) == 0 {
+		return errors.New("old encryption keys are given without an encryption key")
+	}
+	//bbolt saves the keys in plaintext
+	if len(options.EncryptionKey) > 0 && options.IndexerType == BPTree {
+		return errors.New("b plus tree index saves the keys in plaintext, it doesn't support encryption")
+	}
+
+	//the B plus tree index is a file owned by the writer
+	if options.ReadOnly && options.IndexerType == BPTree {
+		return errors.New("read only mode doesn't support b plus tree index")
+	}
+
+	if options.AutoMergeInterval < 0 || options.AutoMergeMinReclaimBytes < 0 {
+		return errors.New("auto merge interval and min reclaim bytes can't be negative")
+	}
+	for _, window := range options.AutoMergeWindows {
+		if window.Start < 0 || window.Start > 24*time.Hour || window.End < 0 || window.End > 24*time.Hour {
+			return errors.New("invalid auto merge window, must between 0 and 24 hours")
+		}
+	}
+
+	if options.BloomFilterExpectedKeys > 0 {
+		if options.IndexerType != BPTree {
+			return errors.New("bloom filter only works with b plus tree index")
+		}
+		if options.BloomFilterFalsePositiveRate <= 0 || options.BloomFilterFalsePositiveRate >= 1 {
+			return errors.New("invalid bloom filter false positive rate, must between 0 and 1")
+		}
+	}
+
+	if options.ValueCacheSize < 0 {
+		return errors.New("value cache size can't be negative")
+	}
+
+	if options.MaxOpenFiles < 0 {
+		return errors.New("max open files can't be negative")
+	}
+
+	if options.BlobThreshold < 0 {
+		return errors.New("blob threshold can't be negative")
+	}
+	if options.BlobGCRatio < 0 || options.BlobGCRatio > 1 {
+		return errors.New("invalid blob gc ratio, must between 0 and 1")
+	}
+
+	if options.IndexLoadConcurrency < 0 {
+		return errors.New("index load concurrency can't be negative")
+	}
+
+	if options.SyncInterval < 0 {
+		return errors.New("sync interval can't be negative")
+	}
+
+	if options.IndexCheckpointInterval < 0 {
+		return errors.New("index checkpoint interval can't be negative")
+	}
+	if options.IndexCheckpointInterval > 0 && options.IndexerType == BPTree {
+		return errors.New("b plus tree index doesn't need checkpoint")
+	}
+
 	return nil
 }
 
 func (db *DB) loadSeqNo() error {
 	fileName := filepath.Join(db.options.DirPath, data.SeqNoFileName)
-	if _, err := os.Stat(fileName); os.IsNotExist(err) {
+	if _, err := db.options.FileSystem.Stat(fileName); os.IsNotExist(err) {
 		return nil
 	}
-	seqNofile, err := data.OpenSeqNoFile(db.options.DirPath)
+	seqNofile, err := data.OpenSeqNoFile(db.options.FileSystem, db.options.DirPath)
 	if err != nil {
 		return err
 	}
+	seqNofile.Cipher = db.cipher
 
 	record, _, err := seqNofile.ReadLogRecord(0)
 	seqNo, err := strconv.ParseUint(string(record.Value), 10, 64)
@@ -657,7 +1311,52 @@ func (db *DB) loadSeqNo() error {
 
 	db.seqNoFileExists = true
 	db.seqNo = seqNo
-	return os.Remove(fileName)
+	return db.options.FileSystem.Remove(fileName)
+}
+
+// cut off the bytes after the last valid logRecord of active file,
+// they are left by a crash in the middle of writing
+func (db *DB) truncateActiveFile() error {
+	if db.activeFile == nil {
+		return nil
+	}
+	size, err := db.activeFile.IOManager.Size()
+	if err != nil {
+		return err
+	}
+	if size <= db.activeFile.WriteOff {
+		return nil
+	}
+	return db.options.FileSystem.Truncate(data.GetFileName(db.options.DirPath, db.activeFile.Fileid), db.activeFile.WriteOff)
+}
+
+// the size of the space preallocated after the logRecords of active file
+// we must have mutex lock when we use this method
+func (db *DB) preallocatedSize() (int64, error) {
+	if db.activeFile == nil || db.activeIOType() == fileio.StandardFIO {
+		return 0, nil
+	}
+	info, err := db.options.FileSystem.Stat(data.GetFileName(db.options.DirPath, db.activeFile.Fileid))
+	if err != nil {
+		return 0, err
+	}
+	if info.Size() <= db.activeFile.WriteOff {
+		return 0, nil
+	}
+	return info.Size() - db.activeFile.WriteOff, nil
+}
+
+// the active file becomes older file, it's read by standard io, the preallocated tail is cut off,
+// the handle is managed by the file cache if MaxOpenFiles is set
+// we must have mutex lock when we use this method
+func (db *DB) sealDataFile(dataFile *data.Datafile) error {
+	if db.fileCache != nil {
+		return db.fileCache.cacheDataFile(db.options.FileSystem, db.options.DirPath, dataFile)
+	}
+	if db.activeIOType() != fileio.StandardFIO {
+		return dataFile.SetIOManager(db.options.FileSystem, db.options.DirPath, fileio.StandardFIO)
+	}
+	return nil
 }
 
 // set data file's ioType to standard file io
@@ -667,15 +1366,56 @@ func (db *DB) resetIOType() error {
 	}
 
 	//reset the current active data file
-	if err := db.activeFile.SetIOManager(db.options.DirPath, fileio.StandardFIO); err != nil {
+	if err := db.activeFile.SetIOManager(db.options.FileSystem, db.options.DirPath, db.activeIOType()); err != nil {
 		return err
 	}
 
-	//reset old data files
+	//reset old data files, the ones in file cache are opened by standard io already
+	if db.fileCache != nil {
+		return nil
+	}
 	for _, datafile := range db.olderFiles {
-		if err := datafile.SetIOManager(db.options.DirPath, fileio.StandardFIO); err != nil {
+		if err := datafile.SetIOManager(db.options.FileSystem, db.options.DirPath, fileio.StandardFIO); err != nil {
 			return err
 		}
 	}
 	return nil
 }
+
+// the ioType of active file
+func (db *DB) activeIOType() fileio.FileIOType {
+	if db.options.ReadOnly {
+		return fileio.StandardFIO
+	}
+	if db.options.MMapActiveFile {
+		return fileio.MemoryMapWrite
+	}
+	if db.options.PreallocateDataFile {
+		return fileio.PreallocatedFIO
+	}
+	return fileio.StandardFIO
+}
+
+// get the sorted ids of data files in directory
+func getDataFileIds(fs fileio.FileSystem, dirPath string) ([]int, error) {
+	dirEntries, err := fs.ReadDir(dirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var fileIds []int
+	for _, entry := range dirEntries {
+		//Get the file id
+		if strings.HasSuffix(entry.Name(), data.DataFileNameSuffix) {
+			splitFileName := strings.Split(entry.Name(), ".")
+			fileId, err := strconv.Atoi(splitFileName[0])
+			if err != nil {
+				return nil, ErrDataDirectoryCorrupted
+			}
+			fileIds = append(fileIds, fileId)
+		}
+	}
+	//Sort the file id
+	sort.Ints(fileIds)
+	return fileIds, nil
+}
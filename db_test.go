@@ -1,9 +1,12 @@
 package bitcaskGo
 
 import (
+	"bitcaskGo/data"
+	"bitcaskGo/fileio"
 	"bitcaskGo/utils"
 	"github.com/stretchr/testify/assert"
 	"os"
+	"strings"
 	"testing"
 	"time"
 )
@@ -13,15 +16,21 @@ func destroyDB(db *DB) {
 		if db.activeFile != nil {
 			_ = db.Close()
 		}
-		err := os.RemoveAll(db.options.DirPath)
+		err := db.options.FileSystem.RemoveAll(db.options.DirPath)
 		if err != nil {
 			panic(err)
 		}
+		//the directory made by os.MkdirTemp is left on disk when the files are in memory
+		_ = os.RemoveAll(db.options.DirPath)
 	}
 }
 
 func TestOpen(t *testing.T) {
-	opts := DefaultOptions
+	testOpen(t, DefaultOptions)
+}
+
+// the options are passed in, thus the test runs on other file systems as well
+func testOpen(t *testing.T, opts Options) {
 	dir, _ := os.MkdirTemp("", "bitcask-go")
 	opts.DirPath = dir
 	db, err := Open(opts)
@@ -31,7 +40,10 @@ func TestOpen(t *testing.T) {
 }
 
 func TestDB_Put(t *testing.T) {
-	opts := DefaultOptions
+	testDBPut(t, DefaultOptions)
+}
+
+func testDBPut(t *testing.T, opts Options) {
 	dir, _ := os.MkdirTemp("", "bitcask-go-put")
 	opts.DirPath = dir
 	opts.DataFileSize = 64 * 1024 * 1024
@@ -89,7 +101,10 @@ func TestDB_Put(t *testing.T) {
 }
 
 func TestDB_Get(t *testing.T) {
-	opts := DefaultOptions
+	testDBGet(t, DefaultOptions)
+}
+
+func testDBGet(t *testing.T, opts Options) {
 	dir, _ := os.MkdirTemp("", "bitcask-go-get")
 	opts.DirPath = dir
 	opts.DataFileSize = 64 * 1024 * 1024
@@ -159,7 +174,10 @@ func TestDB_Get(t *testing.T) {
 }
 
 func TestDB_Delete(t *testing.T) {
-	opts := DefaultOptions
+	testDBDelete(t, DefaultOptions)
+}
+
+func testDBDelete(t *testing.T, opts Options) {
 	dir, _ := os.MkdirTemp("", "bitcask-go-delete")
 	opts.DirPath = dir
 	opts.DataFileSize = 64 * 1024 * 1024
@@ -211,7 +229,10 @@ func TestDB_Delete(t *testing.T) {
 }
 
 func TestDB_Close(t *testing.T) {
-	opts := DefaultOptions
+	testDBClose(t, DefaultOptions)
+}
+
+func testDBClose(t *testing.T, opts Options) {
 	dir, _ := os.MkdirTemp("", "bitcask-go-close")
 	opts.DirPath = dir
 	db, err := Open(opts)
@@ -225,7 +246,10 @@ func TestDB_Close(t *testing.T) {
 }
 
 func TestDB_Sync(t *testing.T) {
-	opts := DefaultOptions
+	testDBSync(t, DefaultOptions)
+}
+
+func testDBSync(t *testing.T, opts Options) {
 	dir, _ := os.MkdirTemp("", "bitcask-go-sync")
 	opts.DirPath = dir
 	db, err := Open(opts)
@@ -242,7 +266,10 @@ func TestDB_Sync(t *testing.T) {
 }
 
 func TestDB_ListKeys(t *testing.T) {
-	opts := DefaultOptions
+	testDBListKeys(t, DefaultOptions)
+}
+
+func testDBListKeys(t *testing.T, opts Options) {
 	dir, _ := os.MkdirTemp("", "bitcask-go-listKeys")
 	opts.DirPath = dir
 	db, err := Open(opts)
@@ -280,7 +307,10 @@ func TestDB_ListKeys(t *testing.T) {
 }
 
 func TestDB_Fold(t *testing.T) {
-	opts := DefaultOptions
+	testDBFold(t, DefaultOptions)
+}
+
+func testDBFold(t *testing.T, opts Options) {
 	dir, _ := os.MkdirTemp("", "bitcask-go-fold")
 	opts.DirPath = dir
 	db, err := Open(opts)
@@ -313,7 +343,10 @@ func TestDB_Fold(t *testing.T) {
 }
 
 func TestDB_FileLock(t *testing.T) {
-	opts := DefaultOptions
+	testDBFileLock(t, DefaultOptions)
+}
+
+func testDBFileLock(t *testing.T, opts Options) {
 	dir, _ := os.MkdirTemp("", "bitcask-go-filelock")
 	opts.DirPath = dir
 	db, err := Open(opts)
@@ -337,7 +370,10 @@ func TestDB_FileLock(t *testing.T) {
 }
 
 func TestDB_OpenWithMMap(t *testing.T) {
-	opts := DefaultOptions
+	testDBOpenWithMMap(t, DefaultOptions)
+}
+
+func testDBOpenWithMMap(t *testing.T, opts Options) {
 	dir := "/tmp/bitcask-go"
 	opts.DirPath = dir
 	opts.MMapAtStartup = false
@@ -364,7 +400,10 @@ func TestDB_OpenWithMMap(t *testing.T) {
 }
 
 func TestDB_Stat(t *testing.T) {
-	opts := DefaultOptions
+	testDBStat(t, DefaultOptions)
+}
+
+func testDBStat(t *testing.T, opts Options) {
 	dir, _ := os.MkdirTemp("", "bitcask-go-stat")
 	opts.DirPath = dir
 	db, err := Open(opts)
@@ -393,7 +432,10 @@ func TestDB_Stat(t *testing.T) {
 }
 
 func TestDB_Backup(t *testing.T) {
-	opts := DefaultOptions
+	testDBBackup(t, DefaultOptions)
+}
+
+func testDBBackup(t *testing.T, opts Options) {
 	dir, _ := os.MkdirTemp("", "bitcask-go-backup")
 	opts.DirPath = dir
 	db, err := Open(opts)
@@ -409,7 +451,7 @@ func TestDB_Backup(t *testing.T) {
 	err = db.Backup(backupDir)
 	assert.Nil(t, err)
 
-	opts1 := DefaultOptions
+	opts1 := opts
 	opts1.DirPath = backupDir
 	db2, err := Open(opts1)
 	defer destroyDB(db2)
@@ -417,3 +459,231 @@ func TestDB_Backup(t *testing.T) {
 	assert.NotNil(t, db2)
 
 }
+
+func TestDB_Compression(t *testing.T) {
+	testDBCompression(t, DefaultOptions)
+}
+
+func testDBCompression(t *testing.T, opts Options) {
+	dir, _ := os.MkdirTemp("", "bitcask-go-compression")
+	opts.DirPath = dir
+	opts.DataFileMergeRatio = 0
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	value := []byte(strings.Repeat(`{"name":"bitcask","type":"json"}`, 64))
+	//written without compression
+	err = db.Put(utils.GetTestKey(1), value)
+	assert.Nil(t, err)
+	err = db.Close()
+	assert.Nil(t, err)
+
+	//the old files stay readable after the compression is turned on
+	opts.Compression = Zstd
+	db2, err := Open(opts)
+	assert.Nil(t, err)
+	val, err := db2.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, value, val)
+	sizeBefore := db2.activeFile.WriteOff
+	for i := 2; i < 100; i++ {
+		err = db2.Put(utils.GetTestKey(i), value)
+		assert.Nil(t, err)
+	}
+	//values are compressed in data file
+	assert.Less(t, db2.activeFile.WriteOff-sizeBefore, int64(len(value)*98/5))
+	err = db2.Close()
+	assert.Nil(t, err)
+
+	//switch to snappy, the zstd data is still readable, and merge recompress them
+	opts.Compression = Snappy
+	db3, err := Open(opts)
+	assert.Nil(t, err)
+	for i := 1; i < 100; i++ {
+		err = db3.Put(utils.GetTestKey(i), value)
+		assert.Nil(t, err)
+	}
+	err = db3.Merge()
+	assert.Nil(t, err)
+	err = db3.Close()
+	assert.Nil(t, err)
+
+	db4, err := Open(opts)
+	assert.Nil(t, err)
+	for i := 1; i < 100; i++ {
+		val, err := db4.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+		assert.Equal(t, value, val)
+	}
+	assert.Nil(t, db4.Close())
+}
+
+func TestDB_Encryption(t *testing.T) {
+	testDBEncryption(t, DefaultOptions)
+}
+
+func testDBEncryption(t *testing.T, opts Options) {
+	dir, _ := os.MkdirTemp("", "bitcask-go-encryption")
+	opts.DirPath = dir
+	opts.DataFileMergeRatio = 0
+	opts.EncryptionKey = []byte(strings.Repeat("k", 32))
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	value := []byte("plain-secret-value")
+	for i := 0; i < 100; i++ {
+		err = db.Put(utils.GetTestKey(i), value)
+		assert.Nil(t, err)
+	}
+	err = db.Delete(utils.GetTestKey(0))
+	assert.Nil(t, err)
+	err = db.Close()
+	assert.Nil(t, err)
+
+	//the plain value isn't in data file
+	content, err := fileio.ReadFile(opts.FileSystem, data.GetFileName(dir, 0))
+	assert.Nil(t, err)
+	assert.NotEmpty(t, content)
+	assert.False(t, strings.Contains(string(content), string(value)))
+
+	//open with a wrong key
+	wrongOpts := opts
+	wrongOpts.EncryptionKey = []byte(strings.Repeat("w", 32))
+	_, err = Open(wrongOpts)
+	assert.NotNil(t, err)
+
+	//invalid key length
+	wrongOpts.EncryptionKey = []byte("short")
+	_, err = Open(wrongOpts)
+	assert.NotNil(t, err)
+
+	//rotate the key, merge rewrites the files by the new key
+	opts.OldEncryptionKeys = [][]byte{opts.EncryptionKey}
+	opts.EncryptionKey = []byte(strings.Repeat("n", 16))
+	db2, err := Open(opts)
+	assert.Nil(t, err)
+	_, err = db2.Get(utils.GetTestKey(0))
+	assert.Equal(t, ErrKeyNotFound, err)
+	val, err := db2.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, value, val)
+	err = db2.Merge()
+	assert.Nil(t, err)
+	err = db2.Close()
+	assert.Nil(t, err)
+
+	//the old key isn't needed anymore
+	opts.OldEncryptionKeys = nil
+	db3, err := Open(opts)
+	assert.Nil(t, err)
+	for i := 1; i < 100; i++ {
+		val, err := db3.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+		assert.Equal(t, value, val)
+	}
+	assert.Nil(t, db3.Close())
+
+	//b plus tree index saves the keys in plaintext
+	bptreeOpts := opts
+	bptreeOpts.IndexerType = BPTree
+	_, err = Open(bptreeOpts)
+	assert.NotNil(t, err)
+}
+
+func TestDB_OpenPlainWithEncryptionKey(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-encryption-plain")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(24)))
+	}
+	assert.Nil(t, db.Close())
+
+	//the directory written without encryption isn't opened as empty
+	encryptedOpts := opts
+	encryptedOpts.EncryptionKey = []byte(strings.Repeat("k", 32))
+	_, err = Open(encryptedOpts)
+	assert.Equal(t, ErrDataNotEncrypted, err)
+
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, 100, len(db.ListKeys()))
+}
+
+func TestDB_OpenConcurrently(t *testing.T) {
+	testDBOpenConcurrently(t, DefaultOptions)
+}
+
+func testDBOpenConcurrently(t *testing.T, opts Options) {
+	dir, _ := os.MkdirTemp("", "bitcask-go-open-concurrently")
+	opts.DirPath = dir
+	opts.DataFileSize = 16 * 1024
+	opts.IndexLoadConcurrency = 1
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 1000; i++ {
+		err = db.Put(utils.GetTestKey(i%300), utils.RandomValue(64))
+		assert.Nil(t, err)
+		if i%7 == 0 {
+			err = db.Delete(utils.GetTestKey(i % 200))
+			assert.Nil(t, err)
+		}
+		//the transactions span the files
+		if i%100 == 0 {
+			wb, err := db.NewWriteBatch(DefaultWriteBatchOptions)
+			assert.Nil(t, err)
+			for j := 0; j < 50; j++ {
+				assert.Nil(t, wb.Put(utils.GetTestKey(1000+i+j), utils.RandomValue(64)))
+			}
+			assert.Nil(t, wb.Delete(utils.GetTestKey(i%300)))
+			assert.Nil(t, wb.Commit())
+		}
+	}
+	assert.Greater(t, len(db.olderFiles), 5)
+	err = db.Close()
+	assert.Nil(t, err)
+
+	//the result of loading concurrently is the same as one by one
+	load := func(concurrency int) (map[string][]byte, uint64, []*FileStat, int64) {
+		opts.IndexLoadConcurrency = concurrency
+		db, err := Open(opts)
+		assert.Nil(t, err)
+		defer func() {
+			_ = db.Close()
+		}()
+		values := make(map[string][]byte)
+		err = db.Fold(func(key []byte, value []byte) bool {
+			values[string(key)] = value
+			return true
+		})
+		assert.Nil(t, err)
+		stats, err := db.FileStats()
+		assert.Nil(t, err)
+		return values, db.seqNo, stats, db.activeFile.WriteOff
+	}
+	values, seqNo, stats, writeOff := load(1)
+	values2, seqNo2, stats2, writeOff2 := load(4)
+	assert.Equal(t, values, values2)
+	assert.Equal(t, seqNo, seqNo2)
+	assert.Equal(t, stats, stats2)
+	assert.Equal(t, writeOff, writeOff2)
+
+	//loading stops at the broken logRecord as well
+	fileName := data.GetFileName(dir, 3)
+	content, err := fileio.ReadFile(opts.FileSystem, fileName)
+	assert.Nil(t, err)
+	content[len(content)/2] ^= 0xff
+	err = fileio.WriteFile(opts.FileSystem, fileName, content)
+	assert.Nil(t, err)
+	_, err = Open(opts)
+	assert.NotNil(t, err)
+}
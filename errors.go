@@ -14,4 +14,22 @@ var (
 	ErrDataBaseisUsing          = errors.New("the database directory is used by another process")
 	ErrMergeRatioUnreached      = errors.New("the ratio of reclaimSize and totalSize do not reach the option ")
 	ErrNotEnoughSpaceForMerging = errors.New("there is not enough disk space for merging")
+	ErrInvalidTTL               = errors.New("the ttl must be greater than 0")
+	ErrValueMismatch            = errors.New("the current value does not match the expected value")
+	ErrKeyExists                = errors.New("the key already exists in database")
+	ErrSnapshotReleased         = errors.New("the snapshot has been released")
+	ErrTxnConflict              = errors.New("transaction conflict, the keys it read have been modified")
+	ErrTxnFinished              = errors.New("the transaction has been committed or rolled back")
+	ErrNamespaceNameIsEmpty     = errors.New("the namespace name is empty")
+	ErrNamespaceNotFound        = errors.New("can't find the namespace in database")
+	ErrNamespaceDropped         = errors.New("the namespace has been dropped")
+	ErrDatabaseReadOnly         = errors.New("the database is opened in read only mode")
+	ErrDataFilesReplaced        = errors.New("the data files have been replaced by merge, reopen the database")
+	ErrInvalidValueSize         = errors.New("the value size can't be negative")
+	ErrValueChunkMissing        = errors.New("the chunk of value is missing")
+	ErrBlobFileNotFound         = errors.New("blob file is not found")
+	ErrBlobCompactionIsRunning  = errors.New("blob compaction is in the process, try again later")
+	ErrBlobGCRatioUnreached     = errors.New("no blob file reaches the blob gc ratio")
+	ErrRepairWithBPTree         = errors.New("the data files indexed by b plus tree can't be repaired, the index would point to the moved logRecords")
+	ErrDataNotEncrypted         = errors.New("the data files aren't encrypted, they can't be opened with an encryption key")
 )
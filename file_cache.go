@@ -0,0 +1,199 @@
+package bitcaskGo
+
+import (
+	"bitcaskGo/data"
+	"bitcaskGo/fileio"
+	"container/list"
+	"os"
+	"sync"
+)
+
+// LRU cache of the handles of older data files, at most capacity of them are open,
+// the least recently used one is closed when the cache is full, and it's opened again when it's read
+type fileCache struct {
+	mu       *sync.Mutex
+	capacity int
+	lru      *list.List //the most recently used file is at front, only the open files are in it
+	reads    uint64
+	reopens  uint64
+}
+
+func newFileCache(capacity int) *fileCache {
+	return &fileCache{
+		mu:       new(sync.Mutex),
+		capacity: capacity,
+		lru:      list.New(),
+	}
+}
+
+// IOManager of a file in the cache, the file is opened when it's used
+type cachedFile struct {
+	cache *fileCache
+	fs    fileio.FileSystem
+	name  string
+
+	mu        *sync.RWMutex    //the readers hold the read lock, thus the file isn't closed when it's read
+	ioManager fileio.IOManager //nil means the file is closed by the cache
+	elem      *list.Element    //the element in lru, it's protected by the mutex of cache
+	closed    bool
+}
+
+// replace the IOManager of older file by the one managed by cache
+func (fc *fileCache) cacheDataFile(fs fileio.FileSystem, dirPath string, dataFile *data.Datafile) error {
+	if dataFile.IOManager != nil {
+		if err := dataFile.IOManager.Close(); err != nil {
+			return err
+		}
+	}
+	dataFile.IOManager = &cachedFile{
+		cache: fc,
+		fs:    fs,
+		name:  data.GetFileName(dirPath, dataFile.Fileid),
+		mu:    new(sync.RWMutex),
+	}
+	return nil
+}
+
+// number of the open files, and the share of the reads which open the file again
+func (fc *fileCache) stat() (int, float64) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if fc.reads == 0 {
+		return fc.lru.Len(), 0
+	}
+	return fc.lru.Len(), float64(fc.reopens) / float64(fc.reads)
+}
+
+// get the open IOManager, the read lock of file is held when it returns without error
+func (cf *cachedFile) acquire() (fileio.IOManager, error) {
+	for {
+		cf.mu.RLock()
+		if cf.closed {
+			cf.mu.RUnlock()
+			return nil, os.ErrClosed
+		}
+		if cf.ioManager != nil {
+			cf.cache.touch(cf, false)
+			return cf.ioManager, nil
+		}
+		cf.mu.RUnlock()
+
+		cf.mu.Lock()
+		if !cf.closed && cf.ioManager == nil {
+			ioManager, err := cf.fs.OpenFile(cf.name, fileio.StandardFIO)
+			if err != nil {
+				cf.mu.Unlock()
+				return nil, err
+			}
+			cf.ioManager = ioManager
+			cf.cache.touch(cf, true)
+		}
+		cf.mu.Unlock()
+		//close the files out of capacity, the lock of this file isn't held, thus two files won't wait for each other
+		cf.cache.evict()
+	}
+}
+
+// move the file to front of lru, we must have the lock of file when we use this method
+func (fc *fileCache) touch(cf *cachedFile, reopen bool) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.reads++
+	if reopen {
+		fc.reopens++
+	}
+	if cf.elem == nil {
+		cf.elem = fc.lru.PushFront(cf)
+	} else {
+		fc.lru.MoveToFront(cf.elem)
+	}
+}
+
+// close the least recently used files until the number of open files is within capacity
+func (fc *fileCache) evict() {
+	for {
+		fc.mu.Lock()
+		if fc.lru.Len() <= fc.capacity {
+			fc.mu.Unlock()
+			return
+		}
+		victim := fc.lru.Remove(fc.lru.Back()).(*cachedFile)
+		victim.elem = nil
+		fc.mu.Unlock()
+
+		//wait for the readers of victim, it may be used again in the meantime
+		victim.mu.Lock()
+		fc.mu.Lock()
+		if victim.elem == nil && victim.ioManager != nil {
+			_ = victim.ioManager.Close()
+			victim.ioManager = nil
+		}
+		fc.mu.Unlock()
+		victim.mu.Unlock()
+	}
+}
+
+func (cf *cachedFile) Read(b []byte, offset int64) (int, error) {
+	ioManager, err := cf.acquire()
+	if err != nil {
+		return 0, err
+	}
+	defer cf.mu.RUnlock()
+	return ioManager.Read(b, offset)
+}
+
+func (cf *cachedFile) Write(b []byte) (int, error) {
+	ioManager, err := cf.acquire()
+	if err != nil {
+		return 0, err
+	}
+	defer cf.mu.RUnlock()
+	return ioManager.Write(b)
+}
+
+func (cf *cachedFile) Sync() error {
+	ioManager, err := cf.acquire()
+	if err != nil {
+		return err
+	}
+	defer cf.mu.RUnlock()
+	return ioManager.Sync()
+}
+
+// Size the closed file isn't opened to get the size
+func (cf *cachedFile) Size() (int64, error) {
+	cf.mu.RLock()
+	defer cf.mu.RUnlock()
+	if cf.closed {
+		return 0, os.ErrClosed
+	}
+	if cf.ioManager != nil {
+		return cf.ioManager.Size()
+	}
+	info, err := cf.fs.Stat(cf.name)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func (cf *cachedFile) Close() error {
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+	if cf.closed {
+		return nil
+	}
+	cf.closed = true
+	cf.cache.mu.Lock()
+	if cf.elem != nil {
+		cf.cache.lru.Remove(cf.elem)
+		cf.elem = nil
+	}
+	cf.cache.mu.Unlock()
+	if cf.ioManager == nil {
+		return nil
+	}
+	err := cf.ioManager.Close()
+	cf.ioManager = nil
+	return err
+}
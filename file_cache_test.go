@@ -0,0 +1,86 @@
+package bitcaskGo
+
+import (
+	"bitcaskGo/utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestDB_MaxOpenFiles(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-max-open-files")
+	opts.DirPath = dir
+	opts.DataFileSize = 64 * 1024
+	opts.MaxOpenFiles = 2
+	opts.DataFileMergeRatio = 0
+	db, err := Open(opts)
+	assert.Nil(t, err)
+
+	values := make(map[int][]byte)
+	for i := 0; i < 2000; i++ {
+		values[i] = utils.RandomValue(128)
+		err = db.Put(utils.GetTestKey(i), values[i])
+		assert.Nil(t, err)
+	}
+	assert.True(t, len(db.olderFiles) > opts.MaxOpenFiles)
+
+	//the older files are opened again when they're read
+	for i := 0; i < 2000; i++ {
+		value, err := db.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+		assert.Equal(t, values[i], value)
+	}
+	stat := db.Stat()
+	assert.LessOrEqual(t, stat.OpenDataFileNum, uint(opts.MaxOpenFiles+1))
+	assert.True(t, stat.DataFileReopenRate > 0)
+
+	//the files are read concurrently
+	wg := new(sync.WaitGroup)
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := g; i < 2000; i += 8 {
+				value, err := db.Get(utils.GetTestKey(i))
+				assert.Nil(t, err)
+				assert.Equal(t, values[i], value)
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	//the older files aren't opened all together when loading
+	err = db.Close()
+	assert.Nil(t, err)
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	assert.LessOrEqual(t, db.Stat().OpenDataFileNum, uint(opts.MaxOpenFiles+1))
+	for i := 0; i < 2000; i += 2 {
+		err = db.Delete(utils.GetTestKey(i))
+		assert.Nil(t, err)
+	}
+	err = db.Merge()
+	assert.Nil(t, err)
+	err = db.Close()
+	assert.Nil(t, err)
+
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 2000; i++ {
+		value, err := db.Get(utils.GetTestKey(i))
+		if i%2 == 0 {
+			assert.Equal(t, ErrKeyNotFound, err)
+			continue
+		}
+		assert.Nil(t, err)
+		assert.Equal(t, values[i], value)
+	}
+	assert.LessOrEqual(t, db.Stat().OpenDataFileNum, uint(opts.MaxOpenFiles+1))
+	destroyDB(db)
+
+	opts.MaxOpenFiles = -1
+	_, err = Open(opts)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,87 @@
+package bitcaskGo
+
+import (
+	"bitcaskGo/data"
+	"sort"
+)
+
+// FileStat the garbage statistics of a data file
+type FileStat struct {
+	FileId    uint32
+	Size      int64 //size of the file on disk
+	LiveBytes int64 //size of the logRecords referenced by index
+	DeadBytes int64 //size of the overwritten, deleted and expired logRecords, they are reclaimed by merge
+}
+
+// DeadRatio the ratio of dead bytes in file
+func (fs *FileStat) DeadRatio() float32 {
+	if fs.Size == 0 {
+		return 0
+	}
+	return float32(fs.DeadBytes) / float32(fs.Size)
+}
+
+// FileStats return the garbage statistics of all data files, sorted by file id
+func (db *DB) FileStats() ([]*FileStat, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.fileStats(true)
+}
+
+// we must have mutex lock when we use this method
+func (db *DB) fileStats(withActive bool) ([]*FileStat, error) {
+	dataFiles := make([]*data.Datafile, 0, len(db.olderFiles)+1)
+	for _, dataFile := range db.olderFiles {
+		dataFiles = append(dataFiles, dataFile)
+	}
+	if withActive && db.activeFile != nil {
+		dataFiles = append(dataFiles, db.activeFile)
+	}
+
+	stats := make([]*FileStat, 0, len(dataFiles))
+	for _, dataFile := range dataFiles {
+		size, err := dataFile.IOManager.Size()
+		if err != nil {
+			return nil, err
+		}
+		liveBytes := db.liveBytes[dataFile.Fileid]
+		stats = append(stats, &FileStat{
+			FileId:    dataFile.Fileid,
+			Size:      size,
+			LiveBytes: liveBytes,
+			DeadBytes: size - liveBytes,
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].FileId < stats[j].FileId
+	})
+	return stats, nil
+}
+
+// the logRecord at pos is referenced by index
+func (db *DB) addLive(pos *data.LogRecordPos) {
+	db.liveBytes[pos.FileId] += int64(pos.Size)
+	if pos.BlobSize > 0 {
+		db.blobLiveBytes[pos.BlobFileId] += int64(pos.BlobSize)
+	}
+}
+
+// the logRecord at pos is not referenced by index anymore
+func (db *DB) removeLive(pos *data.LogRecordPos) {
+	db.liveBytes[pos.FileId] -= int64(pos.Size)
+	if pos.BlobSize > 0 {
+		db.blobLiveBytes[pos.BlobFileId] -= int64(pos.BlobSize)
+	}
+}
+
+// count the live bytes from the positions in the indexes,
+// used when the index isn't rebuilt from data files
+func (db *DB) loadLiveBytes() {
+	for _, idx := range db.indexes() {
+		iterator := idx.Iterator(false)
+		for iterator.Rewind(); iterator.Valid(); iterator.Next() {
+			db.addLive(iterator.Value())
+		}
+		iterator.Close()
+	}
+}
@@ -0,0 +1,81 @@
+package bitcaskGo
+
+import (
+	"bitcaskGo/fileio"
+	"bitcaskGo/utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDB_MemFileSystem(t *testing.T) {
+	//the tests of db_test.go pass on the in-memory file system
+	opts := DefaultOptions
+	opts.FileSystem = fileio.NewMemFileSystem()
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, opts Options)
+	}{
+		{"Open", testOpen},
+		{"Put", testDBPut},
+		{"Get", testDBGet},
+		{"Delete", testDBDelete},
+		{"Close", testDBClose},
+		{"Sync", testDBSync},
+		{"ListKeys", testDBListKeys},
+		{"Fold", testDBFold},
+		{"FileLock", testDBFileLock},
+		{"OpenWithMMap", testDBOpenWithMMap},
+		{"Stat", testDBStat},
+		{"Backup", testDBBackup},
+		{"Compression", testDBCompression},
+		{"Encryption", testDBEncryption},
+		{"OpenConcurrently", testDBOpenConcurrently},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, opts)
+		})
+	}
+}
+
+func TestDB_MemFileSystemOnly(t *testing.T) {
+	opts := DefaultOptions
+	opts.DirPath = filepath.Join(os.TempDir(), "bitcask-go-mem-fs")
+	opts.FileSystem = fileio.NewMemFileSystem()
+	opts.DataFileSize = 64 * 1024
+	opts.DataFileMergeRatio = 0
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 2000; i++ {
+		err = db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+		assert.Nil(t, err)
+	}
+	for i := 0; i < 1000; i++ {
+		err = db.Delete(utils.GetTestKey(i))
+		assert.Nil(t, err)
+	}
+	err = db.Merge()
+	assert.Nil(t, err)
+	err = db.Close()
+	assert.Nil(t, err)
+
+	//nothing is written to disk
+	_, err = os.Stat(opts.DirPath)
+	assert.True(t, os.IsNotExist(err))
+
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, 1000, len(db.ListKeys()))
+	size, err := fileio.DirSize(opts.FileSystem, opts.DirPath)
+	assert.Nil(t, err)
+	assert.Equal(t, size, db.Stat().DiskSize)
+
+	//the b plus tree index is saved by bbolt on disk
+	opts.IndexerType = BPTree
+	_, err = Open(opts)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,357 @@
+package fileio
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// FaultOp the operation which a fault is injected into
+type FaultOp = byte
+
+const (
+	FaultOpen FaultOp = iota
+	FaultRead
+	FaultWrite
+	FaultSync
+	FaultRename
+	FaultRemove
+)
+
+// Fault make the matched operations fail, until it's cleared
+type Fault struct {
+	Op      FaultOp
+	Pattern string //matched with the base name of file by filepath.Match, empty matches all files
+	Skip    int    //number of the matched operations which succeed before the fault happens
+	Err     error  //the error returned by the failed operations
+
+	//only for write, a part of the bytes is written before failing, e.g. the disk gets full in the middle
+	TornWrite bool
+}
+
+// FaultFileSystem wrap a file system, the bytes which aren't synced are lost when it crashes,
+// and the faults injected make the operations fail, it's used to test the recovery of database
+type FaultFileSystem struct {
+	FileSystem //the file system wrapped
+
+	mu      *sync.Mutex
+	rand    *rand.Rand
+	files   map[string]*faultFile //cleaned path ---> the state of the file opened
+	faults  []*Fault
+	hits    map[*Fault]int    //fault ---> number of the operations matched
+	handles []*FaultIOManager //the handles opened since the last crash
+	locks   map[*faultLock]bool
+}
+
+// NewFaultFileSystem wrap fs, the random decisions like the bytes left by a crash are made by seed
+func NewFaultFileSystem(fs FileSystem, seed int64) *FaultFileSystem {
+	return &FaultFileSystem{
+		FileSystem: fs,
+		mu:         new(sync.Mutex),
+		rand:       rand.New(rand.NewSource(seed)),
+		files:      make(map[string]*faultFile),
+		hits:       make(map[*Fault]int),
+		locks:      make(map[*faultLock]bool),
+	}
+}
+
+// the durability state of a file
+type faultFile struct {
+	name   string //the current path of the file
+	synced int64  //the bytes before it are durable
+}
+
+// Inject add a fault, it makes the matched operations fail after Skip of them succeed
+func (ffs *FaultFileSystem) Inject(fault *Fault) {
+	ffs.mu.Lock()
+	defer ffs.mu.Unlock()
+	ffs.faults = append(ffs.faults, fault)
+}
+
+// ClearFaults remove all the faults injected
+func (ffs *FaultFileSystem) ClearFaults() {
+	ffs.mu.Lock()
+	defer ffs.mu.Unlock()
+	ffs.faults = nil
+	ffs.hits = make(map[*Fault]int)
+}
+
+// check if the operation on the file fails, return the fault
+func (ffs *FaultFileSystem) fault(op FaultOp, name string) *Fault {
+	ffs.mu.Lock()
+	defer ffs.mu.Unlock()
+	for _, fault := range ffs.faults {
+		if fault.Op != op {
+			continue
+		}
+		if fault.Pattern != "" {
+			if matched, _ := filepath.Match(fault.Pattern, filepath.Base(name)); !matched {
+				continue
+			}
+		}
+		ffs.hits[fault]++
+		if ffs.hits[fault] > fault.Skip {
+			return fault
+		}
+	}
+	return nil
+}
+
+// DropUnsynced simulate a power loss, the bytes which aren't synced are lost,
+// the files opened and the locks taken become invalid
+func (ffs *FaultFileSystem) DropUnsynced() error {
+	return ffs.crash(func(int64) int64 {
+		return 0
+	})
+}
+
+// Crash simulate a power loss in the middle of writing, an arbitrary part of the bytes which aren't synced is left,
+// the files opened and the locks taken become invalid
+func (ffs *FaultFileSystem) Crash() error {
+	return ffs.crash(func(unsynced int64) int64 {
+		return ffs.rand.Int63n(unsynced + 1)
+	})
+}
+
+// keep returns how many of the unsynced bytes are left in the file
+func (ffs *FaultFileSystem) crash(keep func(unsynced int64) int64) error {
+	ffs.mu.Lock()
+	defer ffs.mu.Unlock()
+	for _, handle := range ffs.handles {
+		handle.crashed = true
+	}
+	ffs.handles = nil
+	for lock := range ffs.locks {
+		_ = lock.Locker.Unlock()
+	}
+	ffs.locks = make(map[*faultLock]bool)
+
+	for name, file := range ffs.files {
+		info, err := ffs.FileSystem.Stat(name)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		if info.Size() > file.synced {
+			if err := ffs.FileSystem.Truncate(name, file.synced+keep(info.Size()-file.synced)); err != nil {
+				return err
+			}
+		}
+	}
+	//the files left are durable now
+	ffs.files = make(map[string]*faultFile)
+	return nil
+}
+
+// FlipBit reverse a bit of the byte at offset in the file, the file shouldn't be opened
+func (ffs *FaultFileSystem) FlipBit(name string, offset int64, bit uint) error {
+	content, err := ReadFile(ffs.FileSystem, name)
+	if err != nil {
+		return err
+	}
+	if offset >= int64(len(content)) {
+		return os.ErrInvalid
+	}
+	content[offset] ^= 1 << (bit % 8)
+	return WriteFile(ffs.FileSystem, name, content)
+}
+
+func (ffs *FaultFileSystem) OpenFile(name string, ioType FileIOType) (IOManager, error) {
+	if fault := ffs.fault(FaultOpen, name); fault != nil {
+		return nil, fault.Err
+	}
+	ioManager, err := ffs.FileSystem.OpenFile(name, ioType)
+	if err != nil {
+		return nil, err
+	}
+	ffs.mu.Lock()
+	defer ffs.mu.Unlock()
+	name = filepath.Clean(name)
+	file, ok := ffs.files[name]
+	if !ok {
+		//the content before it's opened is durable
+		size, err := ioManager.Size()
+		if err != nil {
+			_ = ioManager.Close()
+			return nil, err
+		}
+		file = &faultFile{name: name, synced: size}
+		ffs.files[name] = file
+	}
+	handle := &FaultIOManager{IOManager: ioManager, ffs: ffs, file: file}
+	ffs.handles = append(ffs.handles, handle)
+	return handle, nil
+}
+
+// Rename the directory entries are durable at once, the unsynced bytes of file go with it
+func (ffs *FaultFileSystem) Rename(oldPath, newPath string) error {
+	if fault := ffs.fault(FaultRename, oldPath); fault != nil {
+		return fault.Err
+	}
+	if err := ffs.FileSystem.Rename(oldPath, newPath); err != nil {
+		return err
+	}
+	ffs.mu.Lock()
+	defer ffs.mu.Unlock()
+	oldPath, newPath = filepath.Clean(oldPath), filepath.Clean(newPath)
+	prefix := oldPath + string(filepath.Separator)
+	for name, file := range ffs.files {
+		if name == oldPath || strings.HasPrefix(name, prefix) {
+			delete(ffs.files, name)
+			file.name = filepath.Join(newPath, strings.TrimPrefix(name, oldPath))
+			ffs.files[file.name] = file
+		}
+	}
+	return nil
+}
+
+func (ffs *FaultFileSystem) Remove(name string) error {
+	if fault := ffs.fault(FaultRemove, name); fault != nil {
+		return fault.Err
+	}
+	if err := ffs.FileSystem.Remove(name); err != nil {
+		return err
+	}
+	ffs.mu.Lock()
+	defer ffs.mu.Unlock()
+	delete(ffs.files, filepath.Clean(name))
+	return nil
+}
+
+func (ffs *FaultFileSystem) RemoveAll(path string) error {
+	if fault := ffs.fault(FaultRemove, path); fault != nil {
+		return fault.Err
+	}
+	if err := ffs.FileSystem.RemoveAll(path); err != nil {
+		return err
+	}
+	ffs.mu.Lock()
+	defer ffs.mu.Unlock()
+	path = filepath.Clean(path)
+	prefix := path + string(filepath.Separator)
+	for name := range ffs.files {
+		if name == path || strings.HasPrefix(name, prefix) {
+			delete(ffs.files, name)
+		}
+	}
+	return nil
+}
+
+// Truncate the size of file is durable at once
+func (ffs *FaultFileSystem) Truncate(name string, size int64) error {
+	if err := ffs.FileSystem.Truncate(name, size); err != nil {
+		return err
+	}
+	ffs.mu.Lock()
+	defer ffs.mu.Unlock()
+	if file, ok := ffs.files[filepath.Clean(name)]; ok && file.synced > size {
+		file.synced = size
+	}
+	return nil
+}
+
+func (ffs *FaultFileSystem) Lock(name string) Locker {
+	return &faultLock{Locker: ffs.FileSystem.Lock(name), ffs: ffs}
+}
+
+// FaultIOManager wrap the IOManager of a file opened by FaultFileSystem
+type FaultIOManager struct {
+	IOManager //the IOManager wrapped
+
+	ffs     *FaultFileSystem
+	file    *faultFile
+	crashed bool //the handle is invalid after crash
+}
+
+func (fio *FaultIOManager) Read(b []byte, offset int64) (int, error) {
+	if fio.crashed {
+		return 0, os.ErrClosed
+	}
+	if fault := fio.ffs.fault(FaultRead, fio.file.name); fault != nil {
+		return 0, fault.Err
+	}
+	return fio.IOManager.Read(b, offset)
+}
+
+func (fio *FaultIOManager) Write(b []byte) (int, error) {
+	if fio.crashed {
+		return 0, os.ErrClosed
+	}
+	if fault := fio.ffs.fault(FaultWrite, fio.file.name); fault != nil {
+		if !fault.TornWrite || len(b) == 0 {
+			return 0, fault.Err
+		}
+		fio.ffs.mu.Lock()
+		n := fio.ffs.rand.Intn(len(b))
+		fio.ffs.mu.Unlock()
+		written, err := fio.IOManager.Write(b[:n])
+		if err != nil {
+			return written, err
+		}
+		return written, fault.Err
+	}
+	return fio.IOManager.Write(b)
+}
+
+func (fio *FaultIOManager) Sync() error {
+	if fio.crashed {
+		return os.ErrClosed
+	}
+	if fault := fio.ffs.fault(FaultSync, fio.file.name); fault != nil {
+		return fault.Err
+	}
+	if err := fio.IOManager.Sync(); err != nil {
+		return err
+	}
+	size, err := fio.IOManager.Size()
+	if err != nil {
+		return err
+	}
+	fio.ffs.mu.Lock()
+	defer fio.ffs.mu.Unlock()
+	if size > fio.file.synced {
+		fio.file.synced = size
+	}
+	return nil
+}
+
+func (fio *FaultIOManager) Close() error {
+	if fio.crashed {
+		return nil
+	}
+	return fio.IOManager.Close()
+}
+
+func (fio *FaultIOManager) Size() (int64, error) {
+	if fio.crashed {
+		return 0, os.ErrClosed
+	}
+	return fio.IOManager.Size()
+}
+
+// the lock released by crash
+type faultLock struct {
+	Locker
+	ffs *FaultFileSystem
+}
+
+func (l *faultLock) TryLock() (bool, error) {
+	hold, err := l.Locker.TryLock()
+	if hold {
+		l.ffs.mu.Lock()
+		l.ffs.locks[l] = true
+		l.ffs.mu.Unlock()
+	}
+	return hold, err
+}
+
+func (l *faultLock) Unlock() error {
+	l.ffs.mu.Lock()
+	delete(l.ffs.locks, l)
+	l.ffs.mu.Unlock()
+	return l.Locker.Unlock()
+}
@@ -0,0 +1,73 @@
+package fileio
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestFaultFileSystem_DropUnsynced(t *testing.T) {
+	ffs := NewFaultFileSystem(NewMemFileSystem(), 0)
+	assert.Nil(t, ffs.MkdirAll("/tmp/bitcask"))
+	fio, err := ffs.OpenFile("/tmp/bitcask/a.data", StandardFIO)
+	assert.Nil(t, err)
+	_, err = fio.Write([]byte("bitcask"))
+	assert.Nil(t, err)
+	assert.Nil(t, fio.Sync())
+	_, err = fio.Write([]byte("-go"))
+	assert.Nil(t, err)
+
+	//only the synced bytes are left, the handle is invalid
+	assert.Nil(t, ffs.DropUnsynced())
+	_, err = fio.Write([]byte("bitcask"))
+	assert.Equal(t, os.ErrClosed, err)
+	content, err := ReadFile(ffs, "/tmp/bitcask/a.data")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("bitcask"), content)
+
+	//a part of the unsynced bytes is left
+	fio, err = ffs.OpenFile("/tmp/bitcask/a.data", StandardFIO)
+	assert.Nil(t, err)
+	_, err = fio.Write([]byte("-go-go"))
+	assert.Nil(t, err)
+	assert.Nil(t, ffs.Crash())
+	content, err = ReadFile(ffs, "/tmp/bitcask/a.data")
+	assert.Nil(t, err)
+	assert.True(t, len(content) >= 7 && len(content) <= 13)
+	assert.Equal(t, []byte("bitcask-go-go")[:len(content)], content)
+}
+
+func TestFaultFileSystem_Inject(t *testing.T) {
+	ffs := NewFaultFileSystem(NewMemFileSystem(), 0)
+	assert.Nil(t, ffs.MkdirAll("/tmp/bitcask"))
+	ffs.Inject(&Fault{Op: FaultWrite, Pattern: "*.data", Skip: 1, Err: syscall.ENOSPC, TornWrite: true})
+	fio, err := ffs.OpenFile("/tmp/bitcask/a.data", StandardFIO)
+	assert.Nil(t, err)
+	_, err = fio.Write([]byte("bitcask"))
+	assert.Nil(t, err)
+	n, err := fio.Write([]byte("bitcask"))
+	assert.Equal(t, syscall.ENOSPC, err)
+	assert.Less(t, n, 7)
+
+	//the other files aren't matched
+	hint, err := ffs.OpenFile("/tmp/bitcask/hint-index", StandardFIO)
+	assert.Nil(t, err)
+	_, err = hint.Write([]byte("bitcask"))
+	assert.Nil(t, err)
+
+	ffs.ClearFaults()
+	_, err = fio.Write([]byte("bitcask"))
+	assert.Nil(t, err)
+}
+
+func TestFaultFileSystem_FlipBit(t *testing.T) {
+	ffs := NewFaultFileSystem(NewMemFileSystem(), 0)
+	assert.Nil(t, ffs.MkdirAll("/tmp/bitcask"))
+	assert.Nil(t, WriteFile(ffs, "/tmp/bitcask/a.data", []byte("bitcask")))
+	assert.Nil(t, ffs.FlipBit("/tmp/bitcask/a.data", 0, 5))
+	content, err := ReadFile(ffs, "/tmp/bitcask/a.data")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("Bitcask"), content)
+	assert.Equal(t, os.ErrInvalid, ffs.FlipBit("/tmp/bitcask/a.data", 7, 0))
+}
@@ -0,0 +1,216 @@
+package fileio
+
+import (
+	"github.com/gofrs/flock"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// FileSystem the file system which the files of database live in
+type FileSystem interface {
+	// OpenFile open the file by the io type, create it if it doesn't exist
+	OpenFile(name string, ioType FileIOType) (IOManager, error)
+	// Stat get the information of the file or directory
+	Stat(name string) (os.FileInfo, error)
+	// ReadDir get the entries of the directory, sorted by name
+	ReadDir(dirPath string) ([]os.DirEntry, error)
+	// MkdirAll create the directory and all its parents
+	MkdirAll(dirPath string) error
+	// Rename move the file or directory from oldPath to newPath
+	Rename(oldPath, newPath string) error
+	// Remove delete the file or the empty directory
+	Remove(name string) error
+	// RemoveAll delete the path and everything it contains
+	RemoveAll(path string) error
+	// Truncate change the size of the file
+	Truncate(name string, size int64) error
+	// Lock get the lock of the file, it excludes the other holders of the same file
+	Lock(name string) Locker
+	// AvailableSize get the free space of the file system that path is on, in bytes
+	AvailableSize(path string) (uint64, error)
+}
+
+// Locker the lock got from FileSystem
+type Locker interface {
+	// TryLock take the lock without blocking, return false if it's held by others
+	TryLock() (bool, error)
+	// Unlock release the lock
+	Unlock() error
+}
+
+// OSFileSystem the file system of operating system
+var OSFileSystem FileSystem = osFileSystem{}
+
+type osFileSystem struct{}
+
+func (osFileSystem) OpenFile(name string, ioType FileIOType) (IOManager, error) {
+	return NewIOManager(name, ioType)
+}
+
+func (osFileSystem) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (osFileSystem) ReadDir(dirPath string) ([]os.DirEntry, error) {
+	return os.ReadDir(dirPath)
+}
+
+func (osFileSystem) MkdirAll(dirPath string) error {
+	return os.MkdirAll(dirPath, os.ModePerm)
+}
+
+func (osFileSystem) Rename(oldPath, newPath string) error {
+	return os.Rename(oldPath, newPath)
+}
+
+func (osFileSystem) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (osFileSystem) RemoveAll(path string) error {
+	return os.RemoveAll(path)
+}
+
+func (osFileSystem) Truncate(name string, size int64) error {
+	return os.Truncate(name, size)
+}
+
+func (osFileSystem) Lock(name string) Locker {
+	return flock.New(name)
+}
+
+func (osFileSystem) AvailableSize(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	//Bavail : the available block at file system
+	//Bsize : the block size of file system in bytes
+	return stat.Bavail * uint64(stat.Bsize), nil
+}
+
+// ReadFile read the whole file
+func ReadFile(fs FileSystem, name string) ([]byte, error) {
+	//the file is created by OpenFile if it doesn't exist
+	if _, err := fs.Stat(name); err != nil {
+		return nil, err
+	}
+	ioManager, err := fs.OpenFile(name, StandardFIO)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = ioManager.Close()
+	}()
+	size, err := ioManager.Size()
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, size)
+	if size == 0 {
+		return b, nil
+	}
+	n, err := ioManager.Read(b, 0)
+	if n == len(b) {
+		return b, nil
+	}
+	return nil, err
+}
+
+// WriteFile replace the content of the file by b, the file is synced
+func WriteFile(fs FileSystem, name string, b []byte) error {
+	if err := fs.Remove(name); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	ioManager, err := fs.OpenFile(name, StandardFIO)
+	if err != nil {
+		return err
+	}
+	if _, err := ioManager.Write(b); err != nil {
+		_ = ioManager.Close()
+		return err
+	}
+	if err := ioManager.Sync(); err != nil {
+		_ = ioManager.Close()
+		return err
+	}
+	return ioManager.Close()
+}
+
+// DirSize get the size of the files in the directory, sub directories included
+func DirSize(fs FileSystem, dirPath string) (int64, error) {
+	entries, err := fs.ReadDir(dirPath)
+	if err != nil {
+		return 0, err
+	}
+	var size int64
+	for _, entry := range entries {
+		path := filepath.Join(dirPath, entry.Name())
+		if entry.IsDir() {
+			dirSize, err := DirSize(fs, path)
+			if err != nil {
+				return 0, err
+			}
+			size += dirSize
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return 0, err
+		}
+		size += info.Size()
+	}
+	return size, nil
+}
+
+// CopyDir copy the files in src directory into des directory, the names matched by exclude are skipped
+func CopyDir(fs FileSystem, src, des string, exclude []string) error {
+	if err := fs.MkdirAll(des); err != nil {
+		return err
+	}
+	entries, err := fs.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		//compare the file with all exclusive file name, if matched, jump out this file
+		var matched bool
+		for _, e := range exclude {
+			if matched, err = filepath.Match(e, entry.Name()); err != nil {
+				return err
+			}
+			if matched {
+				break
+			}
+		}
+		if matched {
+			continue
+		}
+
+		srcPath, desPath := filepath.Join(src, entry.Name()), filepath.Join(des, entry.Name())
+		if entry.IsDir() {
+			if err := CopyDir(fs, srcPath, desPath, exclude); err != nil {
+				return err
+			}
+			continue
+		}
+		b, err := ReadFile(fs, srcPath)
+		if err != nil {
+			return err
+		}
+		if err := WriteFile(fs, desPath, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SameFile report whether the two file infos got from the same file system describe the same file
+func SameFile(fi1, fi2 os.FileInfo) bool {
+	if mf1, ok := fi1.Sys().(*memFile); ok {
+		mf2, ok := fi2.Sys().(*memFile)
+		return ok && mf1 == mf2
+	}
+	return os.SameFile(fi1, fi2)
+}
@@ -10,6 +10,12 @@ const (
 
 	// MemoryMap  memory file map
 	MemoryMap
+
+	// MemoryMapWrite memory file map which supports appending
+	MemoryMapWrite
+
+	// PreallocatedFIO standard file io whose space is reserved in advance
+	PreallocatedFIO
 )
 
 type IOManager interface {
@@ -36,6 +42,10 @@ func NewIOManager(fileName string, ioType FileIOType) (IOManager, error) {
 		return NewFileIOManager(fileName)
 	case MemoryMap:
 		return NewMMapIOManager(fileName)
+	case MemoryMapWrite:
+		return NewWritableMMapIOManager(fileName)
+	case PreallocatedFIO:
+		return NewPreallocatedFileIOManager(fileName)
 	default:
 		panic("unsupported io type")
 	}
@@ -0,0 +1,352 @@
+package fileio
+
+import (
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// MemFileSystem the file system keeping the files in memory, the files are lost when it's dropped,
+// thus the database can be tested without touching the disk
+type MemFileSystem struct {
+	mu    *sync.Mutex
+	files map[string]*memFile //cleaned path ---> file
+	dirs  map[string]bool     //cleaned path of the directories
+	locks map[string]bool     //the locks which are held
+}
+
+// NewMemFileSystem create an empty in-memory file system, only the root directory exists
+func NewMemFileSystem() *MemFileSystem {
+	return &MemFileSystem{
+		mu:    new(sync.Mutex),
+		files: make(map[string]*memFile),
+		dirs:  map[string]bool{string(filepath.Separator): true, ".": true},
+		locks: make(map[string]bool),
+	}
+}
+
+// the content of a file, it's shared by the handles of the file
+type memFile struct {
+	mu      *sync.RWMutex
+	data    []byte
+	modTime time.Time
+}
+
+func (mfs *MemFileSystem) OpenFile(name string, ioType FileIOType) (IOManager, error) {
+	mfs.mu.Lock()
+	defer mfs.mu.Unlock()
+	name = filepath.Clean(name)
+	if mfs.dirs[name] {
+		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+	}
+	file, ok := mfs.files[name]
+	if !ok {
+		if !mfs.dirs[filepath.Dir(name)] {
+			return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+		}
+		file = &memFile{mu: new(sync.RWMutex), modTime: time.Now()}
+		mfs.files[name] = file
+	}
+	//the content is in memory already, the memory map reads and writes it as standard io does
+	return &memIOManager{file: file}, nil
+}
+
+func (mfs *MemFileSystem) Stat(name string) (os.FileInfo, error) {
+	mfs.mu.Lock()
+	defer mfs.mu.Unlock()
+	return mfs.stat(filepath.Clean(name))
+}
+
+// we must have mutex lock when we use this method
+func (mfs *MemFileSystem) stat(name string) (*memFileInfo, error) {
+	if mfs.dirs[name] {
+		return &memFileInfo{name: filepath.Base(name), isDir: true}, nil
+	}
+	file, ok := mfs.files[name]
+	if !ok {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+	}
+	file.mu.RLock()
+	defer file.mu.RUnlock()
+	return &memFileInfo{name: filepath.Base(name), size: int64(len(file.data)), modTime: file.modTime, file: file}, nil
+}
+
+func (mfs *MemFileSystem) ReadDir(dirPath string) ([]os.DirEntry, error) {
+	mfs.mu.Lock()
+	defer mfs.mu.Unlock()
+	dirPath = filepath.Clean(dirPath)
+	if !mfs.dirs[dirPath] {
+		return nil, &os.PathError{Op: "readdir", Path: dirPath, Err: os.ErrNotExist}
+	}
+	var entries []os.DirEntry
+	for _, path := range mfs.children(dirPath) {
+		info, err := mfs.stat(path)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, info)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+// get the paths of the files and directories directly in dirPath
+// we must have mutex lock when we use this method
+func (mfs *MemFileSystem) children(dirPath string) []string {
+	var paths []string
+	for path := range mfs.files {
+		if filepath.Dir(path) == dirPath {
+			paths = append(paths, path)
+		}
+	}
+	for path := range mfs.dirs {
+		if path != dirPath && filepath.Dir(path) == dirPath {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+func (mfs *MemFileSystem) MkdirAll(dirPath string) error {
+	mfs.mu.Lock()
+	defer mfs.mu.Unlock()
+	for path := filepath.Clean(dirPath); !mfs.dirs[path]; path = filepath.Dir(path) {
+		if _, ok := mfs.files[path]; ok {
+			return &os.PathError{Op: "mkdir", Path: path, Err: syscall.ENOTDIR}
+		}
+		mfs.dirs[path] = true
+	}
+	return nil
+}
+
+func (mfs *MemFileSystem) Rename(oldPath, newPath string) error {
+	mfs.mu.Lock()
+	defer mfs.mu.Unlock()
+	oldPath, newPath = filepath.Clean(oldPath), filepath.Clean(newPath)
+	if !mfs.dirs[filepath.Dir(newPath)] {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: os.ErrNotExist}
+	}
+	if file, ok := mfs.files[oldPath]; ok {
+		if mfs.dirs[newPath] {
+			return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: syscall.EISDIR}
+		}
+		delete(mfs.files, oldPath)
+		mfs.files[newPath] = file
+		return nil
+	}
+	if !mfs.dirs[oldPath] {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: os.ErrNotExist}
+	}
+	if _, ok := mfs.files[newPath]; ok || mfs.dirs[newPath] {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: os.ErrExist}
+	}
+	//move everything in the directory
+	prefix := oldPath + string(filepath.Separator)
+	for path, file := range mfs.files {
+		if strings.HasPrefix(path, prefix) {
+			delete(mfs.files, path)
+			mfs.files[filepath.Join(newPath, strings.TrimPrefix(path, prefix))] = file
+		}
+	}
+	for path := range mfs.dirs {
+		if path == oldPath || strings.HasPrefix(path, prefix) {
+			delete(mfs.dirs, path)
+			mfs.dirs[filepath.Join(newPath, strings.TrimPrefix(path, oldPath))] = true
+		}
+	}
+	return nil
+}
+
+func (mfs *MemFileSystem) Remove(name string) error {
+	mfs.mu.Lock()
+	defer mfs.mu.Unlock()
+	name = filepath.Clean(name)
+	if _, ok := mfs.files[name]; ok {
+		delete(mfs.files, name)
+		return nil
+	}
+	if !mfs.dirs[name] {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+	}
+	if len(mfs.children(name)) > 0 {
+		return &os.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+	}
+	delete(mfs.dirs, name)
+	return nil
+}
+
+func (mfs *MemFileSystem) RemoveAll(path string) error {
+	mfs.mu.Lock()
+	defer mfs.mu.Unlock()
+	path = filepath.Clean(path)
+	prefix := path + string(filepath.Separator)
+	for name := range mfs.files {
+		if name == path || strings.HasPrefix(name, prefix) {
+			delete(mfs.files, name)
+		}
+	}
+	for name := range mfs.dirs {
+		if name == path || strings.HasPrefix(name, prefix) {
+			delete(mfs.dirs, name)
+		}
+	}
+	return nil
+}
+
+func (mfs *MemFileSystem) Truncate(name string, size int64) error {
+	mfs.mu.Lock()
+	defer mfs.mu.Unlock()
+	name = filepath.Clean(name)
+	file, ok := mfs.files[name]
+	if !ok {
+		return &os.PathError{Op: "truncate", Path: name, Err: os.ErrNotExist}
+	}
+	if size < 0 {
+		return &os.PathError{Op: "truncate", Path: name, Err: syscall.EINVAL}
+	}
+	file.mu.Lock()
+	defer file.mu.Unlock()
+	if size <= int64(len(file.data)) {
+		file.data = file.data[:size]
+	} else {
+		file.data = append(file.data, make([]byte, size-int64(len(file.data)))...)
+	}
+	file.modTime = time.Now()
+	return nil
+}
+
+func (mfs *MemFileSystem) Lock(name string) Locker {
+	return &memLock{mfs: mfs, name: filepath.Clean(name)}
+}
+
+// AvailableSize the memory isn't limited by the file system
+func (mfs *MemFileSystem) AvailableSize(string) (uint64, error) {
+	return math.MaxInt64, nil
+}
+
+// the handle of a file in memory
+type memIOManager struct {
+	file   *memFile
+	closed bool
+}
+
+func (mio *memIOManager) Read(b []byte, offset int64) (int, error) {
+	if mio.closed {
+		return 0, os.ErrClosed
+	}
+	mio.file.mu.RLock()
+	defer mio.file.mu.RUnlock()
+	if offset >= int64(len(mio.file.data)) {
+		return 0, io.EOF
+	}
+	n := copy(b, mio.file.data[offset:])
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (mio *memIOManager) Write(b []byte) (int, error) {
+	if mio.closed {
+		return 0, os.ErrClosed
+	}
+	mio.file.mu.Lock()
+	defer mio.file.mu.Unlock()
+	mio.file.data = append(mio.file.data, b...)
+	mio.file.modTime = time.Now()
+	return len(b), nil
+}
+
+func (mio *memIOManager) Sync() error {
+	if mio.closed {
+		return os.ErrClosed
+	}
+	return nil
+}
+
+func (mio *memIOManager) Close() error {
+	if mio.closed {
+		return os.ErrClosed
+	}
+	mio.closed = true
+	return nil
+}
+
+func (mio *memIOManager) Size() (int64, error) {
+	if mio.closed {
+		return 0, os.ErrClosed
+	}
+	mio.file.mu.RLock()
+	defer mio.file.mu.RUnlock()
+	return int64(len(mio.file.data)), nil
+}
+
+// the information of a file or directory in memory, it's the directory entry as well
+type memFileInfo struct {
+	name    string
+	size    int64
+	isDir   bool
+	modTime time.Time
+	file    *memFile //nil for directory
+}
+
+func (fi *memFileInfo) Name() string { return fi.name }
+
+func (fi *memFileInfo) Size() int64 { return fi.size }
+
+func (fi *memFileInfo) Mode() os.FileMode {
+	if fi.isDir {
+		return os.ModeDir | os.ModePerm
+	}
+	return DataFilePerm
+}
+
+func (fi *memFileInfo) ModTime() time.Time { return fi.modTime }
+
+func (fi *memFileInfo) IsDir() bool { return fi.isDir }
+
+// Sys the file is used to find out whether two infos describe the same file
+func (fi *memFileInfo) Sys() any { return fi.file }
+
+func (fi *memFileInfo) Type() os.FileMode { return fi.Mode().Type() }
+
+func (fi *memFileInfo) Info() (os.FileInfo, error) { return fi, nil }
+
+// the lock of a file in memory file system
+type memLock struct {
+	mfs  *MemFileSystem
+	name string
+	held bool
+}
+
+func (l *memLock) TryLock() (bool, error) {
+	l.mfs.mu.Lock()
+	defer l.mfs.mu.Unlock()
+	if l.held {
+		return true, nil
+	}
+	if l.mfs.locks[l.name] {
+		return false, nil
+	}
+	l.mfs.locks[l.name] = true
+	l.held = true
+	return true, nil
+}
+
+func (l *memLock) Unlock() error {
+	l.mfs.mu.Lock()
+	defer l.mfs.mu.Unlock()
+	if l.held {
+		delete(l.mfs.locks, l.name)
+		l.held = false
+	}
+	return nil
+}
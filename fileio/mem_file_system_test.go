@@ -0,0 +1,102 @@
+package fileio
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestMemFileSystem_OpenFile(t *testing.T) {
+	mfs := NewMemFileSystem()
+	_, err := mfs.OpenFile("/tmp/bitcask/a.data", StandardFIO)
+	assert.True(t, os.IsNotExist(err))
+
+	assert.Nil(t, mfs.MkdirAll("/tmp/bitcask"))
+	fio, err := mfs.OpenFile("/tmp/bitcask/a.data", StandardFIO)
+	assert.Nil(t, err)
+	n, err := fio.Write([]byte("bitcask"))
+	assert.Nil(t, err)
+	assert.Equal(t, 7, n)
+	assert.Nil(t, fio.Sync())
+
+	//the handles of the same file share the content
+	mmapIO, err := mfs.OpenFile("/tmp/bitcask/a.data", MemoryMap)
+	assert.Nil(t, err)
+	size, err := mmapIO.Size()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(7), size)
+	b := make([]byte, 4)
+	n, err = mmapIO.Read(b, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("cask"), b)
+	n, err = mmapIO.Read(b, 5)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, 2, n)
+
+	assert.Nil(t, fio.Close())
+	_, err = fio.Write([]byte("bitcask"))
+	assert.Equal(t, os.ErrClosed, err)
+}
+
+func TestMemFileSystem_Dir(t *testing.T) {
+	mfs := NewMemFileSystem()
+	assert.Nil(t, mfs.MkdirAll("/tmp/bitcask/sub"))
+	assert.Nil(t, WriteFile(mfs, "/tmp/bitcask/b.data", []byte("bb")))
+	assert.Nil(t, WriteFile(mfs, "/tmp/bitcask/sub/a.data", []byte("aaa")))
+
+	entries, err := mfs.ReadDir("/tmp/bitcask")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, "b.data", entries[0].Name())
+	assert.True(t, entries[1].IsDir())
+	size, err := DirSize(mfs, "/tmp/bitcask")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), size)
+
+	//the file is the same after rename
+	info, err := mfs.Stat("/tmp/bitcask/b.data")
+	assert.Nil(t, err)
+	assert.Nil(t, mfs.Rename("/tmp/bitcask/b.data", "/tmp/bitcask/sub/b.data"))
+	_, err = mfs.Stat("/tmp/bitcask/b.data")
+	assert.True(t, os.IsNotExist(err))
+	newInfo, err := mfs.Stat("/tmp/bitcask/sub/b.data")
+	assert.Nil(t, err)
+	assert.True(t, SameFile(info, newInfo))
+
+	assert.Nil(t, CopyDir(mfs, "/tmp/bitcask", "/tmp/bitcask-copy", []string{"a.data"}))
+	content, err := ReadFile(mfs, "/tmp/bitcask-copy/sub/b.data")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("bb"), content)
+	_, err = mfs.Stat("/tmp/bitcask-copy/sub/a.data")
+	assert.True(t, os.IsNotExist(err))
+
+	assert.Nil(t, mfs.Truncate("/tmp/bitcask/sub/a.data", 1))
+	content, err = ReadFile(mfs, "/tmp/bitcask/sub/a.data")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("a"), content)
+
+	assert.NotNil(t, mfs.Remove("/tmp/bitcask/sub"))
+	assert.Nil(t, mfs.RemoveAll("/tmp/bitcask"))
+	_, err = mfs.Stat("/tmp/bitcask/sub/a.data")
+	assert.True(t, os.IsNotExist(err))
+	_, err = mfs.ReadDir("/tmp/bitcask")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestMemFileSystem_Lock(t *testing.T) {
+	mfs := NewMemFileSystem()
+	lock := mfs.Lock("/tmp/bitcask/flock")
+	hold, err := lock.TryLock()
+	assert.Nil(t, err)
+	assert.True(t, hold)
+
+	hold, err = mfs.Lock("/tmp/bitcask/flock").TryLock()
+	assert.Nil(t, err)
+	assert.False(t, hold)
+
+	assert.Nil(t, lock.Unlock())
+	hold, err = mfs.Lock("/tmp/bitcask/flock").TryLock()
+	assert.Nil(t, err)
+	assert.True(t, hold)
+}
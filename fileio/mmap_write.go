@@ -0,0 +1,140 @@
+package fileio
+
+import (
+	"golang.org/x/sys/unix"
+	"io"
+	"os"
+)
+
+// the file is grown by this size when the memory map is full
+const mmapGrowSize = 4 * 1024 * 1024
+
+// WritableMMap memory file map which supports appending,
+// the file is pre-grown in chunks and mapped again, the preallocated tail is cut off when it's closed
+type WritableMMap struct {
+	fd   *os.File
+	data []byte //the mapped region, it covers the whole file
+	size int64  //the logical end of file, the bytes after it are preallocated
+}
+
+// NewWritableMMapIOManager initiate a writable mmap io manager
+func NewWritableMMapIOManager(fileName string) (*WritableMMap, error) {
+	fd, err := os.OpenFile(fileName, os.O_CREATE|os.O_RDWR, DataFilePerm)
+	if err != nil {
+		return nil, err
+	}
+	info, err := fd.Stat()
+	if err != nil {
+		_ = fd.Close()
+		return nil, err
+	}
+	//the bytes in file are all written before, the tail left by a crash is cut off by the caller
+	mmap := &WritableMMap{fd: fd, size: info.Size()}
+	if err := mmap.remap(info.Size()); err != nil {
+		_ = fd.Close()
+		return nil, err
+	}
+	return mmap, nil
+}
+
+// map the file again with the new size
+func (mmap *WritableMMap) remap(fileSize int64) error {
+	if mmap.data != nil {
+		if err := unix.Munmap(mmap.data); err != nil {
+			return err
+		}
+		mmap.data = nil
+	}
+	//the empty file can't be mapped
+	if fileSize == 0 {
+		return nil
+	}
+	data, err := unix.Mmap(int(mmap.fd.Fd()), 0, int(fileSize), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		return err
+	}
+	mmap.data = data
+	return nil
+}
+
+func (mmap *WritableMMap) Preallocate(size int64) error {
+	if mmap.fd == nil {
+		return os.ErrClosed
+	}
+	if size <= int64(len(mmap.data)) {
+		return nil
+	}
+	if err := fallocate(mmap.fd, size); err != nil {
+		return err
+	}
+	return mmap.remap(size)
+}
+
+func (mmap *WritableMMap) Read(b []byte, offset int64) (int, error) {
+	if mmap.fd == nil {
+		return 0, os.ErrClosed
+	}
+	if offset >= mmap.size {
+		return 0, io.EOF
+	}
+	n := copy(b, mmap.data[offset:mmap.size])
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (mmap *WritableMMap) Write(b []byte) (int, error) {
+	if mmap.fd == nil {
+		return 0, os.ErrClosed
+	}
+	//grow the file in chunks, thus it isn't mapped again for every write
+	if end := mmap.size + int64(len(b)); end > int64(len(mmap.data)) {
+		fileSize := (end + mmapGrowSize - 1) / mmapGrowSize * mmapGrowSize
+		if err := fallocate(mmap.fd, fileSize); err != nil {
+			return 0, err
+		}
+		if err := mmap.remap(fileSize); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(mmap.data[mmap.size:], b)
+	mmap.size += int64(n)
+	return n, nil
+}
+
+func (mmap *WritableMMap) Sync() error {
+	if mmap.fd == nil {
+		return os.ErrClosed
+	}
+	if mmap.size > 0 {
+		if err := unix.Msync(mmap.data[:mmap.size], unix.MS_SYNC); err != nil {
+			return err
+		}
+	}
+	//the size of file may be changed by growing
+	return mmap.fd.Sync()
+}
+
+func (mmap *WritableMMap) Close() error {
+	if mmap.fd == nil {
+		return os.ErrClosed
+	}
+	if err := mmap.remap(0); err != nil {
+		return err
+	}
+	//cut off the preallocated tail
+	if err := mmap.fd.Truncate(mmap.size); err != nil {
+		return err
+	}
+	err := mmap.fd.Close()
+	mmap.fd = nil
+	return err
+}
+
+func (mmap *WritableMMap) Size() (int64, error) {
+	if mmap.fd == nil {
+		return 0, os.ErrClosed
+	}
+	return mmap.size, nil
+}
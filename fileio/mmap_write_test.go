@@ -0,0 +1,71 @@
+package fileio
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWritableMMap_Write(t *testing.T) {
+	path := filepath.Join("/tmp", "mmap-write-a.data")
+	defer deleteTestFile(path)
+
+	mmapIO, err := NewWritableMMapIOManager(path)
+	assert.Nil(t, err)
+	n, err := mmapIO.Write([]byte("bitcask"))
+	assert.Nil(t, err)
+	assert.Equal(t, 7, n)
+	size, err := mmapIO.Size()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(7), size)
+
+	//the file is pre-grown in chunks
+	info, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(mmapGrowSize), info.Size())
+
+	//write across the chunk, the file is mapped again
+	big := make([]byte, mmapGrowSize)
+	big[len(big)-1] = 'k'
+	_, err = mmapIO.Write(big)
+	assert.Nil(t, err)
+	assert.Nil(t, mmapIO.Sync())
+	info, err = os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2*mmapGrowSize), info.Size())
+
+	b := make([]byte, 7)
+	_, err = mmapIO.Read(b, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("bitcask"), b)
+	n, err = mmapIO.Read(b, mmapGrowSize+4)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, byte('k'), b[2])
+
+	//the preallocated tail is cut off
+	assert.Nil(t, mmapIO.Close())
+	info, err = os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(mmapGrowSize+7), info.Size())
+	_, err = mmapIO.Write([]byte("bitcask"))
+	assert.Equal(t, os.ErrClosed, err)
+
+	//the content is appended after reopen
+	mmapIO, err = NewWritableMMapIOManager(path)
+	assert.Nil(t, err)
+	_, err = mmapIO.Write([]byte("-go"))
+	assert.Nil(t, err)
+	assert.Nil(t, mmapIO.Close())
+	fio, err := NewFileIOManager(path)
+	assert.Nil(t, err)
+	defer fio.Close()
+	size, err = fio.Size()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(mmapGrowSize+10), size)
+	_, err = fio.Read(b[:3], size-3)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("-go"), b[:3])
+}
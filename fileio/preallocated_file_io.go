@@ -0,0 +1,98 @@
+package fileio
+
+import (
+	"errors"
+	"golang.org/x/sys/unix"
+	"io"
+	"os"
+)
+
+// Preallocator the IOManager whose space can be reserved in advance
+type Preallocator interface {
+	// Preallocate grow the file to size with zeros, Size still returns the logical end
+	Preallocate(size int64) error
+}
+
+// PreallocatedFileIO standard file io whose space is reserved in advance,
+// it writes at the logical end, the preallocated tail is cut off when it's closed
+type PreallocatedFileIO struct {
+	fd   *os.File
+	size int64 //the logical end of file, the bytes after it are preallocated
+}
+
+// NewPreallocatedFileIOManager create a preallocated file io
+func NewPreallocatedFileIOManager(fileName string) (*PreallocatedFileIO, error) {
+	fd, err := os.OpenFile(fileName, os.O_CREATE|os.O_RDWR, DataFilePerm)
+	if err != nil {
+		return nil, err
+	}
+	info, err := fd.Stat()
+	if err != nil {
+		_ = fd.Close()
+		return nil, err
+	}
+	//the bytes in file are all written before, the tail left by a crash is cut off by the caller
+	return &PreallocatedFileIO{fd: fd, size: info.Size()}, nil
+}
+
+func (pio *PreallocatedFileIO) Preallocate(size int64) error {
+	return fallocate(pio.fd, size)
+}
+
+// grow the file to size, and reserve the space, thus the writes won't fail because the disk is full
+func fallocate(fd *os.File, size int64) error {
+	info, err := fd.Stat()
+	if err != nil {
+		return err
+	}
+	if size <= info.Size() {
+		return nil
+	}
+	err = unix.Fallocate(int(fd.Fd()), 0, info.Size(), size-info.Size())
+	//the file system doesn't support it, the file is grown without reserving the space
+	if errors.Is(err, unix.EOPNOTSUPP) {
+		return fd.Truncate(size)
+	}
+	return err
+}
+
+func (pio *PreallocatedFileIO) Read(b []byte, offset int64) (int, error) {
+	if offset >= pio.size {
+		return 0, io.EOF
+	}
+	if offset+int64(len(b)) > pio.size {
+		n, err := pio.fd.ReadAt(b[:pio.size-offset], offset)
+		if err == nil {
+			err = io.EOF
+		}
+		return n, err
+	}
+	return pio.fd.ReadAt(b, offset)
+}
+
+func (pio *PreallocatedFileIO) Write(b []byte) (int, error) {
+	n, err := pio.fd.WriteAt(b, pio.size)
+	if err != nil {
+		//the part written is overwritten next time
+		return n, err
+	}
+	pio.size += int64(n)
+	return n, nil
+}
+
+func (pio *PreallocatedFileIO) Sync() error {
+	return pio.fd.Sync()
+}
+
+func (pio *PreallocatedFileIO) Close() error {
+	//cut off the preallocated tail
+	if err := pio.fd.Truncate(pio.size); err != nil {
+		_ = pio.fd.Close()
+		return err
+	}
+	return pio.fd.Close()
+}
+
+func (pio *PreallocatedFileIO) Size() (int64, error) {
+	return pio.size, nil
+}
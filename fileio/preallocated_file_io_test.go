@@ -0,0 +1,41 @@
+package fileio
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPreallocatedFileIO_Write(t *testing.T) {
+	path := filepath.Join("/tmp", "preallocated-a.data")
+	defer deleteTestFile(path)
+
+	pio, err := NewPreallocatedFileIOManager(path)
+	assert.Nil(t, err)
+	assert.Nil(t, pio.Preallocate(4096))
+	info, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4096), info.Size())
+
+	//the bytes are written at the logical end
+	_, err = pio.Write([]byte("bitcask"))
+	assert.Nil(t, err)
+	_, err = pio.Write([]byte("-go"))
+	assert.Nil(t, err)
+	size, err := pio.Size()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), size)
+	b := make([]byte, 8)
+	n, err := pio.Read(b, 4)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, 6, n)
+	assert.Equal(t, []byte("ask-go"), b[:n])
+
+	//the preallocated tail is cut off
+	assert.Nil(t, pio.Close())
+	info, err = os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), info.Size())
+}
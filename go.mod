@@ -4,12 +4,15 @@ go 1.20
 
 require (
 	github.com/gofrs/flock v0.8.1
+	github.com/golang/snappy v0.0.4
 	github.com/google/btree v1.1.2
+	github.com/klauspost/compress v1.16.7
 	github.com/plar/go-adaptive-radix-tree v1.0.5
 	github.com/stretchr/testify v1.8.4
 	github.com/tidwall/redcon v1.6.2
 	go.etcd.io/bbolt v1.3.7
 	golang.org/x/exp v0.0.0-20230728194245-b0cb94b80691
+	golang.org/x/sys v0.4.0
 )
 
 require (
@@ -17,6 +20,5 @@ require (
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/tidwall/btree v1.1.0 // indirect
 	github.com/tidwall/match v1.1.1 // indirect
-	golang.org/x/sys v0.4.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
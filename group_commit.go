@@ -0,0 +1,110 @@
+package bitcaskGo
+
+import "bitcaskGo/data"
+
+// the max number of requests written in a group
+const maxCommitGroupSize = 256
+
+// a write waiting in the commit queue
+type commitRequest struct {
+	//called under lock right before writing, check the conditions and return the logRecords to write
+	prepare func() ([]*data.LogRecord, error)
+	//called under lock after the logRecords are written and synced, update the index by their positions
+	apply func(positions []*data.LogRecordPos) error
+	//the logRecords must be synced before the request returns, besides the SyncWrites option
+	sync bool
+	//prepare reads the database, thus the request can't be grouped behind others,
+	//their index updates haven't been applied when it's prepared
+	reading bool
+
+	err  error
+	done chan struct{} //closed when the request is written by another leader
+	lead chan struct{} //the request becomes the leader of the next group
+}
+
+// write the request by group commit, the concurrent requests are written by one append and one sync,
+// the request at the front of queue is the leader, it writes the requests behind it as a group,
+// then hands over to the next request in queue, each request returns after its logRecords are durable
+func (db *DB) commit(req *commitRequest) error {
+	req.done = make(chan struct{})
+	req.lead = make(chan struct{}, 1)
+
+	db.commitMu.Lock()
+	db.commitQueue = append(db.commitQueue, req)
+	isLeader := len(db.commitQueue) == 1
+	db.commitMu.Unlock()
+	if !isLeader {
+		select {
+		case <-req.done:
+			return req.err
+		case <-req.lead:
+		}
+	}
+
+	//take the requests behind the leader until a reading one
+	db.commitMu.Lock()
+	group := []*commitRequest{req}
+	for _, r := range db.commitQueue[1:] {
+		if r.reading || len(group) >= maxCommitGroupSize {
+			break
+		}
+		group = append(group, r)
+	}
+	db.commitMu.Unlock()
+
+	db.writeGroup(group)
+
+	db.commitMu.Lock()
+	db.commitQueue = db.commitQueue[len(group):]
+	if len(db.commitQueue) > 0 {
+		db.commitQueue[0].lead <- struct{}{}
+	}
+	db.commitMu.Unlock()
+	for _, r := range group[1:] {
+		close(r.done)
+	}
+	return req.err
+}
+
+// write the logRecords of the group at once, sync them if any request needs,
+// then apply them to index in order, the result is saved in each request
+func (db *DB) writeGroup(group []*commitRequest) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var logRecords []*data.LogRecord
+	var needSync bool
+	ranges := make([][2]int, len(group))
+	for i, req := range group {
+		records, err := req.prepare()
+		if err != nil {
+			req.err = err
+			continue
+		}
+		ranges[i] = [2]int{len(logRecords), len(logRecords) + len(records)}
+		logRecords = append(logRecords, records...)
+		needSync = needSync || req.sync
+	}
+	if len(logRecords) == 0 {
+		return
+	}
+
+	positions, err := db.appendLogRecords(logRecords)
+	if err == nil {
+		err = db.syncActiveFile(needSync)
+	}
+	for i, req := range group {
+		if req.err != nil {
+			continue
+		}
+		if err != nil {
+			req.err = err
+			continue
+		}
+		//nothing is written, e.g. delete a key which doesn't exist
+		if ranges[i][0] == ranges[i][1] {
+			continue
+		}
+		req.err = req.apply(positions[ranges[i][0]:ranges[i][1]])
+	}
+}
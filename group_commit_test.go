@@ -0,0 +1,109 @@
+package bitcaskGo
+
+import (
+	"bitcaskGo/utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDB_GroupCommit(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-group-commit")
+	opts.DirPath = dir
+	opts.DataFileSize = 64 * 1024
+	opts.SyncWrites = true
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	wg := new(sync.WaitGroup)
+	for g := 0; g < 8; g++ {
+		wg.Add(2)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				assert.Nil(t, db.Put(utils.GetTestKey(g*1000+i), utils.GetTestKey(i)))
+			}
+		}(g)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				wb, err := db.NewWriteBatch(DefaultWriteBatchOptions)
+				assert.Nil(t, err)
+				for j := 0; j < 10; j++ {
+					assert.Nil(t, wb.Put(utils.GetTestKey(100000+g*1000+i*10+j), utils.GetTestKey(j)))
+				}
+				assert.Nil(t, wb.Commit())
+			}
+		}(g)
+	}
+	wg.Wait()
+	assert.Equal(t, 1600, len(db.ListKeys()))
+
+	err = db.Close()
+	assert.Nil(t, err)
+	db2, err := Open(opts)
+	assert.Nil(t, err)
+	defer func() {
+		_ = db2.Close()
+	}()
+	assert.Equal(t, 1600, len(db2.ListKeys()))
+	for g := 0; g < 8; g++ {
+		for i := 0; i < 100; i++ {
+			val, err := db2.Get(utils.GetTestKey(g*1000 + i))
+			assert.Nil(t, err)
+			assert.Equal(t, utils.GetTestKey(i), val)
+		}
+	}
+}
+
+func TestDB_GroupCommitOrder(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-group-commit-order")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	waitQueue := func(n int) {
+		for {
+			db.commitMu.Lock()
+			size := len(db.commitQueue)
+			db.commitMu.Unlock()
+			if size == n {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	//the leader is blocked, the requests behind it are queued
+	db.mu.Lock()
+	wg := new(sync.WaitGroup)
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		assert.Nil(t, db.Put([]byte("key"), []byte("v1")))
+	}()
+	waitQueue(1)
+	go func() {
+		defer wg.Done()
+		assert.Nil(t, db.Put([]byte("key"), []byte("v2")))
+	}()
+	waitQueue(2)
+	//the value written by the request ahead of it must be seen
+	go func() {
+		defer wg.Done()
+		assert.Nil(t, db.CompareAndSwap([]byte("key"), []byte("v2"), []byte("v3")))
+	}()
+	waitQueue(3)
+	db.mu.Unlock()
+	wg.Wait()
+
+	val, err := db.Get([]byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v3"), val)
+}
@@ -62,10 +62,20 @@ func (art *AdaptiveRadixTree) Size() int {
 }
 
 // Close unnecessary method
+// ApplyBatch put and delete the keys one by one
+func (art *AdaptiveRadixTree) ApplyBatch(items []*BatchItem) []*data.LogRecordPos {
+	return applyEach(art, items)
+}
+
 func (art *AdaptiveRadixTree) Close() error {
 	return nil
 }
 
+// Clone copy the art into a btree index, because art doesn't support lazy copy
+func (art *AdaptiveRadixTree) Clone() Indexer {
+	return CopyToBtree(art.Iterator(false))
+}
+
 func (art *AdaptiveRadixTree) Iterator(reverse bool) Iterator {
 	art.lock.RLock()
 	defer art.lock.RUnlock()
@@ -141,3 +141,17 @@ func TestAdaptiveRadixTree_Iterator(t *testing.T) {
 		assert.NotNil(t, iterator.Value())
 	}
 }
+
+func TestAdaptiveRadixTree_Clone(t *testing.T) {
+	art := NewART()
+	art.Put([]byte("a"), &data.LogRecordPos{FileId: 1, Offset: 10})
+	art.Put([]byte("b"), &data.LogRecordPos{FileId: 1, Offset: 20})
+
+	clone := art.Clone()
+	art.Put([]byte("a"), &data.LogRecordPos{FileId: 2, Offset: 30})
+	art.Delete([]byte("b"))
+
+	assert.Equal(t, 2, clone.Size())
+	assert.Equal(t, int64(10), clone.Get([]byte("a")).Offset)
+	assert.Equal(t, int64(20), clone.Get([]byte("b")).Offset)
+}
@@ -0,0 +1,107 @@
+package index
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"math"
+)
+
+var ErrInvalidBloomFilter = errors.New("invalid bloom filter data")
+
+// the header of encoded bloom filter: m, k, number of set bits
+const bloomHeaderSize = 8 + 4 + 8
+
+// bloom filter tells a key is absent for sure, or it may exist
+type bloomFilter struct {
+	bits    []uint64
+	m       uint64 //number of bits
+	k       uint32 //number of hash functions
+	setBits uint64 //number of bits which are 1
+}
+
+// create a bloom filter which holds n keys with the false positive rate p
+func newBloomFilter(n uint, p float64) *bloomFilter {
+	if n == 0 {
+		n = 1
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	//round up to whole words
+	m = (m + 63) / 64 * 64
+	k := uint32(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &bloomFilter{bits: make([]uint64, m/64), m: m, k: k}
+}
+
+// two hash values, the k positions are h1 + i*h2
+func bloomHash(key []byte) (uint64, uint64) {
+	hash := fnv.New64a()
+	_, _ = hash.Write(key)
+	h1 := hash.Sum64()
+	//mix h1 by splitmix64 to get the second hash
+	h2 := h1 + 0x9e3779b97f4a7c15
+	h2 = (h2 ^ (h2 >> 30)) * 0xbf58476d1ce4e5b9
+	h2 = (h2 ^ (h2 >> 27)) * 0x94d049bb133111eb
+	h2 ^= h2 >> 31
+	return h1, h2 | 1
+}
+
+func (bf *bloomFilter) add(key []byte) {
+	h1, h2 := bloomHash(key)
+	for i := uint64(0); i < uint64(bf.k); i++ {
+		bit := (h1 + i*h2) % bf.m
+		mask := uint64(1) << (bit % 64)
+		if bf.bits[bit/64]&mask == 0 {
+			bf.bits[bit/64] |= mask
+			bf.setBits++
+		}
+	}
+}
+
+func (bf *bloomFilter) mayContain(key []byte) bool {
+	h1, h2 := bloomHash(key)
+	for i := uint64(0); i < uint64(bf.k); i++ {
+		bit := (h1 + i*h2) % bf.m
+		if bf.bits[bit/64]&(uint64(1)<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// size of the bits in bytes
+func (bf *bloomFilter) size() int64 {
+	return int64(len(bf.bits) * 8)
+}
+
+func (bf *bloomFilter) encode() []byte {
+	buf := make([]byte, bloomHeaderSize+len(bf.bits)*8)
+	binary.LittleEndian.PutUint64(buf[0:], bf.m)
+	binary.LittleEndian.PutUint32(buf[8:], bf.k)
+	binary.LittleEndian.PutUint64(buf[12:], bf.setBits)
+	for i, word := range bf.bits {
+		binary.LittleEndian.PutUint64(buf[bloomHeaderSize+i*8:], word)
+	}
+	return buf
+}
+
+func decodeBloomFilter(buf []byte) (*bloomFilter, error) {
+	if len(buf) < bloomHeaderSize {
+		return nil, ErrInvalidBloomFilter
+	}
+	bf := &bloomFilter{
+		m:       binary.LittleEndian.Uint64(buf[0:]),
+		k:       binary.LittleEndian.Uint32(buf[8:]),
+		setBits: binary.LittleEndian.Uint64(buf[12:]),
+	}
+	if bf.m == 0 || bf.m%64 != 0 || bf.k == 0 || uint64(len(buf)-bloomHeaderSize) != bf.m/8 {
+		return nil, ErrInvalidBloomFilter
+	}
+	bf.bits = make([]uint64, bf.m/64)
+	for i := range bf.bits {
+		bf.bits[i] = binary.LittleEndian.Uint64(buf[bloomHeaderSize+i*8:])
+	}
+	return bf, nil
+}
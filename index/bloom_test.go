@@ -0,0 +1,30 @@
+package index
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestBloomFilter(t *testing.T) {
+	bf := newBloomFilter(10000, 0.01)
+	for i := 0; i < 10000; i++ {
+		bf.add([]byte(fmt.Sprintf("key-%d", i)))
+	}
+	for i := 0; i < 10000; i++ {
+		assert.True(t, bf.mayContain([]byte(fmt.Sprintf("key-%d", i))))
+	}
+	var falsePositives int
+	for i := 0; i < 10000; i++ {
+		if bf.mayContain([]byte(fmt.Sprintf("absent-%d", i))) {
+			falsePositives++
+		}
+	}
+	assert.Less(t, falsePositives, 200)
+
+	bf2, err := decodeBloomFilter(bf.encode())
+	assert.Nil(t, err)
+	assert.Equal(t, bf, bf2)
+	_, err = decodeBloomFilter(bf.encode()[:100])
+	assert.Equal(t, ErrInvalidBloomFilter, err)
+}
@@ -2,18 +2,46 @@ package index
 
 import (
 	"bitcaskGo/data"
+	"encoding/binary"
 	"go.etcd.io/bbolt"
 	"path/filepath"
+	"sync"
+	"sync/atomic"
 )
 
-const bptreeIndexFileName = "bptree-index"
+// BPTreeIndexFileName the bbolt file which saves the B plus tree index
+const BPTreeIndexFileName = "bptree-index"
 
 var indexBucketName = []byte("bitcask-index")
 
+// the bloom filter is saved in this bucket when the index is closed
+var (
+	bloomBucketName = []byte("bitcask-bloom")
+	bloomFilterKey  = []byte("filter")
+	//the id of the bbolt transaction which saved the filter,
+	//the filter is stale if any transaction is committed after it
+	bloomTxIdKey = []byte("txid")
+)
+
 // BPlusTree BPlus tree index
 // wrap the "go.etcd.io/bbolt" package
 type BPlusTree struct {
 	tree *bbolt.DB
+
+	bloomMu        *sync.RWMutex
+	bloom          *bloomFilter //nil means the bloom filter is disabled
+	nextBloom      *bloomFilter //the bloom filter being rebuilt, the new keys are added into it as well
+	expectedKeys   uint
+	falsePositive  float64
+	negatives      uint64 //number of lookups answered by bloom filter
+	falsePositives uint64 //number of lookups passed by bloom filter, but the key is absent
+}
+
+// BloomFilterStat the statistics of bloom filter
+type BloomFilterStat struct {
+	Size           int64  //memory used by the bits
+	Negatives      uint64 //lookups of absent keys answered by the filter
+	FalsePositives uint64 //lookups of absent keys which the filter fails to answer
 }
 
 // NewBPlusTree initiate BPlus tree index
@@ -21,38 +49,158 @@ func NewBPlusTree(dirPath string, syncWrites bool) *BPlusTree {
 	opts := bbolt.DefaultOptions
 	opts.NoSync = !syncWrites
 	//save the index information into disk
-	bptree, err := bbolt.Open(filepath.Join(dirPath, bptreeIndexFileName), 0644, opts)
+	bptree, err := bbolt.Open(filepath.Join(dirPath, BPTreeIndexFileName), 0644, opts)
 	if err != nil {
 		panic("failed to open bptree")
 	}
 
-	if err = bptree.Update(func(tx *bbolt.Tx) error {
-		_, err = tx.CreateBucketIfNotExists(indexBucketName)
+	//only create the bucket when it doesn't exist, an empty write transaction would make the saved bloom filter stale
+	var exists bool
+	_ = bptree.View(func(tx *bbolt.Tx) error {
+		exists = tx.Bucket(indexBucketName) != nil
+		return nil
+	})
+	if !exists {
+		if err = bptree.Update(func(tx *bbolt.Tx) error {
+			_, err = tx.CreateBucketIfNotExists(indexBucketName)
+			return err
+		}); err != nil {
+			panic("failed to create bucket in bptree")
+		}
+	}
+
+	return &BPlusTree{tree: bptree, bloomMu: new(sync.RWMutex)}
+}
+
+// EnableBloomFilter consult a bloom filter before looking up the keys in bbolt,
+// the filter saved by Close is loaded if it's not stale, otherwise it's built from the keys
+func (bptree *BPlusTree) EnableBloomFilter(expectedKeys uint, falsePositive float64) error {
+	var bloom *bloomFilter
+	if err := bptree.tree.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(bloomBucketName)
+		if bucket == nil {
+			return nil
+		}
+		txId := bucket.Get(bloomTxIdKey)
+		if len(txId) != 8 || binary.LittleEndian.Uint64(txId) != uint64(tx.ID()) {
+			return nil
+		}
+		var err error
+		bloom, err = decodeBloomFilter(bucket.Get(bloomFilterKey))
 		return err
 	}); err != nil {
-		panic("failed to create bucket in bptree")
+		return err
 	}
 
-	return &BPlusTree{tree: bptree}
+	bptree.bloomMu.Lock()
+	bptree.expectedKeys = expectedKeys
+	bptree.falsePositive = falsePositive
+	bptree.bloom = bloom
+	bptree.bloomMu.Unlock()
+	if bloom == nil {
+		bptree.RebuildBloomFilter()
+	}
+	return nil
+}
+
+// RebuildBloomFilter build a new bloom filter from the keys, thus the deleted keys are removed from it,
+// the index can be updated while rebuilding
+func (bptree *BPlusTree) RebuildBloomFilter() {
+	size := uint(bptree.Size())
+	bptree.bloomMu.Lock()
+	if bptree.expectedKeys == 0 || bptree.nextBloom != nil {
+		bptree.bloomMu.Unlock()
+		return
+	}
+	if size < bptree.expectedKeys {
+		size = bptree.expectedKeys
+	}
+	next := newBloomFilter(size, bptree.falsePositive)
+	bptree.nextBloom = next
+	bptree.bloomMu.Unlock()
+
+	//the keys committed after the view begins are added by Put
+	_ = bptree.tree.View(func(tx *bbolt.Tx) error {
+		cursor := tx.Bucket(indexBucketName).Cursor()
+		for key, _ := cursor.First(); key != nil; key, _ = cursor.Next() {
+			bptree.bloomMu.Lock()
+			next.add(key)
+			bptree.bloomMu.Unlock()
+		}
+		return nil
+	})
+
+	bptree.bloomMu.Lock()
+	bptree.bloom, bptree.nextBloom = next, nil
+	atomic.StoreUint64(&bptree.negatives, 0)
+	atomic.StoreUint64(&bptree.falsePositives, 0)
+	bptree.bloomMu.Unlock()
+}
+
+// BloomFilterStat return the statistics of bloom filter, nil means it's disabled
+func (bptree *BPlusTree) BloomFilterStat() *BloomFilterStat {
+	bptree.bloomMu.RLock()
+	defer bptree.bloomMu.RUnlock()
+	if bptree.bloom == nil {
+		return nil
+	}
+	return &BloomFilterStat{
+		Size:           bptree.bloom.size(),
+		Negatives:      atomic.LoadUint64(&bptree.negatives),
+		FalsePositives: atomic.LoadUint64(&bptree.falsePositives),
+	}
+}
+
+// add the key into the bloom filter and the one being rebuilt,
+// it's called before and after the key is written, thus the key won't be missed by a lookup or a rebuilding
+func (bptree *BPlusTree) addToBloom(keys ...[]byte) {
+	bptree.bloomMu.Lock()
+	defer bptree.bloomMu.Unlock()
+	for _, key := range keys {
+		if bptree.bloom != nil {
+			bptree.bloom.add(key)
+		}
+		if bptree.nextBloom != nil {
+			bptree.nextBloom.add(key)
+		}
+	}
+}
+
+// check the key by bloom filter, mayContain is false means the key is absent for sure
+func (bptree *BPlusTree) checkBloom(key []byte) (enabled bool, mayContain bool) {
+	bptree.bloomMu.RLock()
+	defer bptree.bloomMu.RUnlock()
+	if bptree.bloom == nil {
+		return false, true
+	}
+	return true, bptree.bloom.mayContain(key)
 }
 
 func (bptree *BPlusTree) Put(key []byte, pos *data.LogRecordPos) *data.LogRecordPos {
-	var oldValue []byte
+	bptree.addToBloom(key)
+	var oldPos *data.LogRecordPos
 	if err := bptree.tree.Update(func(tx *bbolt.Tx) error {
 		bucket := tx.Bucket(indexBucketName)
-		oldValue = bucket.Get(key)
+		//the value is only valid in the transaction, decode it before the file is remapped
+		if oldValue := bucket.Get(key); len(oldValue) != 0 {
+			oldPos = data.DecodeLogRecordPos(oldValue)
+		}
 		return bucket.Put(key, data.EncodeLogRecordPos(pos))
 	}); err != nil {
 		panic("failed to put the value in bptree")
 	}
-	if len(oldValue) == 0 {
-		return nil
-	}
-	return data.DecodeLogRecordPos(oldValue)
+	bptree.addToBloom(key)
+	return oldPos
 }
 
 // Get : get the position information by key
 func (bptree *BPlusTree) Get(key []byte) *data.LogRecordPos {
+	//the key is absent for sure, needn't read bbolt
+	bloomEnabled, mayContain := bptree.checkBloom(key)
+	if !mayContain {
+		atomic.AddUint64(&bptree.negatives, 1)
+		return nil
+	}
 	var pos *data.LogRecordPos
 	if err := bptree.tree.View(func(tx *bbolt.Tx) error {
 		bucket := tx.Bucket(indexBucketName)
@@ -64,26 +212,64 @@ func (bptree *BPlusTree) Get(key []byte) *data.LogRecordPos {
 	}); err != nil {
 		panic("failed to get the value in bptree")
 	}
+	if pos == nil && bloomEnabled {
+		atomic.AddUint64(&bptree.falsePositives, 1)
+	}
 	return pos
 }
 
 // Delete the position information by key
 // 通过key删除对应的索引位置信息
 func (bptree *BPlusTree) Delete(key []byte) (*data.LogRecordPos, bool) {
-	var oldValue []byte
+	var oldPos *data.LogRecordPos
 	if err := bptree.tree.Update(func(tx *bbolt.Tx) error {
 		bucket := tx.Bucket(indexBucketName)
-		if oldValue = bucket.Get(key); len(oldValue) != 0 {
+		//the value is only valid in the transaction, decode it before the file is remapped
+		if oldValue := bucket.Get(key); len(oldValue) != 0 {
+			oldPos = data.DecodeLogRecordPos(oldValue)
 			return bucket.Delete(key)
 		}
 		return nil
 	}); err != nil {
 		panic("failed to delete the value in bptree")
 	}
-	if len(oldValue) == 0 {
-		return nil, false
+	return oldPos, oldPos != nil
+}
+
+// ApplyBatch put and delete the keys in a single bbolt transaction,
+// thus the index file is written and synced only once
+func (bptree *BPlusTree) ApplyBatch(items []*BatchItem) []*data.LogRecordPos {
+	var putKeys [][]byte
+	for _, item := range items {
+		if item.Pos != nil {
+			putKeys = append(putKeys, item.Key)
+		}
+	}
+	bptree.addToBloom(putKeys...)
+	defer bptree.addToBloom(putKeys...)
+
+	oldPositions := make([]*data.LogRecordPos, len(items))
+	if err := bptree.tree.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(indexBucketName)
+		for i, item := range items {
+			if oldValue := bucket.Get(item.Key); len(oldValue) != 0 {
+				oldPositions[i] = data.DecodeLogRecordPos(oldValue)
+			}
+			var err error
+			if item.Pos == nil {
+				err = bucket.Delete(item.Key)
+			} else {
+				err = bucket.Put(item.Key, data.EncodeLogRecordPos(item.Pos))
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		panic("failed to apply the batch in bptree")
 	}
-	return data.DecodeLogRecordPos(oldValue), true
+	return oldPositions
 }
 
 // Size return index's size
@@ -99,11 +285,38 @@ func (bptree *BPlusTree) Size() int {
 	return size
 }
 
-// Close the BPTree indexer
+// Close the BPTree indexer, the bloom filter is saved
 func (bptree *BPlusTree) Close() error {
+	//the filter is saved once, thus Close can be called again
+	bptree.bloomMu.Lock()
+	bloom := bptree.bloom
+	bptree.bloom = nil
+	bptree.bloomMu.Unlock()
+	if bloom != nil {
+		if err := bptree.tree.Update(func(tx *bbolt.Tx) error {
+			bucket, err := tx.CreateBucketIfNotExists(bloomBucketName)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put(bloomFilterKey, bloom.encode()); err != nil {
+				return err
+			}
+			txId := make([]byte, 8)
+			binary.LittleEndian.PutUint64(txId, uint64(tx.ID()))
+			return bucket.Put(bloomTxIdKey, txId)
+		}); err != nil {
+			return err
+		}
+	}
 	return bptree.tree.Close()
 }
 
+// Clone copy the index information into a btree index in memory,
+// holding a bbolt read transaction for a long time would block the writes which grow the file
+func (bptree *BPlusTree) Clone() Indexer {
+	return CopyToBtree(bptree.Iterator(false))
+}
+
 // Iterator index iterator
 func (bptree *BPlusTree) Iterator(reverse bool) Iterator {
 	return newBptreeIterator(bptree.tree, reverse)
@@ -2,6 +2,7 @@ package index
 
 import (
 	"bitcaskGo/data"
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"os"
 	"path/filepath"
@@ -154,3 +155,83 @@ func TestBPlusTree_Iterator(t *testing.T) {
 		assert.NotNil(t, iter.Value())
 	}
 }
+
+func TestBPlusTree_ApplyBatch(t *testing.T) {
+	path := filepath.Join(os.TempDir(), "bptree-apply-batch")
+	_ = os.MkdirAll(path, os.ModePerm)
+
+	defer func() {
+		_ = os.RemoveAll(path)
+	}()
+
+	bptree := NewBPlusTree(path, false)
+	bptree.Put([]byte("test1"), &data.LogRecordPos{FileId: 1, Offset: 10})
+	bptree.Put([]byte("test2"), &data.LogRecordPos{FileId: 1, Offset: 20})
+
+	oldPositions := bptree.ApplyBatch([]*BatchItem{
+		{Key: []byte("test1"), Pos: &data.LogRecordPos{FileId: 2, Offset: 11}},
+		{Key: []byte("test2")},
+		{Key: []byte("test3"), Pos: &data.LogRecordPos{FileId: 2, Offset: 33}},
+	})
+	assert.Equal(t, 3, len(oldPositions))
+	assert.Equal(t, int64(10), oldPositions[0].Offset)
+	assert.Equal(t, int64(20), oldPositions[1].Offset)
+	assert.Nil(t, oldPositions[2])
+
+	assert.Equal(t, uint32(2), bptree.Get([]byte("test1")).FileId)
+	assert.Nil(t, bptree.Get([]byte("test2")))
+	assert.Equal(t, int64(33), bptree.Get([]byte("test3")).Offset)
+	assert.Equal(t, 2, bptree.Size())
+}
+
+func TestBPlusTree_BloomFilter(t *testing.T) {
+	path := filepath.Join(os.TempDir(), "bptree-bloom")
+	_ = os.MkdirAll(path, os.ModePerm)
+
+	defer func() {
+		_ = os.RemoveAll(path)
+	}()
+
+	bptree := NewBPlusTree(path, false)
+	for i := 0; i < 1000; i++ {
+		bptree.Put([]byte(fmt.Sprintf("key-%d", i)), &data.LogRecordPos{FileId: 1, Offset: int64(i)})
+	}
+	assert.Nil(t, bptree.BloomFilterStat())
+	err := bptree.EnableBloomFilter(1000, 0.01)
+	assert.Nil(t, err)
+	for i := 0; i < 1000; i++ {
+		assert.NotNil(t, bptree.Get([]byte(fmt.Sprintf("key-%d", i))))
+		assert.Nil(t, bptree.Get([]byte(fmt.Sprintf("absent-%d", i))))
+	}
+	stat := bptree.BloomFilterStat()
+	assert.Greater(t, stat.Size, int64(0))
+	assert.Equal(t, uint64(1000), stat.Negatives+stat.FalsePositives)
+	assert.Less(t, stat.FalsePositives, uint64(50))
+	assert.Nil(t, bptree.Close())
+
+	//the saved filter is loaded
+	bptree2 := NewBPlusTree(path, false)
+	err = bptree2.EnableBloomFilter(1000, 0.01)
+	assert.Nil(t, err)
+	assert.NotNil(t, bptree2.Get([]byte("key-10")))
+	//the keys put without the filter make the saved one stale
+	assert.Nil(t, bptree2.Close())
+	bptree3 := NewBPlusTree(path, false)
+	bptree3.Put([]byte("new-key"), &data.LogRecordPos{FileId: 2})
+	assert.Nil(t, bptree3.Close())
+	bptree4 := NewBPlusTree(path, false)
+	err = bptree4.EnableBloomFilter(1000, 0.01)
+	assert.Nil(t, err)
+	assert.NotNil(t, bptree4.Get([]byte("new-key")))
+
+	//the deleted keys are dropped by rebuilding
+	for i := 0; i < 1000; i++ {
+		bptree4.Delete([]byte(fmt.Sprintf("key-%d", i)))
+	}
+	bptree4.RebuildBloomFilter()
+	for i := 0; i < 1000; i++ {
+		assert.Nil(t, bptree4.Get([]byte(fmt.Sprintf("key-%d", i))))
+	}
+	assert.Less(t, bptree4.BloomFilterStat().FalsePositives, uint64(50))
+	assert.Nil(t, bptree4.Close())
+}
@@ -34,7 +34,9 @@ func (bt *BTree) Put(key []byte, pos *data.LogRecordPos) *data.LogRecordPos {
 }
 func (bt *BTree) Get(key []byte) *data.LogRecordPos {
 	it := &Item{key: key}
+	bt.lock.RLock()
 	btreeItem := bt.tree.Get(it) //Get operation return an Item
+	bt.lock.RUnlock()
 	if btreeItem == nil {
 		return nil
 	}
@@ -52,6 +54,8 @@ func (bt *BTree) Delete(key []byte) (*data.LogRecordPos, bool) {
 }
 
 func (bt *BTree) Size() int {
+	bt.lock.RLock()
+	defer bt.lock.RUnlock()
 	return bt.tree.Len()
 }
 
@@ -64,11 +68,27 @@ func (bt *BTree) Iterator(reverse bool) Iterator {
 	return newBTreeIterator(bt.tree, reverse)
 }
 
+// ApplyBatch put and delete the keys one by one
+func (bt *BTree) ApplyBatch(items []*BatchItem) []*data.LogRecordPos {
+	return applyEach(bt, items)
+}
+
 // Close unnecessary method
 func (bt *BTree) Close() error {
 	return nil
 }
 
+// Clone the btree lazily, the nodes are copied only when they are written
+func (bt *BTree) Clone() Indexer {
+	//clone must not run concurrently with writes
+	bt.lock.Lock()
+	defer bt.lock.Unlock()
+	return &BTree{
+		tree: bt.tree.Clone(),
+		lock: new(sync.RWMutex),
+	}
+}
+
 // BTree index iterator
 type btreeIterator struct {
 	currIndex int     //current iterating index position of the traversal
@@ -118,3 +118,24 @@ func TestBTree_Iterator(t *testing.T) {
 		assert.NotNil(t, iter6.Key())
 	}
 }
+
+func TestBTree_Clone(t *testing.T) {
+	bt := NewBtree()
+	bt.Put([]byte("a"), &data.LogRecordPos{FileId: 1, Offset: 10})
+	bt.Put([]byte("b"), &data.LogRecordPos{FileId: 1, Offset: 20})
+
+	clone := bt.Clone()
+	bt.Put([]byte("a"), &data.LogRecordPos{FileId: 2, Offset: 30})
+	bt.Delete([]byte("b"))
+	bt.Put([]byte("c"), &data.LogRecordPos{FileId: 2, Offset: 40})
+
+	//the clone still see the old positions
+	assert.Equal(t, 2, clone.Size())
+	assert.Equal(t, int64(10), clone.Get([]byte("a")).Offset)
+	assert.Equal(t, int64(20), clone.Get([]byte("b")).Offset)
+	assert.Nil(t, clone.Get([]byte("c")))
+
+	//update the clone doesn't affect the origin
+	clone.Delete([]byte("a"))
+	assert.Equal(t, int64(30), bt.Get([]byte("a")).Offset)
+}
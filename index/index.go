@@ -30,6 +30,18 @@ type Indexer interface {
 
 	// Close the indexer
 	Close() error
+
+	// Clone return a point-in-time copy of the index, later updates are invisible to the copy
+	Clone() Indexer
+
+	// ApplyBatch put and delete the keys in order at once, return the old positions in the same order
+	ApplyBatch(items []*BatchItem) []*data.LogRecordPos
+}
+
+// BatchItem an update of index, nil Pos means delete the key
+type BatchItem struct {
+	Key []byte
+	Pos *data.LogRecordPos
 }
 
 // IndexType enum different type of indexers
@@ -61,6 +73,32 @@ func NewIndexer(typ IndexType, dirPath string, sync bool) Indexer {
 
 }
 
+// apply the batch items one by one, for the indexes in memory
+func applyEach(indexer Indexer, items []*BatchItem) []*data.LogRecordPos {
+	oldPositions := make([]*data.LogRecordPos, len(items))
+	for i, item := range items {
+		if item.Pos == nil {
+			oldPositions[i], _ = indexer.Delete(item.Key)
+		} else {
+			oldPositions[i] = indexer.Put(item.Key, item.Pos)
+		}
+	}
+	return oldPositions
+}
+
+// CopyToBtree copy all the index information which the iterator walks through into a new btree index,
+// the iterator is closed after that
+func CopyToBtree(iterator Iterator) *BTree {
+	bt := NewBtree()
+	defer iterator.Close()
+	for iterator.Rewind(); iterator.Valid(); iterator.Next() {
+		//copy the key, it may be invalid after the iterator is closed
+		key := append([]byte(nil), iterator.Key()...)
+		bt.tree.ReplaceOrInsert(&Item{key: key, pos: iterator.Value()})
+	}
+	return bt
+}
+
 type Item struct {
 	key []byte
 	pos *data.LogRecordPos
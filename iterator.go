@@ -13,7 +13,12 @@ type Iterator struct {
 }
 
 func (db *DB) NewIterator(opts IteratorOptions) *Iterator {
-	indexIter := db.index.Iterator(opts.Reverse)
+	return db.newIterator(db.index, opts)
+}
+
+// iterate the given index, the values are read from db's data files
+func (db *DB) newIterator(idx index.Indexer, opts IteratorOptions) *Iterator {
+	indexIter := idx.Iterator(opts.Reverse)
 	return &Iterator{
 		indexIter: indexIter,
 		db:        db,
@@ -62,15 +67,16 @@ func (it *Iterator) Close() {
 	it.indexIter.Close()
 }
 
+// jump to the next key which has the prefix and isn't expired
 func (it *Iterator) skipToNext() {
 	prefixLen := len(it.options.Prefix)
-	if prefixLen == 0 {
-		return
-	}
 
 	for ; it.indexIter.Valid(); it.indexIter.Next() {
+		if isExpired(it.indexIter.Value()) {
+			continue
+		}
 		key := it.indexIter.Key()
-		if prefixLen <= len(key) && bytes.Compare(it.options.Prefix, key[:prefixLen]) == 0 {
+		if prefixLen == 0 || prefixLen <= len(key) && bytes.Compare(it.options.Prefix, key[:prefixLen]) == 0 {
 			break
 		}
 	}
@@ -0,0 +1,92 @@
+package bitcaskGo
+
+import (
+	"bitcaskGo/data"
+	"io"
+	"sync"
+)
+
+// the logRecords decoded from a data file, waiting to be applied to index
+type decodedFile struct {
+	records []*data.TransactionRecord
+	offset  int64 //where the reading stops
+	err     error
+	done    chan struct{} //closed when the file is decoded
+}
+
+// decode the data files concurrently, at most IndexLoadConcurrency files are decoded or waiting at a time,
+// the logRecords are applied to index in file id order, thus the transactions across files work as before,
+// return the offset where the reading of the last file stops
+func (db *DB) loadIndexConcurrently(dataFiles []*data.Datafile, offsets []int64) (int64, error) {
+	decodedFiles := make([]*decodedFile, len(dataFiles))
+	for i := range decodedFiles {
+		decodedFiles[i] = &decodedFile{done: make(chan struct{})}
+	}
+
+	slots := make(chan struct{}, db.options.IndexLoadConcurrency)
+	stop := make(chan struct{})
+	wg := new(sync.WaitGroup)
+	//wait for the decoding goroutines when we return early
+	defer func() {
+		close(stop)
+		wg.Wait()
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i, dataFile := range dataFiles {
+			//a slot is released after the file is applied, thus the memory is bounded
+			select {
+			case slots <- struct{}{}:
+			case <-stop:
+				return
+			}
+			wg.Add(1)
+			go func(df *decodedFile, dataFile *data.Datafile, offset int64) {
+				defer wg.Done()
+				defer close(df.done)
+				df.records, df.offset, df.err = readLogRecords(dataFile, offset)
+			}(decodedFiles[i], dataFile, offsets[i])
+		}
+	}()
+
+	var offset int64
+	for i, df := range decodedFiles {
+		<-df.done
+		if df.err != nil {
+			return 0, df.err
+		}
+		for _, record := range df.records {
+			db.applyLogRecord(record.Record, record.Position)
+		}
+		offset = df.offset
+		//release the logRecords and the slot
+		decodedFiles[i] = nil
+		<-slots
+	}
+	return offset, nil
+}
+
+// read the logRecords in dataFile from offset, the values are dropped, only the index needs them
+func readLogRecords(dataFile *data.Datafile, offset int64) ([]*data.TransactionRecord, int64, error) {
+	var records []*data.TransactionRecord
+	for {
+		logRecord, size, err := dataFile.ReadLogRecord(offset)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, 0, err
+		}
+		//the position takes the blob pointer from the value before it's dropped
+		logRecordPos := newLogRecordPos(dataFile.Fileid, offset, size, logRecord)
+		logRecord.Value = nil
+		records = append(records, &data.TransactionRecord{
+			Record:   logRecord,
+			Position: logRecordPos,
+		})
+		offset += size
+	}
+	return records, offset, nil
+}
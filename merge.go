@@ -2,13 +2,15 @@ package bitcaskGo
 
 import (
 	"bitcaskGo/data"
-	"bitcaskGo/utils"
+	"bitcaskGo/fileio"
+	"bitcaskGo/index"
 	"io"
 	"os"
 	"path"
 	"path/filepath"
 	"sort"
 	"strconv"
+	"time"
 )
 
 const (
@@ -17,10 +19,37 @@ const (
 )
 
 func (db *DB) Merge() error {
+	if db.options.ReadOnly {
+		return ErrDatabaseReadOnly
+	}
 	//if the database is empty, return directly
 	if db.activeFile == nil {
 		return nil
 	}
+
+	start := time.Now()
+	var err error
+	if db.options.MergeFileDeadRatio > 0 {
+		err = db.mergeSelectedFiles()
+	} else {
+		err = db.merge()
+	}
+	//record the result when the merge really runs
+	if err != ErrMergeRatioUnreached && err != ErrMergeIsProcessing {
+		db.mu.Lock()
+		db.lastMergeTime = start
+		db.lastMergeDuration = time.Since(start)
+		db.lastMergeErr = err
+		db.mu.Unlock()
+	}
+	//the deleted keys are dropped from bloom filters
+	if err == nil {
+		db.rebuildBloomFilters()
+	}
+	return err
+}
+
+func (db *DB) merge() error {
 	db.mu.Lock()
 	//if the database is merging, return directly
 	if db.isMerging {
@@ -28,19 +57,29 @@ func (db *DB) Merge() error {
 		return ErrMergeIsProcessing
 	}
 
+	//the expired keys can be reclaimed as well
+	db.reclaimExpiredKeys()
+
 	//check if the data number that can be merged achieve the threshold
-	totalSize, err := utils.DirSize(db.options.DirPath)
+	totalSize, err := fileio.DirSize(db.options.FileSystem, db.options.DirPath)
 	if err != nil {
 		db.mu.Unlock()
 		return err
 	}
+	//the preallocated tail of active file holds no data
+	preallocatedSize, err := db.preallocatedSize()
+	if err != nil {
+		db.mu.Unlock()
+		return err
+	}
+	totalSize -= preallocatedSize
 	if float32(db.reclaimSize)/float32(totalSize) < db.options.DataFileMergeRatio {
 		db.mu.Unlock()
 		return ErrMergeRatioUnreached
 	}
 
 	//check if the available disk size big enough to hold the data that after mering
-	availableDiskSize, err := utils.AvailableDiskSize()
+	availableDiskSize, err := db.options.FileSystem.AvailableSize(db.options.DirPath)
 	if err != nil {
 		db.mu.Unlock()
 		return err
@@ -59,20 +98,16 @@ func (db *DB) Merge() error {
 		db.isMerging = false
 	}()
 
-	//sync the current active data file before merging
-	if err := db.activeFile.Sync(); err != nil {
-		db.mu.Unlock()
-		return err
-	}
-
 	//transfer the active date file into older file
+	lastActiveFile := db.activeFile
+	lastBlobFile := db.activeBlobFile
 	db.olderFiles[db.activeFile.Fileid] = db.activeFile
 
 	//open a new active data file
 	//the later write action will operate in this file
 	if err := db.setActiveDataFile(); err != nil {
 		db.mu.Unlock()
-		return nil
+		return err
 	}
 	//record the first file id that doesn't in merge process
 	nonMergeFileId := db.activeFile.Fileid
@@ -82,6 +117,23 @@ func (db *DB) Merge() error {
 	for _, dataFile := range db.olderFiles {
 		mergeFiles = append(mergeFiles, dataFile)
 	}
+	//the size reclaimed so far is all in the merged files
+	reclaimedSize := db.reclaimSize
+	db.mu.Unlock()
+
+	//sync the last active data file before merging,
+	//it's not written anymore, thus the writers needn't to wait for it
+	//the blobs it points to are synced first
+	if lastBlobFile != nil {
+		if err := lastBlobFile.Sync(); err != nil {
+			return err
+		}
+	}
+	if err := lastActiveFile.Sync(); err != nil {
+		return err
+	}
+	db.mu.Lock()
+	db.markSynced(lastActiveFile.Fileid, lastActiveFile.WriteOff)
 	db.mu.Unlock()
 
 	sort.Slice(mergeFiles, func(i, j int) bool {
@@ -93,15 +145,15 @@ func (db *DB) Merge() error {
 	//if the mergePath exist
 	//means that there was a merge process before
 	//we need to delete it
-	if _, err := os.Stat(mergePath); err == nil {
+	if _, err := db.options.FileSystem.Stat(mergePath); err == nil {
 		//mergePath exist
-		if err := os.RemoveAll(mergePath); err != nil {
+		if err := db.options.FileSystem.RemoveAll(mergePath); err != nil {
 			return err
 		}
 	}
 
 	//create a mergePath directory
-	if err := os.MkdirAll(mergePath, os.ModePerm); err != nil {
+	if err := db.options.FileSystem.MkdirAll(mergePath); err != nil {
 		return err
 	}
 
@@ -109,16 +161,72 @@ func (db *DB) Merge() error {
 	mergeOptions := db.options
 	mergeOptions.DirPath = mergePath
 	mergeOptions.SyncWrites = false //accelerate the merge speed
+	//the temporary database needn't run in background or filter the lookups
+	mergeOptions.AutoMergeInterval = 0
+	mergeOptions.IndexCheckpointInterval = 0
+	mergeOptions.SyncInterval = 0
+	//the blob logRecords are copied as they are, the values stay in the blob files
+	mergeOptions.BlobThreshold = 0
+	mergeOptions.BloomFilterExpectedKeys = 0
 	mergeDB, err := Open(mergeOptions)
 	if err != nil {
 		return err
 	}
+	//the temporary database is closed on every path, thus its files and directory lock are released
+	if err := db.rewriteMergeFiles(mergeDB, mergePath, mergeFiles); err != nil {
+		_ = mergeDB.Close()
+		return err
+	}
+	if err := mergeDB.Close(); err != nil {
+		return err
+	}
+
+	//the logRecords dropped are overwritten by the newer ones, which may be in active file,
+	//they must be durable before the merge completes, otherwise a crash loses the key
+	if err := db.Sync(); err != nil {
+		return err
+	}
+
+	//write a file to signify merge process have finished
+	mergeFinishedFile, err := data.OpenMergeFinishedFile(db.options.FileSystem, mergePath)
+	if err != nil {
+		return err
+	}
+	mergeFinishedFile.Cipher = db.cipher
+	mergeFinishedRecord := &data.LogRecord{
+		Key:   []byte(mergeFinishedKey),
+		Value: []byte(strconv.Itoa(int(nonMergeFileId))),
+	}
 
+	encRecord, _ := data.EncodeLogRecord(mergeFinishedRecord)
+	if err := mergeFinishedFile.Write(encRecord); err != nil {
+		_ = mergeFinishedFile.Close()
+		return err
+	}
+	//sync the file
+	if err := mergeFinishedFile.Sync(); err != nil {
+		_ = mergeFinishedFile.Close()
+		return err
+	}
+	if err := mergeFinishedFile.Close(); err != nil {
+		return err
+	}
+
+	db.finishMerge(reclaimedSize)
+	return nil
+}
+
+// write the live logRecords of mergeFiles into the temporary database, and their positions into hint file
+func (db *DB) rewriteMergeFiles(mergeDB *DB, mergePath string, mergeFiles []*data.Datafile) error {
 	//open a hint file to save index information
-	hintFile, err := data.OpenHintFile(mergePath)
+	hintFile, err := data.OpenHintFile(db.options.FileSystem, mergePath)
 	if err != nil {
 		return err
 	}
+	hintFile.Cipher = db.cipher
+	defer func() {
+		_ = hintFile.Close()
+	}()
 
 	//traverse and process every data file which need to be merged
 	for _, dataFile := range mergeFiles {
@@ -135,12 +243,14 @@ func (db *DB) Merge() error {
 			}
 			//get the real key and the logRecordPos in index
 			realKey, _ := parselogRecordKey(logRecord.Key)
-			logRecordPos := db.index.Get(realKey)
+			logRecordPos := db.getPosition(logRecord.NamespaceId, realKey)
 			//compare with the position information in index,
 			//see if it's available
-			if logRecordPos != nil &&
+			isLive := logRecordPos != nil &&
 				logRecordPos.FileId == dataFile.Fileid &&
-				logRecordPos.Offset == offset {
+				logRecordPos.Offset == offset &&
+				!isExpired(logRecordPos)
+			if isLive {
 				//clean the transaction flag
 				logRecord.Key = logRecordKeyWithSeq(realKey, nonTransactionSeqNo)
 				//add this available logRecord into mergeDB
@@ -149,10 +259,9 @@ func (db *DB) Merge() error {
 					return err
 				}
 				//add the current memory index information(position information) into hint file
-				if err := hintFile.WriteHintRecord(realKey, pos); err != nil {
+				if err := hintFile.WriteHintRecord(realKey, logRecord.NamespaceId, pos); err != nil {
 					return err
 				}
-
 			}
 			//add the offset
 			offset += size
@@ -162,31 +271,31 @@ func (db *DB) Merge() error {
 	if err := hintFile.Sync(); err != nil {
 		return err
 	}
+	return mergeDB.Sync()
+}
 
-	if err := mergeDB.Sync(); err != nil {
-		return err
-	}
-
-	//write a file to signify merge process have finished
-	mergeFinishedFile, err := data.OpenMergeFinishedFile(mergePath)
-	if err != nil {
-		return err
-	}
-	mergeFinishedRecord := &data.LogRecord{
-		Key:   []byte(mergeFinishedKey),
-		Value: []byte(strconv.Itoa(int(nonMergeFileId))),
+// the merged files are moved in by the next Open, the size they reclaim isn't counted anymore,
+// and auto merge waits until then, thus the same files aren't merged again and again
+func (db *DB) finishMerge(reclaimedSize int64) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.reclaimSize -= reclaimedSize
+	if db.reclaimSize < 0 {
+		db.reclaimSize = 0
 	}
+	db.mergePending = true
+}
 
-	encRecord, _ := data.EncodeLogRecord(mergeFinishedRecord)
-	if err := mergeFinishedFile.Write(encRecord); err != nil {
-		return err
-	}
-	//sync the file
-	if err := mergeFinishedFile.Sync(); err != nil {
-		return err
+// get the position of key in namespace,
+// merge doesn't hold the lock, namespaces may be dropped at the same time
+func (db *DB) getPosition(namespaceId uint32, key []byte) *data.LogRecordPos {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	idx := db.indexOf(namespaceId)
+	if idx == nil {
+		return nil
 	}
-
-	return nil
+	return idx.Get(key)
 }
 
 // example:  /tmp/bitcast   ---> /tmp/bitcask-merge
@@ -200,26 +309,29 @@ func (db *DB) getMergePath() string {
 func (db *DB) loadMergeFiles() error {
 	mergePath := db.getMergePath()
 	//check if the mergePath exist
-	if _, err := os.Stat(mergePath); os.IsNotExist(err) {
+	if _, err := db.options.FileSystem.Stat(mergePath); os.IsNotExist(err) {
 		return nil
 	}
 
 	defer func() {
-		_ = os.RemoveAll(mergePath)
+		_ = db.options.FileSystem.RemoveAll(mergePath)
 	}()
-	dirEntries, err := os.ReadDir(mergePath)
+	dirEntries, err := db.options.FileSystem.ReadDir(mergePath)
 	if err != nil {
 		return err
 	}
 
 	//find the file that signify the merge is finished, check if the merge is completed
-	var mergeFinished bool
+	var mergeFinished, mergeSelected bool
 	var mergeFileNames []string
 	for _, entry := range dirEntries {
 		//check if the merge process is done
 		if entry.Name() == data.MergeFinishedFileName {
 			mergeFinished = true
 		}
+		if entry.Name() == data.MergeSelectedFileName {
+			mergeSelected = true
+		}
 		//it's useless to move the seqNoFile to merge directory
 		if entry.Name() == data.SeqNoFileName {
 			continue
@@ -227,28 +339,63 @@ func (db *DB) loadMergeFiles() error {
 		if entry.Name() == fileLockName {
 			continue
 		}
+		//the index of merge database is empty, the index is rewritten from hint file instead
+		if entry.Name() == index.BPTreeIndexFileName || entry.Name() == chunkIndexDirName {
+			continue
+		}
 		mergeFileNames = append(mergeFileNames, entry.Name())
 	}
 
 	//return directly if the merge doesn't complete
-	if !mergeFinished {
+	if !mergeFinished && !mergeSelected {
 		return nil
 	}
 
+	//the selective merge only replaces some of the files
+	if mergeSelected {
+		replacedIds, finished, err := db.readMergeSelectedFile(mergePath)
+		if err != nil || !finished {
+			return err
+		}
+		//the positions in index checkpoint are invalid after the files are replaced
+		if err := removeCheckpoint(db.options.FileSystem, db.options.DirPath); err != nil {
+			return err
+		}
+		return db.loadSelectedMergeFiles(mergePath, mergeFileNames, replacedIds)
+	}
+
 	//begin process
 
 	//get nonMerged file id
 	nonMergeFileId, err := db.getNonMergeFileId(mergePath)
 	if err != nil {
+		//the merge finished file is torn by a crash before it's synced, the merge doesn't complete
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	}
+
+	//the positions in index checkpoint are invalid after the files are replaced
+	if err := removeCheckpoint(db.options.FileSystem, db.options.DirPath); err != nil {
 		return err
 	}
 
-	//delete merged data files
+	//the B plus tree index isn't rebuilt when open, update it before the old files are deleted
+	if db.options.IndexerType == BPTree {
+		if err := db.rewriteIndexFromHint(mergePath, func(fileId uint32) bool {
+			return fileId < nonMergeFileId
+		}); err != nil {
+			return err
+		}
+	}
+
+	//delete merged data files, the files are only deleted when open, thus the snapshots never lose the files they read
 	var fileId uint32 = 0
 	for ; fileId < nonMergeFileId; fileId++ {
 		fileName := data.GetFileName(db.options.DirPath, fileId)
-		if _, err := os.Stat(fileName); err == nil { //if the file exist
-			if err := os.Remove(fileName); err != nil { //delete the file
+		if _, err := db.options.FileSystem.Stat(fileName); err == nil { //if the file exist
+			if err := db.options.FileSystem.Remove(fileName); err != nil { //delete the file
 				return err
 			}
 		}
@@ -257,18 +404,77 @@ func (db *DB) loadMergeFiles() error {
 	for _, fileName := range mergeFileNames {
 		srcPath := filepath.Join(mergePath, fileName)
 		desPath := filepath.Join(db.options.DirPath, fileName)
-		if err := os.Rename(srcPath, desPath); err != nil {
+		if err := db.options.FileSystem.Rename(srcPath, desPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rewrite the B plus tree indexes by the hint file in merge directory,
+// replaced tells whether the file is replaced by the merge,
+// the keys in replaced files are deleted, then the positions in hint file are put unless the key is written after merge,
+// each index is updated in a single transaction, it's safe to do it again if we crash before the files are moved
+func (db *DB) rewriteIndexFromHint(mergePath string, replaced func(fileId uint32) bool) error {
+	indexes := db.indexes()
+	batches := make(map[uint32][]*index.BatchItem)
+	for id, idx := range indexes {
+		iterator := idx.Iterator(false)
+		for iterator.Rewind(); iterator.Valid(); iterator.Next() {
+			if replaced(iterator.Value().FileId) {
+				//copy the key, it may be invalid after the iterator is closed
+				key := append([]byte(nil), iterator.Key()...)
+				batches[id] = append(batches[id], &index.BatchItem{Key: key})
+			}
+		}
+		iterator.Close()
+	}
+
+	hintFile, err := data.OpenHintFile(db.options.FileSystem, mergePath)
+	if err != nil {
+		return err
+	}
+	hintFile.Cipher = db.cipher
+	defer func() {
+		_ = hintFile.Close()
+	}()
+	var offset int64 = 0
+	for {
+		logRecord, size, err := hintFile.ReadLogRecord(offset)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
 			return err
 		}
+		offset += size
+
+		pos := data.DecodeLogRecordPos(logRecord.Value)
+		idx := db.indexOf(logRecord.NamespaceId)
+		if idx == nil || isExpired(pos) {
+			continue
+		}
+		//only the key still in the replaced files is moved to the new position,
+		//the key deleted or written again after merge keeps its index
+		if currPos := idx.Get(logRecord.Key); currPos == nil || !replaced(currPos.FileId) {
+			continue
+		}
+		batches[logRecord.NamespaceId] = append(batches[logRecord.NamespaceId], &index.BatchItem{Key: logRecord.Key, Pos: pos})
+	}
+
+	for id, items := range batches {
+		indexes[id].ApplyBatch(items)
 	}
+	db.rebuildBloomFilters()
 	return nil
 }
 
 func (db *DB) getNonMergeFileId(dirPath string) (uint32, error) {
-	mergeFinishedFile, err := data.OpenMergeFinishedFile(dirPath)
+	mergeFinishedFile, err := data.OpenMergeFinishedFile(db.options.FileSystem, dirPath)
 	if err != nil {
 		return 0, err
 	}
+	mergeFinishedFile.Cipher = db.cipher
 	record, _, err := mergeFinishedFile.ReadLogRecord(0)
 	if err != nil {
 		return 0, err
@@ -285,15 +491,16 @@ func (db *DB) loadIndexFromHintFile() error {
 	//thus this file's path is db's data dir
 
 	//check if the hint file exist
-	hintFileName := filepath.Join(db.options.DirPath)
-	if _, err := os.Stat(hintFileName); err != nil {
+	hintFileName := filepath.Join(db.options.DirPath, data.HintFileName)
+	if _, err := db.options.FileSystem.Stat(hintFileName); err != nil {
 		return nil
 	}
 
-	hintFile, err := data.OpenHintFile(db.options.DirPath)
+	hintFile, err := data.OpenHintFile(db.options.FileSystem, db.options.DirPath)
 	if err != nil {
 		return err
 	}
+	hintFile.Cipher = db.cipher
 
 	//read the index in hint file
 	var offset int64 = 0
@@ -308,7 +515,14 @@ func (db *DB) loadIndexFromHintFile() error {
 		//decode the logRecord, get the value,
 		// the value in hint file is encoded position index information
 		logRecordPos := data.DecodeLogRecordPos(logRecord.Value)
-		db.index.Put(logRecord.Key, logRecordPos)
+		//the key expired after merge or its namespace has been dropped, it only takes up space now
+		idx := db.indexOf(logRecord.NamespaceId)
+		if idx == nil || isExpired(logRecordPos) {
+			db.reclaimSize += int64(logRecordPos.Size)
+		} else {
+			idx.Put(logRecord.Key, logRecordPos)
+			db.addLive(logRecordPos)
+		}
 		offset += size
 	}
 	return nil
@@ -1,9 +1,11 @@
 package bitcaskGo
 
 import (
+	"bitcaskGo/fileio"
 	"bitcaskGo/utils"
 	"github.com/stretchr/testify/assert"
 	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 )
@@ -206,3 +208,129 @@ func TestDB_Merge5(t *testing.T) {
 		assert.NotNil(t, val)
 	}
 }
+
+// case6 the positions in b plus tree index are rewritten after merge
+func TestDB_MergeBPTree(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-merge-6")
+	opts.DataFileSize = 64 * 1024
+	opts.DataFileMergeRatio = 0
+	opts.IndexerType = BPTree
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	for i := 0; i < 1000; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+		assert.Nil(t, err)
+	}
+	for i := 0; i < 500; i++ {
+		err := db.Delete(utils.GetTestKey(i))
+		assert.Nil(t, err)
+	}
+	//the index of a batch is updated in a single transaction
+	wb, err := db.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.Nil(t, err)
+	for i := 500; i < 600; i++ {
+		err := wb.Put(utils.GetTestKey(i), []byte("value in batch"))
+		assert.Nil(t, err)
+	}
+	err = wb.Delete(utils.GetTestKey(999))
+	assert.Nil(t, err)
+	err = wb.Commit()
+	assert.Nil(t, err)
+
+	err = db.Merge()
+	assert.Nil(t, err)
+	//the temporary database is closed, its directory lock is released
+	mergeLock := fileio.OSFileSystem.Lock(filepath.Join(db.getMergePath(), fileLockName))
+	hold, err := mergeLock.TryLock()
+	assert.Nil(t, err)
+	assert.True(t, hold)
+	assert.Nil(t, mergeLock.Unlock())
+	//the keys written during merge are kept
+	err = db.Put(utils.GetTestKey(1000), []byte("value after merge"))
+	assert.Nil(t, err)
+
+	err = db.Close()
+	assert.Nil(t, err)
+	db2, err := Open(opts)
+	assert.Nil(t, err)
+	defer func() {
+		_ = db2.Close()
+	}()
+	assert.Equal(t, 500, len(db2.ListKeys()))
+	for i := 0; i < 500; i++ {
+		_, err := db2.Get(utils.GetTestKey(i))
+		assert.Equal(t, ErrKeyNotFound, err)
+	}
+	for i := 500; i < 600; i++ {
+		val, err := db2.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("value in batch"), val)
+	}
+	for i := 600; i < 999; i++ {
+		_, err := db2.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+	}
+	val, err := db2.Get(utils.GetTestKey(1000))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value after merge"), val)
+}
+
+// case7 the keys deleted after merge don't come back when the b plus tree index is rewritten
+func TestDB_MergeBPTreeDeleteAfterMerge(t *testing.T) {
+	for _, deadRatio := range []float32{0, 0.5} {
+		opts := DefaultOptions
+		dir, _ := os.MkdirTemp("", "bitcask-go-merge-7")
+		opts.DataFileSize = 64 * 1024
+		opts.DataFileMergeRatio = 0
+		opts.MergeFileDeadRatio = deadRatio
+		opts.IndexerType = BPTree
+		opts.DirPath = dir
+		db, err := Open(opts)
+		assert.Nil(t, err)
+
+		for i := 0; i < 1000; i++ {
+			err := db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+			assert.Nil(t, err)
+		}
+		for i := 0; i < 600; i++ {
+			err := db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+			assert.Nil(t, err)
+		}
+		err = db.Merge()
+		assert.Nil(t, err)
+
+		//the keys are deleted or written again before the merged files are moved in
+		for i := 600; i < 700; i++ {
+			err := db.Delete(utils.GetTestKey(i))
+			assert.Nil(t, err)
+		}
+		for i := 700; i < 800; i++ {
+			err := db.Put(utils.GetTestKey(i), []byte("value after merge"))
+			assert.Nil(t, err)
+		}
+		err = db.Close()
+		assert.Nil(t, err)
+
+		db2, err := Open(opts)
+		assert.Nil(t, err)
+		assert.Equal(t, 900, len(db2.ListKeys()))
+		for i := 0; i < 1000; i++ {
+			val, err := db2.Get(utils.GetTestKey(i))
+			switch {
+			case i >= 600 && i < 700:
+				assert.Equal(t, ErrKeyNotFound, err)
+			case i >= 700 && i < 800:
+				assert.Nil(t, err)
+				assert.Equal(t, []byte("value after merge"), val)
+			default:
+				assert.Nil(t, err)
+			}
+		}
+		destroyDB(db2)
+	}
+}
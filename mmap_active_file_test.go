@@ -0,0 +1,63 @@
+package bitcaskGo
+
+import (
+	"bitcaskGo/data"
+	"bitcaskGo/utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func TestDB_MMapActiveFile(t *testing.T) {
+	for _, indexerType := range []IndexerType{BTree, BPTree} {
+		opts := DefaultOptions
+		dir, _ := os.MkdirTemp("", "bitcask-go-mmap-active-file")
+		opts.DirPath = dir
+		opts.DataFileSize = 64 * 1024
+		opts.IndexerType = indexerType
+		opts.MMapActiveFile = true
+		db, err := Open(opts)
+		assert.Nil(t, err)
+
+		for i := 0; i < 1000; i++ {
+			err = db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+			assert.Nil(t, err)
+		}
+		for i := 0; i < 1000; i++ {
+			_, err = db.Get(utils.GetTestKey(i))
+			assert.Nil(t, err)
+		}
+		//the preallocated tails of older files are cut off
+		for fid := range db.olderFiles {
+			info, err := os.Stat(data.GetFileName(dir, fid))
+			assert.Nil(t, err)
+			assert.LessOrEqual(t, info.Size(), opts.DataFileSize)
+		}
+		activeFileName := data.GetFileName(dir, db.activeFile.Fileid)
+		writeOff := db.activeFile.WriteOff
+		err = db.Close()
+		assert.Nil(t, err)
+		info, err := os.Stat(activeFileName)
+		assert.Nil(t, err)
+		assert.Equal(t, writeOff, info.Size())
+
+		//the preallocated tail is left by a crash
+		err = os.Truncate(activeFileName, writeOff+4096)
+		assert.Nil(t, err)
+		db, err = Open(opts)
+		assert.Nil(t, err)
+		assert.Equal(t, writeOff, db.activeFile.WriteOff)
+		err = db.Put(utils.GetTestKey(1000), utils.RandomValue(128))
+		assert.Nil(t, err)
+		err = db.Close()
+		assert.Nil(t, err)
+
+		db, err = Open(opts)
+		assert.Nil(t, err)
+		for i := 0; i <= 1000; i++ {
+			_, err = db.Get(utils.GetTestKey(i))
+			assert.Nil(t, err)
+		}
+		destroyDB(db)
+	}
+}
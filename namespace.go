@@ -0,0 +1,314 @@
+package bitcaskGo
+
+import (
+	"bitcaskGo/data"
+	"bitcaskGo/index"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// the B plus tree index of each namespace is saved in its own sub directory
+const namespaceDirPrefix = "namespace-"
+
+// Namespace a named key space in the database,
+// it has its own index, thus its keys are separated from other namespaces
+type Namespace struct {
+	db      *DB
+	name    string
+	id      uint32        //persisted in each logRecord of the namespace
+	index   index.Indexer //Memory index of the namespace
+	dropped bool
+}
+
+// Namespace get the namespace by name, create a new one if it doesn't exist
+func (db *DB) Namespace(name string) (*Namespace, error) {
+	if name == "" {
+		return nil, ErrNamespaceNameIsEmpty
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if ns := db.namespaceByName(name); ns != nil {
+		return ns, nil
+	}
+
+	//namespace id is never reused, thus the data of a dropped namespace won't come back
+	id := db.maxNamespaceId + 1
+	if err := db.writeNamespaceRecord(&data.LogRecord{
+		Key:   []byte(name),
+		Value: []byte(strconv.FormatUint(uint64(id), 10)),
+		Type:  data.LogRecordNormal,
+	}); err != nil {
+		return nil, err
+	}
+	db.maxNamespaceId = id
+
+	idx, err := db.newNamespaceIndex(id)
+	if err != nil {
+		return nil, err
+	}
+	ns := &Namespace{db: db, name: name, id: id, index: idx}
+	db.namespaces[id] = ns
+	return ns, nil
+}
+
+// DropNamespace delete the namespace and all the data in it
+// the space is reclaimed by the next merge
+func (db *DB) DropNamespace(name string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	ns := db.namespaceByName(name)
+	if ns == nil {
+		return ErrNamespaceNotFound
+	}
+	if err := db.writeNamespaceRecord(&data.LogRecord{
+		Key:   []byte(name),
+		Value: []byte(strconv.FormatUint(uint64(ns.id), 10)),
+		Type:  data.LogRecordDeleted,
+	}); err != nil {
+		return err
+	}
+
+	//all the data of namespace can be reclaimed now
+	iterator := ns.index.Iterator(false)
+	for iterator.Rewind(); iterator.Valid(); iterator.Next() {
+		db.reclaimSize += int64(iterator.Value().Size)
+		db.removeLive(iterator.Value())
+	}
+	iterator.Close()
+
+	delete(db.namespaces, ns.id)
+	ns.dropped = true
+	if err := ns.index.Close(); err != nil {
+		return err
+	}
+	if db.options.IndexerType == BPTree {
+		return db.options.FileSystem.RemoveAll(db.namespaceDir(ns.id))
+	}
+	return nil
+}
+
+// Namespaces return the names of all namespaces
+func (db *DB) Namespaces() []string {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	names := make([]string, 0, len(db.namespaces))
+	for _, ns := range db.namespaces {
+		names = append(names, ns.name)
+	}
+	return names
+}
+
+// Name return the name of namespace
+func (ns *Namespace) Name() string {
+	return ns.name
+}
+
+// Put Write key/value data into namespace
+func (ns *Namespace) Put(key []byte, value []byte) error {
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+	if ns.isDropped() {
+		return ErrNamespaceDropped
+	}
+	//the namespace may be dropped before writing, it's checked again when updating index
+	return ns.db.put(ns.id, key, value, 0)
+}
+
+// Get the value of key in namespace
+func (ns *Namespace) Get(key []byte) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, ErrKeyIsEmpty
+	}
+	ns.db.mu.RLock()
+	defer ns.db.mu.RUnlock()
+	if ns.dropped {
+		return nil, ErrNamespaceDropped
+	}
+	return ns.db.getFromIndex(ns.index, key)
+}
+
+// Delete the key in namespace
+func (ns *Namespace) Delete(key []byte) error {
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+	if ns.isDropped() {
+		return ErrNamespaceDropped
+	}
+	return ns.db.delete(ns.id, key)
+}
+
+func (ns *Namespace) isDropped() bool {
+	ns.db.mu.RLock()
+	defer ns.db.mu.RUnlock()
+	return ns.dropped
+}
+
+// ListKeys get all keys in namespace, a dropped namespace has no keys
+func (ns *Namespace) ListKeys() [][]byte {
+	ns.db.mu.RLock()
+	defer ns.db.mu.RUnlock()
+	if ns.dropped {
+		return [][]byte{}
+	}
+	return ns.db.listKeys(ns.index)
+}
+
+// NewIterator iterate the keys in namespace, the iterator of a dropped namespace is empty
+func (ns *Namespace) NewIterator(opts IteratorOptions) *Iterator {
+	ns.db.mu.RLock()
+	defer ns.db.mu.RUnlock()
+	if ns.dropped {
+		return ns.db.newIterator(index.NewBtree(), opts)
+	}
+	return ns.db.newIterator(ns.index, opts)
+}
+
+// Fold get all data in namespace, and do specific operation user ask
+// when fn return false, shut down the traverse
+func (ns *Namespace) Fold(fn func(key []byte, value []byte) bool) error {
+	ns.db.mu.RLock()
+	defer ns.db.mu.RUnlock()
+	if ns.dropped {
+		return ErrNamespaceDropped
+	}
+	return ns.db.fold(ns.index, fn)
+}
+
+// get the index of namespace, nil means the namespace doesn't exist or has been dropped
+func (db *DB) indexOf(namespaceId uint32) index.Indexer {
+	if namespaceId == defaultNamespaceId {
+		return db.index
+	}
+	if namespaceId == chunkNamespaceId {
+		return db.chunkIndex
+	}
+	if ns, ok := db.namespaces[namespaceId]; ok {
+		return ns.index
+	}
+	return nil
+}
+
+// get all the indexes map by namespace id, the index of chunks included
+func (db *DB) indexes() map[uint32]index.Indexer {
+	indexes := map[uint32]index.Indexer{defaultNamespaceId: db.index, chunkNamespaceId: db.chunkIndex}
+	for id, ns := range db.namespaces {
+		indexes[id] = ns.index
+	}
+	return indexes
+}
+
+func (db *DB) namespaceByName(name string) *Namespace {
+	for _, ns := range db.namespaces {
+		if ns.name == name {
+			return ns
+		}
+	}
+	return nil
+}
+
+func (db *DB) namespaceDir(namespaceId uint32) string {
+	return filepath.Join(db.options.DirPath, namespaceDirPrefix+strconv.FormatUint(uint64(namespaceId), 10))
+}
+
+func (db *DB) newNamespaceIndex(namespaceId uint32) (index.Indexer, error) {
+	dirPath := db.options.DirPath
+	//B plus tree index is a file, each namespace needs its own directory
+	if db.options.IndexerType == BPTree {
+		dirPath = db.namespaceDir(namespaceId)
+		if err := db.options.FileSystem.MkdirAll(dirPath); err != nil {
+			return nil, err
+		}
+	}
+	idx := index.NewIndexer(db.options.IndexerType, dirPath, db.options.SyncWrites)
+	if err := db.enableBloomFilter(idx); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// append the creation or deletion of a namespace to the namespace file
+func (db *DB) writeNamespaceRecord(logRecord *data.LogRecord) error {
+	if db.options.ReadOnly {
+		return ErrDatabaseReadOnly
+	}
+	namespaceFile, err := data.OpenNamespaceFile(db.options.FileSystem, db.options.DirPath)
+	if err != nil {
+		return err
+	}
+	namespaceFile.Cipher = db.cipher
+	defer func() {
+		_ = namespaceFile.Close()
+	}()
+	encRecord, _ := data.EncodeLogRecord(logRecord)
+	if err := namespaceFile.Write(encRecord); err != nil {
+		return err
+	}
+	return namespaceFile.Sync()
+}
+
+// load the namespaces from namespace file, and create the indexes of new ones
+func (db *DB) loadNamespaces() error {
+	fileName := filepath.Join(db.options.DirPath, data.NamespaceFileName)
+	if _, err := db.options.FileSystem.Stat(fileName); os.IsNotExist(err) {
+		return nil
+	}
+	namespaceFile, err := data.OpenNamespaceFile(db.options.FileSystem, db.options.DirPath)
+	if err != nil {
+		return err
+	}
+	namespaceFile.Cipher = db.cipher
+	defer func() {
+		_ = namespaceFile.Close()
+	}()
+
+	names := make(map[uint32]string)
+	var offset int64 = 0
+	for {
+		logRecord, size, err := namespaceFile.ReadLogRecord(offset)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		id, err := strconv.ParseUint(string(logRecord.Value), 10, 32)
+		if err != nil {
+			return ErrDataDirectoryCorrupted
+		}
+		if logRecord.Type == data.LogRecordDeleted {
+			delete(names, uint32(id))
+		} else {
+			names[uint32(id)] = string(logRecord.Key)
+		}
+		if uint32(id) > db.maxNamespaceId {
+			db.maxNamespaceId = uint32(id)
+		}
+		offset += size
+	}
+
+	//the namespaces dropped by the writer since last load, when the read only database refreshes
+	for id, ns := range db.namespaces {
+		if _, ok := names[id]; !ok {
+			delete(db.namespaces, id)
+			ns.dropped = true
+			_ = ns.index.Close()
+		}
+	}
+	for id, name := range names {
+		if _, ok := db.namespaces[id]; ok {
+			continue
+		}
+		idx, err := db.newNamespaceIndex(id)
+		if err != nil {
+			return err
+		}
+		db.namespaces[id] = &Namespace{db: db, name: name, id: id, index: idx}
+	}
+	return nil
+}
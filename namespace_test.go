@@ -0,0 +1,169 @@
+package bitcaskGo
+
+import (
+	"bitcaskGo/utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDB_Namespace(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-namespace")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	_, err = db.Namespace("")
+	assert.Equal(t, ErrNamespaceNameIsEmpty, err)
+
+	users, err := db.Namespace("users")
+	assert.Nil(t, err)
+	orders, err := db.Namespace("orders")
+	assert.Nil(t, err)
+	users2, err := db.Namespace("users")
+	assert.Nil(t, err)
+	assert.Equal(t, users, users2)
+
+	//the same key in different namespaces
+	assert.Nil(t, db.Put(utils.GetTestKey(1), []byte("default")))
+	assert.Nil(t, users.Put(utils.GetTestKey(1), []byte("users")))
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, orders.Put(utils.GetTestKey(i), utils.RandomValue(24)))
+	}
+	assert.Nil(t, orders.Delete(utils.GetTestKey(9)))
+
+	val, err := db.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("default"), val)
+	val, err = users.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("users"), val)
+	_, err = users.Get(utils.GetTestKey(2))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	assert.Equal(t, 1, len(db.ListKeys()))
+	assert.Equal(t, 9, len(orders.ListKeys()))
+	var num int
+	err = orders.Fold(func(key []byte, value []byte) bool {
+		num++
+		return true
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 9, num)
+	iterator := users.NewIterator(DefaultIteratorOptions)
+	num = 0
+	for iterator.Rewind(); iterator.Valid(); iterator.Next() {
+		num++
+	}
+	iterator.Close()
+	assert.Equal(t, 1, num)
+
+	stat := db.Stat()
+	assert.Equal(t, uint(11), stat.KeyNum)
+	assert.Equal(t, uint(1), stat.NamespaceKeyNum["users"])
+	assert.Equal(t, uint(9), stat.NamespaceKeyNum["orders"])
+
+	//restart, the index of namespaces is rebuilt
+	assert.Nil(t, db.Close())
+	db2, err := Open(opts)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"users", "orders"}, db2.Namespaces())
+	users, err = db2.Namespace("users")
+	assert.Nil(t, err)
+	val, err = users.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("users"), val)
+	orders, err = db2.Namespace("orders")
+	assert.Nil(t, err)
+	assert.Equal(t, 9, len(orders.ListKeys()))
+	val, err = db2.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("default"), val)
+	assert.Nil(t, db2.Close())
+}
+
+func TestDB_DropNamespace(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-namespace-drop")
+	opts.DirPath = dir
+	opts.DataFileMergeRatio = 0
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	err = db.DropNamespace("unknown")
+	assert.Equal(t, ErrNamespaceNotFound, err)
+
+	users, err := db.Namespace("users")
+	assert.Nil(t, err)
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, users.Put(utils.GetTestKey(i), utils.RandomValue(24)))
+	}
+	assert.Nil(t, db.Put(utils.GetTestKey(1), utils.RandomValue(24)))
+
+	err = db.DropNamespace("users")
+	assert.Nil(t, err)
+	assert.True(t, db.Stat().ReclaimableSize > 0)
+	_, err = users.Get(utils.GetTestKey(1))
+	assert.Equal(t, ErrNamespaceDropped, err)
+	assert.Equal(t, ErrNamespaceDropped, users.Put(utils.GetTestKey(1), nil))
+	assert.Equal(t, 0, len(users.ListKeys()))
+	iterator := users.NewIterator(DefaultIteratorOptions)
+	iterator.Rewind()
+	assert.False(t, iterator.Valid())
+	iterator.Close()
+
+	//the namespace with same name is a new one, old data doesn't come back
+	users2, err := db.Namespace("users")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(users2.ListKeys()))
+	assert.Nil(t, users2.Put(utils.GetTestKey(200), []byte("new")))
+
+	err = db.Merge()
+	assert.Nil(t, err)
+	assert.Nil(t, db.Close())
+
+	db2, err := Open(opts)
+	assert.Nil(t, err)
+	users3, err := db2.Namespace("users")
+	assert.Nil(t, err)
+	keys := users3.ListKeys()
+	assert.Equal(t, 1, len(keys))
+	assert.Equal(t, utils.GetTestKey(200), keys[0])
+	assert.Equal(t, 1, len(db2.ListKeys()))
+	assert.Nil(t, db2.Close())
+}
+
+func TestDB_NamespaceEncryption(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-namespace-encryption")
+	opts.DirPath = dir
+	opts.EncryptionKey = []byte(strings.Repeat("k", 32))
+	db, err := Open(opts)
+	assert.Nil(t, err)
+
+	//the namespace file is appended, each record is sealed with its real offset
+	users, err := db.Namespace("users")
+	assert.Nil(t, err)
+	orders, err := db.Namespace("orders")
+	assert.Nil(t, err)
+	assert.Nil(t, users.Put(utils.GetTestKey(1), []byte("users")))
+	assert.Nil(t, orders.Put(utils.GetTestKey(1), []byte("orders")))
+	err = db.Close()
+	assert.Nil(t, err)
+
+	db, err = Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"users", "orders"}, db.Namespaces())
+	orders, err = db.Namespace("orders")
+	assert.Nil(t, err)
+	val, err := orders.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("orders"), val)
+}
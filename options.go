@@ -1,11 +1,20 @@
 package bitcaskGo
 
-import "os"
+import (
+	"bitcaskGo/data"
+	"bitcaskGo/fileio"
+	"os"
+	"time"
+)
 
 type Options struct {
 	//Database 's data 's directory
 	DirPath string
 
+	//the file system which the files live in, nil means the file system of operating system,
+	//the b plus tree index only works on the file system of operating system
+	FileSystem fileio.FileSystem
+
 	//DataFile size
 	DataFileSize int64
 
@@ -15,14 +24,86 @@ type Options struct {
 	//do the sync operation when bytes accumulate to this option
 	BytesPerSync uint
 
+	//sync the active file in background at this interval, 0 means no background sync,
+	//bound the data lost by a crash when SyncWrites is off
+	SyncInterval time.Duration
+
 	// the type of indexer
 	IndexerType IndexerType
 
 	//whether we need mmap when start or not
 	MMapAtStartup bool
 
+	//write the active file by memory map, the file is grown in chunks,
+	//the preallocated tail is cut off when the file is closed or the database is opened after crash
+	MMapActiveFile bool
+
+	//preallocate every new data file to DataFileSize, thus the file isn't fragmented,
+	//the slack is cut off when the file is sealed
+	PreallocateDataFile bool
+
+	//max number of older data files kept open, 0 means no limit,
+	//the least recently used ones are closed, and opened again when they're read
+	MaxOpenFiles int
+
 	//threshold for data file merging
 	DataFileMergeRatio float32
+
+	//the compression of values, files written with other compression stay readable
+	Compression CompressionType
+
+	//AES key to encrypt all the files, 16, 24 or 32 bytes, nil means no encryption
+	//it must be set when the data directory is created, b plus tree index isn't supported because it saves the keys in plaintext
+	EncryptionKey []byte
+
+	//the keys used before EncryptionKey, only for decrypting,
+	//Merge rewrites the files by EncryptionKey, after that the old keys are useless
+	OldEncryptionKeys [][]byte
+
+	//open the database without the directory lock, thus it can be read while another process writes it,
+	//all the writes are rejected, call DB.Refresh to load the data appended by the writer
+	ReadOnly bool
+
+	//check whether to merge in background at this interval, 0 means no auto merge,
+	//DataFileMergeRatio is checked as manual Merge does
+	AutoMergeInterval time.Duration
+
+	//auto merge only runs in these periods of the day, empty means any time
+	AutoMergeWindows []MergeWindow
+
+	//auto merge only runs when the reclaimable size reaches it
+	AutoMergeMinReclaimBytes int64
+
+	//when it's greater than 0, Merge only compacts the older files whose dead ratio reaches it,
+	//DataFileMergeRatio is not checked then
+	MergeFileDeadRatio float32
+
+	//save the in-memory index into a checkpoint file at this interval, 0 means no checkpoint,
+	//Open loads the checkpoint and only replays the logRecords written after it,
+	//the B plus tree index is saved on disk already, thus it's not supported
+	IndexCheckpointInterval time.Duration
+
+	//the number of data files decoded at the same time when open, 0 or 1 means one by one, which is the default,
+	//the logRecords are still applied to index in file id order
+	IndexLoadConcurrency int
+
+	//the expected number of keys of the bloom filter for B plus tree index, 0 means no bloom filter,
+	//the lookups of absent keys are answered by the filter without reading the index file
+	BloomFilterExpectedKeys uint
+
+	//the false positive rate of bloom filter when the number of keys is as expected
+	BloomFilterFalsePositiveRate float64
+
+	//max bytes of the values cached in memory, 0 means no cache,
+	//the hot values are read without touching the data files
+	ValueCacheSize int64
+
+	//the values longer than it are saved in blob files, 0 means the values are always saved in data files,
+	//merge only rewrites the pointers of them, the blob files are compacted by CompactBlobs
+	BlobThreshold int64
+
+	//CompactBlobs only compacts the blob files whose dead ratio reaches it
+	BlobGCRatio float32
 }
 
 type IndexerType = int8
@@ -36,6 +117,17 @@ const (
 	BPTree
 )
 
+type CompressionType = data.CompressionType
+
+const (
+	// NoCompression save the value as it is
+	NoCompression = data.NoCompression
+	// Snappy compress the value by snappy, fast but lower ratio
+	Snappy = data.SnappyCompression
+	// Zstd compress the value by zstd, higher ratio
+	Zstd = data.ZstdCompression
+)
+
 type IteratorOptions struct {
 	//traverse keys have the Prefix, default is nil
 	Prefix []byte
@@ -54,12 +146,18 @@ type WriteBatchOptions struct {
 
 var DefaultOptions = Options{
 	DirPath:            os.TempDir(),
+	FileSystem:         fileio.OSFileSystem,
 	DataFileSize:       256 * 1024 * 1024,
 	SyncWrites:         false,
 	BytesPerSync:       0,
 	IndexerType:        BTree,
 	MMapAtStartup:      true,
 	DataFileMergeRatio: 0.5,
+	Compression:        NoCompression,
+
+	IndexLoadConcurrency:         1,
+	BloomFilterFalsePositiveRate: 0.01,
+	BlobGCRatio:                  0.5,
 }
 
 var DefaultIteratorOptions = IteratorOptions{
@@ -0,0 +1,76 @@
+package bitcaskGo
+
+import (
+	"bitcaskGo/data"
+	"bitcaskGo/utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDB_PreallocateDataFile(t *testing.T) {
+	for _, encryptionKey := range [][]byte{nil, []byte(strings.Repeat("k", 32))} {
+		opts := DefaultOptions
+		dir, _ := os.MkdirTemp("", "bitcask-go-preallocate")
+		opts.DirPath = dir
+		opts.DataFileSize = 64 * 1024
+		opts.PreallocateDataFile = true
+		opts.EncryptionKey = encryptionKey
+		db, err := Open(opts)
+		assert.Nil(t, err)
+
+		err = db.Put(utils.GetTestKey(0), utils.RandomValue(128))
+		assert.Nil(t, err)
+		info, err := os.Stat(data.GetFileName(dir, db.activeFile.Fileid))
+		assert.Nil(t, err)
+		assert.Equal(t, opts.DataFileSize, info.Size())
+
+		for i := 1; i < 1000; i++ {
+			err = db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+			assert.Nil(t, err)
+		}
+		//the sealed files never exceed the limit, the slack is cut off
+		assert.True(t, len(db.olderFiles) > 0)
+		for fid, dataFile := range db.olderFiles {
+			info, err := os.Stat(data.GetFileName(dir, fid))
+			assert.Nil(t, err)
+			assert.Equal(t, dataFile.WriteOff, info.Size())
+			assert.LessOrEqual(t, info.Size(), opts.DataFileSize)
+		}
+
+		//the logRecord bigger than the limit is written into a file alone
+		err = db.Put(utils.GetTestKey(1000), utils.RandomValue(int(opts.DataFileSize)))
+		assert.Nil(t, err)
+		for _, dataFile := range db.olderFiles {
+			assert.True(t, dataFile.WriteOff > 0)
+		}
+
+		activeFileName := data.GetFileName(dir, db.activeFile.Fileid)
+		writeOff := db.activeFile.WriteOff
+		err = db.Close()
+		assert.Nil(t, err)
+		info, err = os.Stat(activeFileName)
+		assert.Nil(t, err)
+		assert.Equal(t, writeOff, info.Size())
+
+		//the preallocated tail is left by a crash, the index stops at the logical end
+		err = os.Truncate(activeFileName, writeOff+opts.DataFileSize)
+		assert.Nil(t, err)
+		db, err = Open(opts)
+		assert.Nil(t, err)
+		assert.Equal(t, writeOff, db.activeFile.WriteOff)
+		err = db.Put(utils.GetTestKey(1001), utils.RandomValue(128))
+		assert.Nil(t, err)
+		err = db.Close()
+		assert.Nil(t, err)
+
+		db, err = Open(opts)
+		assert.Nil(t, err)
+		for i := 0; i <= 1001; i++ {
+			_, err = db.Get(utils.GetTestKey(i))
+			assert.Nil(t, err)
+		}
+		destroyDB(db)
+	}
+}
@@ -0,0 +1,104 @@
+package bitcaskGo
+
+import (
+	"bitcaskGo/data"
+	"bitcaskGo/fileio"
+	"os"
+	"path/filepath"
+)
+
+// Refresh load the logRecords appended by the writer since the read only database was opened or last refreshed
+// it returns ErrDataFilesReplaced if the writer has installed a merge, the database must be reopened then
+func (db *DB) Refresh() error {
+	//the writer always sees its own writes
+	if !db.options.ReadOnly {
+		return nil
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	//the merged files reuse the ids of old files, they can't be read incrementally
+	mergeFinishedFile, _ := db.options.FileSystem.Stat(filepath.Join(db.options.DirPath, data.MergeFinishedFileName))
+	if (mergeFinishedFile == nil) != (db.mergeFinishedFile == nil) ||
+		(mergeFinishedFile != nil && !fileio.SameFile(mergeFinishedFile, db.mergeFinishedFile)) {
+		return ErrDataFilesReplaced
+	}
+	//the selective merge writes no merge finished file, the files replaced or deleted tell it
+	for fid, info := range db.dataFileInfos {
+		currInfo, err := db.options.FileSystem.Stat(data.GetFileName(db.options.DirPath, fid))
+		if err != nil || !fileio.SameFile(currInfo, info) {
+			return ErrDataFilesReplaced
+		}
+	}
+
+	//the namespaces created by the writer, their logRecords are loaded below
+	if err := db.loadNamespaces(); err != nil {
+		return err
+	}
+
+	//the blob files created by the writer, the new logRecords may point to them
+	if err := db.loadBlobFiles(); err != nil {
+		return err
+	}
+
+	//continue reading the last file from where we stopped
+	if db.activeFile != nil {
+		offset, err := db.loadIndexFromDataFile(db.activeFile, db.activeFile.WriteOff)
+		if err != nil {
+			return err
+		}
+		db.activeFile.WriteOff = offset
+	}
+
+	//the new files created by the writer
+	fileIds, err := getDataFileIds(db.options.FileSystem, db.options.DirPath)
+	if err != nil {
+		return err
+	}
+	for _, fid := range fileIds {
+		if db.activeFile != nil && uint32(fid) <= db.activeFile.Fileid {
+			continue
+		}
+		info, err := db.options.FileSystem.Stat(data.GetFileName(db.options.DirPath, uint32(fid)))
+		if err != nil {
+			return err
+		}
+		db.dataFileInfos[uint32(fid)] = info
+		dataFile, err := data.OpenDataFile(db.options.FileSystem, db.options.DirPath, uint32(fid), fileio.StandardFIO)
+		if err != nil {
+			return err
+		}
+		dataFile.Cipher = db.cipher
+		if db.activeFile != nil {
+			if err := db.sealDataFile(db.activeFile); err != nil {
+				return err
+			}
+			db.olderFiles[db.activeFile.Fileid] = db.activeFile
+		}
+		db.activeFile = dataFile
+
+		offset, err := db.loadIndexFromDataFile(dataFile, 0)
+		if err != nil {
+			return err
+		}
+		dataFile.WriteOff = offset
+	}
+	return nil
+}
+
+// the files of all data files in the directory
+func (db *DB) statDataFiles() (map[uint32]os.FileInfo, error) {
+	fileIds, err := getDataFileIds(db.options.FileSystem, db.options.DirPath)
+	if err != nil {
+		return nil, err
+	}
+	infos := make(map[uint32]os.FileInfo, len(fileIds))
+	for _, fid := range fileIds {
+		info, err := db.options.FileSystem.Stat(data.GetFileName(db.options.DirPath, uint32(fid)))
+		if err != nil {
+			return nil, err
+		}
+		infos[uint32(fid)] = info
+	}
+	return infos, nil
+}
@@ -0,0 +1,195 @@
+package bitcaskGo
+
+import (
+	"bitcaskGo/data"
+	"bitcaskGo/utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDB_ReadOnly(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-readonly")
+	opts.DirPath = dir
+	opts.DataFileSize = 32 * 1024
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 100; i++ {
+		err = db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+		assert.Nil(t, err)
+	}
+
+	//the reader can open the directory used by writer
+	readOpts := opts
+	readOpts.ReadOnly = true
+	reader, err := Open(readOpts)
+	assert.Nil(t, err)
+	for i := 0; i < 100; i++ {
+		_, err := reader.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+	}
+
+	//all the writes are rejected
+	assert.Equal(t, ErrDatabaseReadOnly, reader.Put(utils.GetTestKey(1), utils.RandomValue(10)))
+	assert.Equal(t, ErrDatabaseReadOnly, reader.Delete(utils.GetTestKey(1)))
+	assert.Equal(t, ErrDatabaseReadOnly, reader.Merge())
+	_, err = reader.Namespace("ns")
+	assert.Equal(t, ErrDatabaseReadOnly, err)
+	_, err = reader.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.Equal(t, ErrDatabaseReadOnly, err)
+	readerTxn := reader.Begin()
+	_, err = readerTxn.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, ErrDatabaseReadOnly, readerTxn.Put(utils.GetTestKey(1), utils.RandomValue(10)))
+	assert.Nil(t, readerTxn.Commit())
+
+	//the writer appends into new files
+	for i := 100; i < 500; i++ {
+		err = db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+		assert.Nil(t, err)
+	}
+	err = db.Delete(utils.GetTestKey(0))
+	assert.Nil(t, err)
+	wb, err := db.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.Nil(t, err)
+	err = wb.Put(utils.GetTestKey(1000), []byte("batch"))
+	assert.Nil(t, err)
+	err = wb.Commit()
+	assert.Nil(t, err)
+	ns, err := db.Namespace("ns")
+	assert.Nil(t, err)
+	err = ns.Put([]byte("name"), []byte("bitcask"))
+	assert.Nil(t, err)
+
+	_, err = reader.Get(utils.GetTestKey(499))
+	assert.Equal(t, ErrKeyNotFound, err)
+	err = reader.Refresh()
+	assert.Nil(t, err)
+	for i := 1; i < 500; i++ {
+		_, err := reader.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+	}
+	_, err = reader.Get(utils.GetTestKey(0))
+	assert.Equal(t, ErrKeyNotFound, err)
+	val, err := reader.Get(utils.GetTestKey(1000))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("batch"), val)
+	readerNs, err := reader.Namespace("ns")
+	assert.Nil(t, err)
+	val, err = readerNs.Get([]byte("name"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("bitcask"), val)
+
+	//nothing new
+	err = reader.Refresh()
+	assert.Nil(t, err)
+	assert.Equal(t, db.Stat().KeyNum, reader.Stat().KeyNum)
+
+	//closing the reader doesn't release the writer's lock
+	err = reader.Close()
+	assert.Nil(t, err)
+	_, err = Open(opts)
+	assert.Equal(t, ErrDataBaseisUsing, err)
+	_, err = os.Stat(filepath.Join(dir, fileLockName))
+	assert.Nil(t, err)
+}
+
+func TestDB_ReadOnlyAfterMerge(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-readonly")
+	opts.DirPath = dir
+	opts.DataFileMergeRatio = 0
+	db, err := Open(opts)
+	assert.Nil(t, err)
+
+	for i := 0; i < 100; i++ {
+		err = db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+		assert.Nil(t, err)
+	}
+	readOpts := opts
+	readOpts.ReadOnly = true
+	reader, err := Open(readOpts)
+	assert.Nil(t, err)
+
+	//the merged files are installed when the writer opens again
+	err = db.Merge()
+	assert.Nil(t, err)
+	err = db.Close()
+	assert.Nil(t, err)
+	db, err = Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	err = reader.Refresh()
+	assert.Equal(t, ErrDataFilesReplaced, err)
+	assert.Nil(t, reader.Close())
+
+	reader, err = Open(readOpts)
+	assert.Nil(t, err)
+	for i := 0; i < 100; i++ {
+		_, err := reader.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, reader.Close())
+
+	//there is nothing to read
+	readOpts.DirPath = filepath.Join(dir, "not-exist")
+	_, err = Open(readOpts)
+	assert.NotNil(t, err)
+}
+
+func TestDB_ReadOnlyAfterSelectiveMerge(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-readonly-selective")
+	opts.DirPath = dir
+	opts.DataFileSize = 8 * 1024
+	opts.DataFileMergeRatio = 0
+	opts.MergeFileDeadRatio = 0.5
+	db, err := Open(opts)
+	assert.Nil(t, err)
+
+	for i := 0; i < 200; i++ {
+		err = db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+		assert.Nil(t, err)
+	}
+	//most of the older files are dead
+	for i := 0; i < 200; i++ {
+		if i%4 != 0 {
+			err = db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+			assert.Nil(t, err)
+		}
+	}
+	readOpts := opts
+	readOpts.ReadOnly = true
+	reader, err := Open(readOpts)
+	assert.Nil(t, err)
+
+	//the new files take the ids of the old ones, no merge finished file is written
+	err = db.Merge()
+	assert.Nil(t, err)
+	err = db.Close()
+	assert.Nil(t, err)
+	_, err = os.Stat(filepath.Join(dir, data.MergeFinishedFileName))
+	assert.True(t, os.IsNotExist(err))
+	db, err = Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	err = reader.Refresh()
+	assert.Equal(t, ErrDataFilesReplaced, err)
+	assert.Nil(t, reader.Close())
+
+	reader, err = Open(readOpts)
+	assert.Nil(t, err)
+	for i := 0; i < 200; i++ {
+		_, err := reader.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+	}
+	err = reader.Refresh()
+	assert.Nil(t, err)
+	assert.Nil(t, reader.Close())
+}
@@ -119,7 +119,10 @@ func (rds *RedisDataStructure) HSet(key, field, value []byte) (bool, error) {
 		exist = false
 	}
 
-	wb := rds.db.NewWriteBatch(bitcaskGo.DefaultWriteBatchOptions)
+	wb, err := rds.db.NewWriteBatch(bitcaskGo.DefaultWriteBatchOptions)
+	if err != nil {
+		return false, err
+	}
 	//if it doesn't exist,update the size in metadata
 	if !exist {
 		metadata.size++
@@ -182,7 +185,10 @@ func (rds *RedisDataStructure) HDel(key, field []byte) (bool, error) {
 
 	//only when it exists, can it be deleted
 	if exist {
-		wb := rds.db.NewWriteBatch(bitcaskGo.DefaultWriteBatchOptions)
+		wb, err := rds.db.NewWriteBatch(bitcaskGo.DefaultWriteBatchOptions)
+		if err != nil {
+			return false, err
+		}
 		metadata.size--
 		_ = wb.Put(key, metadata.encode())
 		_ = wb.Delete(key)
@@ -212,7 +218,10 @@ func (rds *RedisDataStructure) SAdd(key, member []byte) (bool, error) {
 	//check if the sik exists
 	if _, err = rds.db.Get(sik.encode()); err == bitcaskGo.ErrKeyNotFound {
 		//if the sik doesn't exist, construct a new one
-		wb := rds.db.NewWriteBatch(bitcaskGo.DefaultWriteBatchOptions)
+		wb, err := rds.db.NewWriteBatch(bitcaskGo.DefaultWriteBatchOptions)
+		if err != nil {
+			return false, err
+		}
 		metadata.size++
 		_ = wb.Put(key, metadata.encode())
 		_ = wb.Put(sik.encode(), nil)
@@ -274,7 +283,10 @@ func (rds *RedisDataStructure) SRem(key, member []byte) (bool, error) {
 	}
 
 	//update
-	wb := rds.db.NewWriteBatch(bitcaskGo.DefaultWriteBatchOptions)
+	wb, err := rds.db.NewWriteBatch(bitcaskGo.DefaultWriteBatchOptions)
+	if err != nil {
+		return false, err
+	}
 	metadata.size--
 	_ = wb.Put(key, metadata.encode())
 	_ = wb.Delete(sik.encode())
@@ -321,7 +333,10 @@ func (rds *RedisDataStructure) pushInner(key, element []byte, isLeft bool) (uint
 	}
 
 	//update the metadata and data part
-	wb := rds.db.NewWriteBatch(bitcaskGo.DefaultWriteBatchOptions)
+	wb, err := rds.db.NewWriteBatch(bitcaskGo.DefaultWriteBatchOptions)
+	if err != nil {
+		return 0, err
+	}
 	metadata.size++
 	if isLeft {
 		//push from left
@@ -411,7 +426,10 @@ func (rds *RedisDataStructure) ZAdd(key []byte, score float64, member []byte) (b
 		}
 	}
 
-	wb := rds.db.NewWriteBatch(bitcaskGo.DefaultWriteBatchOptions)
+	wb, err := rds.db.NewWriteBatch(bitcaskGo.DefaultWriteBatchOptions)
+	if err != nil {
+		return false, err
+	}
 	if !exist {
 		metadata.size++
 		_ = wb.Put(key, metadata.encode())
@@ -0,0 +1,345 @@
+package bitcaskGo
+
+import (
+	"bitcaskGo/data"
+	"bitcaskGo/fileio"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const mergeSelectedKey = "merge-selected"
+
+// merge only the older files whose dead ratio reaches MergeFileDeadRatio
+// the live logRecords of a group of files are rewritten into one file, which takes the biggest file id of the group,
+// thus the new file keeps its order with other files when loading,
+// like the whole merge, the new files are moved into data directory when the database is opened next time
+func (db *DB) mergeSelectedFiles() error {
+	db.mu.Lock()
+	//if the database is merging, return directly
+	if db.isMerging {
+		db.mu.Unlock()
+		return ErrMergeIsProcessing
+	}
+
+	//the expired keys can be reclaimed as well
+	db.reclaimExpiredKeys()
+
+	groups, olderFileIds, err := db.pickMergeGroups()
+	if err != nil {
+		db.mu.Unlock()
+		return err
+	}
+	if len(groups) == 0 {
+		db.mu.Unlock()
+		return ErrMergeRatioUnreached
+	}
+
+	//check if the available disk size big enough to hold the live data of the files,
+	//the rest of the files is reclaimed
+	var mergingSize, reclaimedSize int64
+	for _, group := range groups {
+		for _, dataFile := range group {
+			size, err := dataFile.IOManager.Size()
+			if err != nil {
+				db.mu.Unlock()
+				return err
+			}
+			mergingSize += db.liveBytes[dataFile.Fileid]
+			reclaimedSize += size - db.liveBytes[dataFile.Fileid]
+		}
+	}
+	availableDiskSize, err := db.options.FileSystem.AvailableSize(db.options.DirPath)
+	if err != nil {
+		db.mu.Unlock()
+		return err
+	}
+	if uint64(mergingSize) >= availableDiskSize {
+		db.mu.Unlock()
+		return ErrNotEnoughSpaceForMerging
+	}
+
+	db.isMerging = true
+	defer func() {
+		//set the flag when process ends
+		db.isMerging = false
+	}()
+	//the older files are never written, they can be read without lock
+	db.mu.Unlock()
+
+	mergePath := db.getMergePath()
+	if err := db.options.FileSystem.RemoveAll(mergePath); err != nil {
+		return err
+	}
+	if err := db.options.FileSystem.MkdirAll(mergePath); err != nil {
+		return err
+	}
+
+	merged := make(map[uint32]bool)
+	for _, group := range groups {
+		for _, dataFile := range group {
+			merged[dataFile.Fileid] = true
+		}
+	}
+	//the B plus tree index needs the new positions to be rewritten when the new files are moved
+	var hintFile *data.Datafile
+	if db.options.IndexerType == BPTree {
+		if hintFile, err = data.OpenHintFile(db.options.FileSystem, mergePath); err != nil {
+			return err
+		}
+		hintFile.Cipher = db.cipher
+		defer func() {
+			_ = hintFile.Close()
+		}()
+	}
+	for _, group := range groups {
+		//the deleted logRecords must be kept if the older values may be still in the files not merged
+		targetId := group[len(group)-1].Fileid
+		var keepDeleted bool
+		for _, fid := range olderFileIds {
+			if fid < targetId && !merged[fid] {
+				keepDeleted = true
+				break
+			}
+		}
+		if err := db.mergeFileGroup(mergePath, group, keepDeleted, hintFile); err != nil {
+			return err
+		}
+	}
+	if hintFile != nil {
+		if err := hintFile.Sync(); err != nil {
+			return err
+		}
+	}
+
+	//the dropped logRecords are overwritten by the newer ones, which may be in active file,
+	//they must be durable before the merge completes, otherwise a crash loses the key
+	if err := db.Sync(); err != nil {
+		return err
+	}
+
+	//write the ids of the files which are replaced by the new files,
+	//it also signifies the merge process has finished
+	mergeSelectedFile, err := data.OpenMergeSelectedFile(db.options.FileSystem, mergePath)
+	if err != nil {
+		return err
+	}
+	mergeSelectedFile.Cipher = db.cipher
+	defer func() {
+		_ = mergeSelectedFile.Close()
+	}()
+	for _, group := range groups {
+		for _, dataFile := range group[:len(group)-1] {
+			encRecord, _ := data.EncodeLogRecord(&data.LogRecord{
+				Key:   []byte(mergeSelectedKey),
+				Value: []byte(strconv.FormatUint(uint64(dataFile.Fileid), 10)),
+			})
+			if err := mergeSelectedFile.Write(encRecord); err != nil {
+				return err
+			}
+		}
+	}
+	//the last logRecord tells all the ids are written, the file may be cut off by a crash before it's synced
+	encRecord, _ := data.EncodeLogRecord(&data.LogRecord{Key: []byte(mergeFinishedKey)})
+	if err := mergeSelectedFile.Write(encRecord); err != nil {
+		return err
+	}
+	if err := mergeSelectedFile.Sync(); err != nil {
+		return err
+	}
+
+	db.finishMerge(reclaimedSize)
+	return nil
+}
+
+// pick the older files whose dead ratio reaches the option, and group them,
+// the live data of each group fits in a data file, also return the ids of all older files
+// we must have mutex lock when we use this method
+func (db *DB) pickMergeGroups() ([][]*data.Datafile, []uint32, error) {
+	stats, err := db.fileStats(false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	//the files merged as a whole are indexed by hint file, leave them to the next whole merge
+	var nonMergeFileId uint32
+	if _, err := db.options.FileSystem.Stat(filepath.Join(db.options.DirPath, data.MergeFinishedFileName)); err == nil {
+		if nonMergeFileId, err = db.getNonMergeFileId(db.options.DirPath); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var groups [][]*data.Datafile
+	var group []*data.Datafile
+	var groupSize int64
+	olderFileIds := make([]uint32, 0, len(stats))
+	for _, stat := range stats {
+		olderFileIds = append(olderFileIds, stat.FileId)
+		if stat.FileId < nonMergeFileId || stat.Size == 0 || stat.DeadRatio() < db.options.MergeFileDeadRatio {
+			continue
+		}
+		if len(group) > 0 && groupSize+stat.LiveBytes > db.options.DataFileSize {
+			groups = append(groups, group)
+			group, groupSize = nil, 0
+		}
+		group = append(group, db.olderFiles[stat.FileId])
+		groupSize += stat.LiveBytes
+	}
+	if len(group) > 0 {
+		groups = append(groups, group)
+	}
+	return groups, olderFileIds, nil
+}
+
+// rewrite the live logRecords of the group into a new file in merge directory,
+// the new file takes the biggest file id of the group, the new positions are written into hintFile if it isn't nil
+func (db *DB) mergeFileGroup(mergePath string, group []*data.Datafile, keepDeleted bool, hintFile *data.Datafile) error {
+	mergeFile, err := data.OpenDataFile(db.options.FileSystem, mergePath, group[len(group)-1].Fileid, fileio.StandardFIO)
+	if err != nil {
+		return err
+	}
+	mergeFile.Cipher = db.cipher
+	defer func() {
+		_ = mergeFile.Close()
+	}()
+
+	deletedKeys := make(map[string]bool)
+	for _, dataFile := range group {
+		var offset int64 = 0
+		for {
+			logRecord, size, err := dataFile.ReadLogRecord(offset)
+			if err != nil {
+				if err == io.EOF {
+					break
+				}
+				return err
+			}
+			recordOffset := offset
+			offset += size
+			if logRecord.Type == data.LogRecordTxnFinished {
+				continue
+			}
+
+			realKey, _ := parselogRecordKey(logRecord.Key)
+			logRecordPos := db.getPosition(logRecord.NamespaceId, realKey)
+			isLive := logRecordPos != nil &&
+				logRecordPos.FileId == dataFile.Fileid &&
+				logRecordPos.Offset == recordOffset &&
+				!isExpired(logRecordPos)
+			if isLive {
+				//clean the transaction flag
+				logRecord.Key = logRecordKeyWithSeq(realKey, nonTransactionSeqNo)
+			} else {
+				//the key is deleted or expired, write a deleted logRecord once,
+				//thus the older values won't come back when loading
+				//the dead logRecords whose key has a newer value are dropped
+				deletedKey := strconv.FormatUint(uint64(logRecord.NamespaceId), 10) + ":" + string(realKey)
+				if !keepDeleted || logRecordPos != nil || deletedKeys[deletedKey] {
+					continue
+				}
+				deletedKeys[deletedKey] = true
+				logRecord = &data.LogRecord{
+					Key:         logRecordKeyWithSeq(realKey, nonTransactionSeqNo),
+					Type:        data.LogRecordDeleted,
+					NamespaceId: logRecord.NamespaceId,
+				}
+			}
+
+			encRecord, _, err := db.encodeLogRecord(logRecord)
+			if err != nil {
+				return err
+			}
+			writeOff := mergeFile.WriteOff
+			if err := mergeFile.Write(encRecord); err != nil {
+				return err
+			}
+			if isLive && hintFile != nil {
+				pos := newLogRecordPos(mergeFile.Fileid, writeOff, mergeFile.WriteOff-writeOff, logRecord)
+				if err := hintFile.WriteHintRecord(realKey, logRecord.NamespaceId, pos); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return mergeFile.Sync()
+}
+
+// read the ids of the files replaced by selective merge, finished tells whether the file is completely written
+func (db *DB) readMergeSelectedFile(mergePath string) (replacedIds []uint32, finished bool, err error) {
+	mergeSelectedFile, err := data.OpenMergeSelectedFile(db.options.FileSystem, mergePath)
+	if err != nil {
+		return nil, false, err
+	}
+	mergeSelectedFile.Cipher = db.cipher
+	defer func() {
+		_ = mergeSelectedFile.Close()
+	}()
+	var offset int64 = 0
+	for {
+		logRecord, size, err := mergeSelectedFile.ReadLogRecord(offset)
+		if err != nil {
+			if err == io.EOF {
+				return nil, false, nil
+			}
+			return nil, false, err
+		}
+		offset += size
+		if string(logRecord.Key) == mergeFinishedKey {
+			return replacedIds, true, nil
+		}
+		fid, err := strconv.ParseUint(string(logRecord.Value), 10, 32)
+		if err != nil {
+			return nil, false, ErrDataDirectoryCorrupted
+		}
+		replacedIds = append(replacedIds, uint32(fid))
+	}
+}
+
+// move the files of selective merge into data directory, replacedIds are the files deleted after that
+func (db *DB) loadSelectedMergeFiles(mergePath string, mergeFileNames []string, replacedIds []uint32) error {
+	//the B plus tree index isn't rebuilt when open, update it before the files are replaced
+	if db.options.IndexerType == BPTree {
+		replaced := make(map[uint32]bool)
+		for _, fid := range replacedIds {
+			replaced[fid] = true
+		}
+		for _, fileName := range mergeFileNames {
+			if strings.HasSuffix(fileName, data.DataFileNameSuffix) {
+				fid, err := strconv.Atoi(strings.TrimSuffix(fileName, data.DataFileNameSuffix))
+				if err != nil {
+					return ErrDataDirectoryCorrupted
+				}
+				replaced[uint32(fid)] = true
+			}
+		}
+		if err := db.rewriteIndexFromHint(mergePath, func(fileId uint32) bool {
+			return replaced[fileId]
+		}); err != nil {
+			return err
+		}
+	}
+
+	//move the new files first, each of them replaces the biggest file of its group,
+	//then delete the other files of groups, it's safe to do it again if we crash in the middle
+	for _, fileName := range mergeFileNames {
+		//the hint file of selective merge is only used to rewrite B plus tree index
+		if fileName == data.MergeSelectedFileName || fileName == data.HintFileName {
+			continue
+		}
+		srcPath := filepath.Join(mergePath, fileName)
+		desPath := filepath.Join(db.options.DirPath, fileName)
+		if err := db.options.FileSystem.Rename(srcPath, desPath); err != nil {
+			return err
+		}
+	}
+	//the files are only deleted when open, thus the snapshots never lose the files they read
+	for _, fid := range replacedIds {
+		fileName := data.GetFileName(db.options.DirPath, fid)
+		if err := db.options.FileSystem.Remove(fileName); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package bitcaskGo
+
+import (
+	"bitcaskGo/data"
+	"bitcaskGo/utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func TestDB_FileStats(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-file-stat")
+	opts.DirPath = dir
+	opts.DataFileSize = 8 * 1024
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 200; i++ {
+		err = db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+		assert.Nil(t, err)
+	}
+	stats, err := db.FileStats()
+	assert.Nil(t, err)
+	assert.Greater(t, len(stats), 1)
+	for _, stat := range stats {
+		assert.Equal(t, int64(0), stat.DeadBytes)
+	}
+
+	//the first file is dead after its keys are overwritten or deleted
+	for i := 0; i < 200; i++ {
+		pos := db.index.Get(utils.GetTestKey(i))
+		if pos.FileId != stats[0].FileId {
+			continue
+		}
+		if i%2 == 0 {
+			err = db.Delete(utils.GetTestKey(i))
+		} else {
+			err = db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+		}
+		assert.Nil(t, err)
+	}
+	stats, err = db.FileStats()
+	assert.Nil(t, err)
+	assert.Equal(t, stats[0].Size, stats[0].DeadBytes)
+	assert.Equal(t, float32(1), stats[0].DeadRatio())
+
+	//the statistics are rebuilt when open
+	err = db.Close()
+	assert.Nil(t, err)
+	db2, err := Open(opts)
+	assert.Nil(t, err)
+	stats2, err := db2.FileStats()
+	assert.Nil(t, err)
+	assert.Equal(t, stats, stats2)
+	assert.Nil(t, db2.Close())
+}
+
+func TestDB_MergeSelectedFiles(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-selective-merge")
+	opts.DirPath = dir
+	opts.DataFileSize = 4 * 1024
+	opts.MergeFileDeadRatio = 0.5
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	expected := make(map[string][]byte)
+	put := func(i int) {
+		value := utils.RandomValue(128)
+		assert.Nil(t, db.Put(utils.GetTestKey(i), value))
+		expected[string(utils.GetTestKey(i))] = value
+	}
+	for i := 0; i < 100; i++ {
+		put(i)
+	}
+	//nothing to merge
+	assert.Equal(t, ErrMergeRatioUnreached, db.Merge())
+
+	//file 1 is totally dead
+	for i := 0; i < 100; i++ {
+		if db.index.Get(utils.GetTestKey(i)).FileId == 1 {
+			put(i)
+		}
+	}
+	//the deleted logRecord of key 0 is in a dirty file, but file 0 isn't merged,
+	//thus the deleted logRecord must be kept
+	err = db.Delete(utils.GetTestKey(0))
+	assert.Nil(t, err)
+	delete(expected, string(utils.GetTestKey(0)))
+	deletedFileId := db.activeFile.Fileid
+	i := 1000
+	for ; db.activeFile.Fileid == deletedFileId; i++ {
+		put(i)
+	}
+	for j := 0; j < i; j++ {
+		if pos := db.index.Get(utils.GetTestKey(j)); pos != nil && pos.FileId == deletedFileId {
+			put(j)
+		}
+	}
+
+	stats, err := db.FileStats()
+	assert.Nil(t, err)
+	var dirtyFiles []uint32
+	for _, stat := range stats {
+		if stat.FileId != db.activeFile.Fileid && stat.DeadRatio() >= opts.MergeFileDeadRatio {
+			dirtyFiles = append(dirtyFiles, stat.FileId)
+		}
+	}
+	assert.Contains(t, dirtyFiles, uint32(1))
+	assert.Contains(t, dirtyFiles, deletedFileId)
+	assert.NotContains(t, dirtyFiles, uint32(0))
+
+	reclaimableSize := db.Stat().ReclaimableSize
+	err = db.Merge()
+	assert.Nil(t, err)
+	assert.Nil(t, db.Stat().LastMergeErr)
+	//the size reclaimed by the merged files isn't counted again
+	assert.Less(t, db.Stat().ReclaimableSize, reclaimableSize)
+	assert.True(t, db.mergePending)
+	err = db.Close()
+	assert.Nil(t, err)
+
+	//the dirty files are replaced when open
+	db2, err := Open(opts)
+	assert.Nil(t, err)
+	defer func() {
+		_ = db2.Close()
+	}()
+	stats2, err := db2.FileStats()
+	assert.Nil(t, err)
+	assert.Less(t, len(stats2), len(stats))
+	//the rewritten files only have live data, except the deleted logRecord
+	var deadBytes, deadBytes2 int64
+	for _, stat := range stats {
+		deadBytes += stat.DeadBytes
+	}
+	for _, stat := range stats2 {
+		deadBytes2 += stat.DeadBytes
+	}
+	assert.Less(t, deadBytes2*10, deadBytes)
+	_, err = os.Stat(data.GetFileName(dir, 1))
+	assert.True(t, os.IsNotExist(err))
+
+	assert.Equal(t, len(expected), len(db2.ListKeys()))
+	for key, value := range expected {
+		val, err := db2.Get([]byte(key))
+		assert.Nil(t, err)
+		assert.Equal(t, value, val)
+	}
+	_, err = db2.Get(utils.GetTestKey(0))
+	assert.Equal(t, ErrKeyNotFound, err)
+}
@@ -0,0 +1,81 @@
+package bitcaskGo
+
+import (
+	"bitcaskGo/index"
+)
+
+// Snapshot a read only view of the database at the time it's created
+// the writes after that are invisible to it,
+// the merges never delete the files it reads, the merged files replace the old ones only when the database is opened
+type Snapshot struct {
+	db       *DB
+	index    index.Indexer //point-in-time copy of db's index
+	released bool
+}
+
+// NewSnapshot create a snapshot of the current database
+// the snapshot must be released by Release when it is no longer used
+func (db *DB) NewSnapshot() *Snapshot {
+	snap := &Snapshot{db: db}
+	//the lock prevents writes from updating the index while the point-in-time view is taken,
+	//the btree is cloned lazily, the other indexes are copied from an iterator after the lock is released
+	var iterator index.Iterator
+	db.mu.Lock()
+	if db.options.IndexerType == BTree {
+		snap.index = db.index.Clone()
+	} else {
+		iterator = db.index.Iterator(false)
+	}
+	db.mu.Unlock()
+
+	if iterator != nil {
+		snap.index = index.CopyToBtree(iterator)
+	}
+	return snap
+}
+
+// Get the value of key as of snapshot creation
+func (snap *Snapshot) Get(key []byte) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, ErrKeyIsEmpty
+	}
+	snap.db.mu.RLock()
+	defer snap.db.mu.RUnlock()
+	if snap.released {
+		return nil, ErrSnapshotReleased
+	}
+	return snap.db.getFromIndex(snap.index, key)
+}
+
+// NewIterator iterate the keys as of snapshot creation
+// the iterator of a released snapshot is empty
+func (snap *Snapshot) NewIterator(opts IteratorOptions) *Iterator {
+	snap.db.mu.RLock()
+	defer snap.db.mu.RUnlock()
+	if snap.released {
+		return snap.db.newIterator(index.NewBtree(), opts)
+	}
+	return snap.db.newIterator(snap.index, opts)
+}
+
+// Fold get all data as of snapshot creation, and do specific operation user ask
+// when fn return false, shut down the traverse
+func (snap *Snapshot) Fold(fn func(key []byte, value []byte) bool) error {
+	snap.db.mu.RLock()
+	defer snap.db.mu.RUnlock()
+	if snap.released {
+		return ErrSnapshotReleased
+	}
+	return snap.db.fold(snap.index, fn)
+}
+
+// Release the snapshot and the index copy it holds
+func (snap *Snapshot) Release() {
+	snap.db.mu.Lock()
+	defer snap.db.mu.Unlock()
+	if snap.released {
+		return
+	}
+	snap.released = true
+	_ = snap.index.Close()
+}
@@ -0,0 +1,213 @@
+package bitcaskGo
+
+import (
+	"bitcaskGo/utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func TestDB_NewSnapshot(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-snapshot")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	for i := 0; i < 100; i++ {
+		err := db.Put(utils.GetTestKey(i), []byte("old"))
+		assert.Nil(t, err)
+	}
+	snap := db.NewSnapshot()
+
+	//the writes after snapshot creation are invisible to it
+	for i := 0; i < 50; i++ {
+		err := db.Put(utils.GetTestKey(i), []byte("new"))
+		assert.Nil(t, err)
+	}
+	for i := 50; i < 100; i++ {
+		err := db.Delete(utils.GetTestKey(i))
+		assert.Nil(t, err)
+	}
+	err = db.Put(utils.GetTestKey(200), []byte("new"))
+	assert.Nil(t, err)
+
+	val, err := snap.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("old"), val)
+	val, err = snap.Get(utils.GetTestKey(60))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("old"), val)
+	_, err = snap.Get(utils.GetTestKey(200))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	iterator := snap.NewIterator(DefaultIteratorOptions)
+	var num int
+	for iterator.Rewind(); iterator.Valid(); iterator.Next() {
+		value, err := iterator.Value()
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("old"), value)
+		num++
+	}
+	iterator.Close()
+	assert.Equal(t, 100, num)
+
+	num = 0
+	err = snap.Fold(func(key []byte, value []byte) bool {
+		num++
+		return true
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 100, num)
+
+	//the database itself sees the new data
+	val, err = db.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("new"), val)
+	assert.Equal(t, 51, len(db.ListKeys()))
+
+	snap.Release()
+	_, err = snap.Get(utils.GetTestKey(1))
+	assert.Equal(t, ErrSnapshotReleased, err)
+	iterator = snap.NewIterator(DefaultIteratorOptions)
+	iterator.Rewind()
+	assert.False(t, iterator.Valid())
+	iterator.Close()
+}
+
+func TestDB_NewSnapshotART(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-snapshot-art")
+	opts.DirPath = dir
+	opts.IndexerType = ART
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 100; i++ {
+		err := db.Put(utils.GetTestKey(i), []byte("old"))
+		assert.Nil(t, err)
+	}
+	snap := db.NewSnapshot()
+	defer snap.Release()
+	for i := 0; i < 100; i++ {
+		err := db.Put(utils.GetTestKey(i), []byte("new"))
+		assert.Nil(t, err)
+	}
+
+	val, err := snap.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("old"), val)
+	val, err = db.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("new"), val)
+}
+
+func TestDB_MergeWithSnapshot(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-snapshot-merge")
+	opts.DirPath = dir
+	opts.DataFileMergeRatio = 0
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	for i := 0; i < 1000; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+		assert.Nil(t, err)
+	}
+	snap := db.NewSnapshot()
+	for i := 0; i < 1000; i++ {
+		err := db.Delete(utils.GetTestKey(i))
+		assert.Nil(t, err)
+	}
+
+	err = db.Merge()
+	assert.Nil(t, err)
+
+	//the snapshot can still read the deleted data
+	val, err := snap.Get(utils.GetTestKey(10))
+	assert.Nil(t, err)
+	assert.NotNil(t, val)
+	snap.Release()
+
+	//the deleted data isn't visible after restart
+	err = db.Close()
+	assert.Nil(t, err)
+	db2, err := Open(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(db2.ListKeys()))
+	_, err = db2.Get(utils.GetTestKey(10))
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Nil(t, db2.Close())
+}
+
+func TestDB_SnapshotAfterMergeReopen(t *testing.T) {
+	for _, deadRatio := range []float32{0, 0.3} {
+		opts := DefaultOptions
+		dir, _ := os.MkdirTemp("", "bitcask-go-snapshot-merge-reopen")
+		opts.DirPath = dir
+		opts.DataFileSize = 8 * 1024
+		opts.DataFileMergeRatio = 0
+		opts.MergeFileDeadRatio = deadRatio
+		db, err := Open(opts)
+		assert.Nil(t, err)
+
+		for i := 0; i < 200; i++ {
+			err = db.Put(utils.GetTestKey(i), []byte("old"))
+			assert.Nil(t, err)
+		}
+		for i := 0; i < 200; i += 2 {
+			err = db.Put(utils.GetTestKey(i), []byte("old"))
+			assert.Nil(t, err)
+		}
+		//the merged files replace the old ones when open
+		err = db.Merge()
+		assert.Nil(t, err)
+		err = db.Close()
+		assert.Nil(t, err)
+		db, err = Open(opts)
+		assert.Nil(t, err)
+
+		snap := db.NewSnapshot()
+		for i := 0; i < 200; i++ {
+			if i%2 == 0 {
+				err = db.Delete(utils.GetTestKey(i))
+			} else {
+				err = db.Put(utils.GetTestKey(i), []byte("new"))
+			}
+			assert.Nil(t, err)
+		}
+		err = db.Merge()
+		assert.Nil(t, err)
+
+		//the files read by the snapshot are kept until the database is opened again
+		for i := 0; i < 200; i++ {
+			val, err := snap.Get(utils.GetTestKey(i))
+			assert.Nil(t, err)
+			assert.Equal(t, []byte("old"), val)
+		}
+		num := 0
+		err = snap.Fold(func(key []byte, value []byte) bool {
+			assert.Equal(t, []byte("old"), value)
+			num++
+			return true
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, 200, num)
+		snap.Release()
+
+		err = db.Close()
+		assert.Nil(t, err)
+		db, err = Open(opts)
+		assert.Nil(t, err)
+		assert.Equal(t, 100, len(db.ListKeys()))
+		val, err := db.Get(utils.GetTestKey(1))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("new"), val)
+		destroyDB(db)
+	}
+}
@@ -0,0 +1,118 @@
+package bitcaskGo
+
+import (
+	"bitcaskGo/data"
+	"time"
+)
+
+// PutWithTTL write key/value data which expires after ttl
+func (db *DB) PutWithTTL(key []byte, value []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		return ErrInvalidTTL
+	}
+	return db.putWithExpire(key, value, time.Now().Add(ttl).UnixNano())
+}
+
+// Expire set a new time to live on an existing key
+func (db *DB) Expire(key []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		return ErrInvalidTTL
+	}
+	return db.resetExpire(key, time.Now().Add(ttl).UnixNano())
+}
+
+// Persist remove the time to live of the key, the key will never expire
+func (db *DB) Persist(key []byte) error {
+	return db.resetExpire(key, 0)
+}
+
+// TTL return the remaining time to live of the key,
+// -1 means that the key exists but never expire
+func (db *DB) TTL(key []byte) (time.Duration, error) {
+	if len(key) == 0 {
+		return 0, ErrKeyIsEmpty
+	}
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	logRecordPos := db.index.Get(key)
+	if logRecordPos == nil || isExpired(logRecordPos) {
+		return 0, ErrKeyNotFound
+	}
+	if logRecordPos.Expire == 0 {
+		return -1, nil
+	}
+	return time.Duration(logRecordPos.Expire - time.Now().UnixNano()), nil
+}
+
+func (db *DB) putWithExpire(key []byte, value []byte, expire int64) error {
+	//Check the key is available
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+	return db.put(defaultNamespaceId, key, value, expire)
+}
+
+// rewrite the live value of the key with a new expire timestamp
+func (db *DB) resetExpire(key []byte, expire int64) error {
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+	//read the value under lock right before writing, so the value can't change in between
+	return db.writeKey(defaultNamespaceId, key, true, func() (*data.LogRecord, error) {
+		logRecordPos := db.index.Get(key)
+		if logRecordPos == nil || isExpired(logRecordPos) {
+			return nil, ErrKeyNotFound
+		}
+		logRecord, err := db.readRawLogRecord(logRecordPos)
+		if err != nil {
+			return nil, err
+		}
+		//the big value only has its descriptor rewritten, it still owns the same chunks
+		if logRecord.Type == data.LogRecordChunked {
+			return &data.LogRecord{
+				Key:    logRecordKeyWithSeq(key, nonTransactionSeqNo),
+				Value:  logRecord.Value,
+				Type:   data.LogRecordChunked,
+				Expire: expire,
+			}, nil
+		}
+		value, err := db.getValueByPosition(logRecordPos)
+		if err != nil {
+			return nil, err
+		}
+		return newPutRecord(defaultNamespaceId, key, value, expire), nil
+	})
+}
+
+// remove the expired keys from indexes and count them as reclaimable,
+// so merge will drop them, we must have mutex lock when we use this method
+func (db *DB) reclaimExpiredKeys() {
+	for _, idx := range db.indexes() {
+		var expiredKeys [][]byte
+		iterator := idx.Iterator(false)
+		for iterator.Rewind(); iterator.Valid(); iterator.Next() {
+			if isExpired(iterator.Value()) {
+				//copy the key, it may be invalid after the iterator is closed
+				expiredKeys = append(expiredKeys, append([]byte(nil), iterator.Key()...))
+			}
+		}
+		iterator.Close()
+
+		for _, key := range expiredKeys {
+			if oldPos, _ := idx.Delete(key); oldPos != nil {
+				db.reclaimSize += int64(oldPos.Size)
+				db.removeLive(oldPos)
+			}
+			//the chunks of an expired big value are reclaimed with it
+			if idx == db.index {
+				db.updateChunkedValue(key, &data.LogRecord{Type: data.LogRecordDeleted})
+			}
+		}
+	}
+}
+
+// check if the data that the position point to is expired
+func isExpired(pos *data.LogRecordPos) bool {
+	return pos.Expire > 0 && pos.Expire <= time.Now().UnixNano()
+}
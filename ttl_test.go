@@ -0,0 +1,139 @@
+package bitcaskGo
+
+import (
+	"bitcaskGo/utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDB_PutWithTTL(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-ttl-put")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	err = db.PutWithTTL(utils.GetTestKey(1), utils.RandomValue(24), time.Millisecond*100)
+	assert.Nil(t, err)
+	err = db.PutWithTTL(utils.GetTestKey(2), utils.RandomValue(24), time.Hour)
+	assert.Nil(t, err)
+	err = db.Put(utils.GetTestKey(3), utils.RandomValue(24))
+	assert.Nil(t, err)
+
+	err = db.PutWithTTL(utils.GetTestKey(4), utils.RandomValue(24), 0)
+	assert.Equal(t, ErrInvalidTTL, err)
+
+	val1, err := db.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.NotNil(t, val1)
+
+	time.Sleep(time.Millisecond * 200)
+	_, err = db.Get(utils.GetTestKey(1))
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Equal(t, 2, len(db.ListKeys()))
+
+	var foldNum int
+	err = db.Fold(func(key []byte, value []byte) bool {
+		foldNum++
+		return true
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, foldNum)
+
+	iterator := db.NewIterator(DefaultIteratorOptions)
+	var iterNum int
+	for iterator.Rewind(); iterator.Valid(); iterator.Next() {
+		assert.NotEqual(t, utils.GetTestKey(1), iterator.Key())
+		iterNum++
+	}
+	iterator.Close()
+	assert.Equal(t, 2, iterNum)
+
+	//restart, expired key is still invisible and the deadline is kept
+	err = db.Close()
+	assert.Nil(t, err)
+	db2, err := Open(opts)
+	assert.Nil(t, err)
+	_, err = db2.Get(utils.GetTestKey(1))
+	assert.Equal(t, ErrKeyNotFound, err)
+	ttl, err := db2.TTL(utils.GetTestKey(2))
+	assert.Nil(t, err)
+	assert.True(t, ttl > 0 && ttl <= time.Hour)
+	assert.Nil(t, db2.Close())
+}
+
+func TestDB_ExpireAndPersist(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-ttl-expire")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	val := utils.RandomValue(24)
+	err = db.Put(utils.GetTestKey(1), val)
+	assert.Nil(t, err)
+	ttl, err := db.TTL(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, time.Duration(-1), ttl)
+
+	err = db.Expire(utils.GetTestKey(1), time.Hour)
+	assert.Nil(t, err)
+	ttl, err = db.TTL(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.True(t, ttl > 0)
+	val1, err := db.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, val, val1)
+
+	err = db.Persist(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	ttl, err = db.TTL(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, time.Duration(-1), ttl)
+
+	//key doesn't exist
+	err = db.Expire(utils.GetTestKey(2), time.Hour)
+	assert.Equal(t, ErrKeyNotFound, err)
+	_, err = db.TTL(utils.GetTestKey(2))
+	assert.Equal(t, ErrKeyNotFound, err)
+}
+
+func TestDB_MergeExpired(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-ttl-merge")
+	opts.DirPath = dir
+	opts.DataFileSize = 32 * 1024 * 1024
+	opts.DataFileMergeRatio = 0.5
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	for i := 0; i < 10000; i++ {
+		err := db.PutWithTTL(utils.GetTestKey(i), utils.RandomValue(1024), time.Millisecond*100)
+		assert.Nil(t, err)
+	}
+	for i := 10000; i < 12000; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(1024))
+		assert.Nil(t, err)
+	}
+	time.Sleep(time.Millisecond * 200)
+
+	//the expired records are counted as reclaimable, so the ratio is reached
+	err = db.Merge()
+	assert.Nil(t, err)
+
+	err = db.Close()
+	assert.Nil(t, err)
+	db2, err := Open(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, 2000, len(db2.ListKeys()))
+	assert.Equal(t, 2000, int(db2.Stat().KeyNum))
+	assert.Nil(t, db2.Close())
+}
@@ -0,0 +1,280 @@
+package bitcaskGo
+
+import (
+	"bitcaskGo/data"
+	"bytes"
+	"sort"
+	"sync"
+)
+
+// Txn interactive optimistic transaction
+// reads see the database as of Begin plus the txn's own writes,
+// the commit fails if any key read was modified by others since the txn began
+type Txn struct {
+	mu       *sync.Mutex
+	batch    *WriteBatch                   //buffer the writes, commit them with seqNo as a batch
+	snap     *Snapshot                     //the read view at the time txn began
+	readSet  map[string]*data.LogRecordPos //the position of keys read by the txn, nil means the key didn't exist
+	finished bool
+}
+
+// Begin start a new transaction
+// the txn of a read only database can read, its writes fail with ErrDatabaseReadOnly
+func (db *DB) Begin() *Txn {
+	return &Txn{
+		mu:      new(sync.Mutex),
+		batch:   db.newWriteBatch(DefaultWriteBatchOptions),
+		snap:    db.NewSnapshot(),
+		readSet: make(map[string]*data.LogRecordPos),
+	}
+}
+
+// Get the value of key, the pending writes of the txn are visible
+func (txn *Txn) Get(key []byte) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, ErrKeyIsEmpty
+	}
+	txn.mu.Lock()
+	defer txn.mu.Unlock()
+	if txn.finished {
+		return nil, ErrTxnFinished
+	}
+
+	//read the txn's own write first
+	if logRecord := txn.pendingWrite(key); logRecord != nil {
+		if logRecord.Type == data.LogRecordDeleted {
+			return nil, ErrKeyNotFound
+		}
+		return logRecord.Value, nil
+	}
+
+	txn.recordRead(key, txn.snap.index.Get(key))
+	return txn.snap.Get(key)
+}
+
+// Put write key/value data in the txn
+func (txn *Txn) Put(key []byte, value []byte) error {
+	txn.mu.Lock()
+	defer txn.mu.Unlock()
+	if txn.finished {
+		return ErrTxnFinished
+	}
+	return txn.batch.Put(key, value)
+}
+
+// Delete key in the txn
+func (txn *Txn) Delete(key []byte) error {
+	txn.mu.Lock()
+	defer txn.mu.Unlock()
+	if txn.finished {
+		return ErrTxnFinished
+	}
+	return txn.batch.Delete(key)
+}
+
+// Commit the txn, return ErrTxnConflict if the keys it read have been modified
+// the txn can't be used anymore after commit whether it succeeds or not
+func (txn *Txn) Commit() error {
+	txn.mu.Lock()
+	defer txn.mu.Unlock()
+	if txn.finished {
+		return ErrTxnFinished
+	}
+	defer txn.finish()
+
+	//the read set is checked under db's lock together with the writes
+	for key, pos := range txn.readSet {
+		key, pos := []byte(key), pos
+		txn.batch.conditions = append(txn.batch.conditions, func() error {
+			return txn.batch.db.checkUnchanged(key, pos)
+		})
+	}
+	return txn.batch.Commit()
+}
+
+// Rollback discard all the writes of the txn
+func (txn *Txn) Rollback() {
+	txn.mu.Lock()
+	defer txn.mu.Unlock()
+	if txn.finished {
+		return
+	}
+	txn.finish()
+}
+
+// NewIterator iterate the keys as of Begin, merged with the txn's own writes
+// the iterator of a finished txn is empty
+func (txn *Txn) NewIterator(opts IteratorOptions) *TxnIterator {
+	txn.mu.Lock()
+	finished := txn.finished
+	txn.mu.Unlock()
+
+	//collect the pending writes which have the prefix, sort them in iterate order
+	var pending []*data.LogRecord
+	if !finished {
+		txn.batch.mu.Lock()
+		for _, logRecord := range txn.batch.pendingWrites {
+			if bytes.HasPrefix(logRecord.Key, opts.Prefix) {
+				pending = append(pending, logRecord)
+			}
+		}
+		txn.batch.mu.Unlock()
+	}
+
+	it := &TxnIterator{
+		txn:     txn,
+		dbIter:  txn.snap.NewIterator(opts),
+		pending: pending,
+		options: opts,
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return it.compare(pending[i].Key, pending[j].Key) < 0
+	})
+	it.settle()
+	return it
+}
+
+// get the pending write of key
+func (txn *Txn) pendingWrite(key []byte) *data.LogRecord {
+	txn.batch.mu.Lock()
+	defer txn.batch.mu.Unlock()
+	return txn.batch.pendingWrites[string(key)]
+}
+
+// record the position of key the txn read for the first time
+func (txn *Txn) recordRead(key []byte, pos *data.LogRecordPos) {
+	if _, ok := txn.readSet[string(key)]; !ok {
+		txn.readSet[string(key)] = pos
+	}
+}
+
+func (txn *Txn) finish() {
+	txn.finished = true
+	txn.snap.Release()
+}
+
+// check if the position of key is still the one read by txn
+// we must have mutex lock when we use this method
+func (db *DB) checkUnchanged(key []byte, readPos *data.LogRecordPos) error {
+	pos := db.index.Get(key)
+	if pos == nil && readPos == nil {
+		return nil
+	}
+	if pos == nil || readPos == nil || pos.FileId != readPos.FileId || pos.Offset != readPos.Offset {
+		return ErrTxnConflict
+	}
+	return nil
+}
+
+// TxnIterator iterator of txn, the pending writes shadow the data in database
+type TxnIterator struct {
+	txn         *Txn
+	dbIter      *Iterator         //iterator of the txn's snapshot
+	pending     []*data.LogRecord //sorted pending writes
+	pendingIdx  int
+	options     IteratorOptions
+	currKey     []byte
+	fromPending bool //whether the current key comes from the pending writes
+}
+
+func (it *TxnIterator) Rewind() {
+	it.dbIter.Rewind()
+	it.pendingIdx = 0
+	it.settle()
+}
+
+// Seek find the first key that is greater than or equal to the target key(less than or equal to when reverse), and iterate from there
+func (it *TxnIterator) Seek(key []byte) {
+	it.dbIter.Seek(key)
+	it.pendingIdx = sort.Search(len(it.pending), func(i int) bool {
+		return it.compare(it.pending[i].Key, key) >= 0
+	})
+	it.settle()
+}
+
+// Next jump to next key
+func (it *TxnIterator) Next() {
+	if it.fromPending {
+		it.pendingIdx++
+	} else {
+		it.dbIter.Next()
+	}
+	it.settle()
+}
+
+// Valid check if the iterate is over
+func (it *TxnIterator) Valid() bool {
+	return it.currKey != nil
+}
+
+// Key get the key in current iterate position
+func (it *TxnIterator) Key() []byte {
+	return it.currKey
+}
+
+// Value get the value in current iterate position
+func (it *TxnIterator) Value() ([]byte, error) {
+	if it.fromPending {
+		return it.pending[it.pendingIdx].Value, nil
+	}
+	return it.dbIter.Value()
+}
+
+// Close the iterator and release relevant resources
+func (it *TxnIterator) Close() {
+	it.dbIter.Close()
+	it.pending = nil
+}
+
+// move to the next visible key, from either the snapshot or the pending writes
+func (it *TxnIterator) settle() {
+	for {
+		dbValid := it.dbIter.Valid()
+		pendingValid := it.pendingIdx < len(it.pending)
+		if !dbValid && !pendingValid {
+			it.currKey = nil
+			return
+		}
+
+		//cmp < 0 means that the key in snapshot comes first
+		var cmp int
+		switch {
+		case !pendingValid:
+			cmp = -1
+		case !dbValid:
+			cmp = 1
+		default:
+			cmp = it.compare(it.dbIter.Key(), it.pending[it.pendingIdx].Key)
+		}
+
+		if cmp < 0 {
+			it.currKey = it.dbIter.Key()
+			it.fromPending = false
+			it.txn.mu.Lock()
+			it.txn.recordRead(it.currKey, it.dbIter.indexIter.Value())
+			it.txn.mu.Unlock()
+			return
+		}
+
+		//the pending write shadows the same key in snapshot
+		if cmp == 0 {
+			it.dbIter.Next()
+		}
+		logRecord := it.pending[it.pendingIdx]
+		if logRecord.Type == data.LogRecordDeleted {
+			it.pendingIdx++
+			continue
+		}
+		it.currKey = logRecord.Key
+		it.fromPending = true
+		return
+	}
+}
+
+// compare keys in iterate order
+func (it *TxnIterator) compare(a, b []byte) int {
+	if it.options.Reverse {
+		return bytes.Compare(b, a)
+	}
+	return bytes.Compare(a, b)
+}
@@ -0,0 +1,168 @@
+package bitcaskGo
+
+import (
+	"bitcaskGo/utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func TestDB_Begin(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-txn")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	err = db.Put(utils.GetTestKey(1), []byte("a"))
+	assert.Nil(t, err)
+	err = db.Put(utils.GetTestKey(2), []byte("b"))
+	assert.Nil(t, err)
+
+	txn := db.Begin()
+	//read its own writes
+	err = txn.Put(utils.GetTestKey(3), []byte("c"))
+	assert.Nil(t, err)
+	val, err := txn.Get(utils.GetTestKey(3))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("c"), val)
+	err = txn.Delete(utils.GetTestKey(2))
+	assert.Nil(t, err)
+	_, err = txn.Get(utils.GetTestKey(2))
+	assert.Equal(t, ErrKeyNotFound, err)
+	val, err = txn.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("a"), val)
+
+	//the writes are invisible outside before commit
+	_, err = db.Get(utils.GetTestKey(3))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	err = txn.Commit()
+	assert.Nil(t, err)
+	val, err = db.Get(utils.GetTestKey(3))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("c"), val)
+	_, err = db.Get(utils.GetTestKey(2))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	err = txn.Put(utils.GetTestKey(4), []byte("d"))
+	assert.Equal(t, ErrTxnFinished, err)
+
+	//the txn survives restart
+	err = db.Close()
+	assert.Nil(t, err)
+	db2, err := Open(opts)
+	assert.Nil(t, err)
+	val, err = db2.Get(utils.GetTestKey(3))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("c"), val)
+	assert.Nil(t, db2.Close())
+}
+
+func TestTxn_Conflict(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-txn-conflict")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	err = db.Put(utils.GetTestKey(1), []byte("1"))
+	assert.Nil(t, err)
+
+	txn1 := db.Begin()
+	txn2 := db.Begin()
+	_, err = txn1.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	_, err = txn2.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Nil(t, txn1.Put(utils.GetTestKey(1), []byte("2")))
+	assert.Nil(t, txn2.Put(utils.GetTestKey(1), []byte("3")))
+
+	assert.Nil(t, txn1.Commit())
+	assert.Equal(t, ErrTxnConflict, txn2.Commit())
+	val, err := db.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("2"), val)
+
+	//read a key which doesn't exist, then someone else creates it
+	txn3 := db.Begin()
+	_, err = txn3.Get(utils.GetTestKey(5))
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Nil(t, txn3.Put(utils.GetTestKey(6), []byte("6")))
+	assert.Nil(t, db.Put(utils.GetTestKey(5), []byte("5")))
+	assert.Equal(t, ErrTxnConflict, txn3.Commit())
+	_, err = db.Get(utils.GetTestKey(6))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	//blind writes don't conflict
+	txn4 := db.Begin()
+	assert.Nil(t, txn4.Put(utils.GetTestKey(1), []byte("4")))
+	assert.Nil(t, db.Put(utils.GetTestKey(1), []byte("x")))
+	assert.Nil(t, txn4.Commit())
+
+	txn5 := db.Begin()
+	assert.Nil(t, txn5.Put(utils.GetTestKey(7), []byte("7")))
+	txn5.Rollback()
+	_, err = db.Get(utils.GetTestKey(7))
+	assert.Equal(t, ErrKeyNotFound, err)
+	//the snapshots of finished txns are released
+	assert.True(t, txn4.snap.released)
+	assert.True(t, txn5.snap.released)
+}
+
+func TestTxn_NewIterator(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-txn-iterator")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	assert.Nil(t, db.Put([]byte("a"), []byte("db-a")))
+	assert.Nil(t, db.Put([]byte("c"), []byte("db-c")))
+	assert.Nil(t, db.Put([]byte("e"), []byte("db-e")))
+
+	txn := db.Begin()
+	assert.Nil(t, txn.Put([]byte("b"), []byte("txn-b")))
+	assert.Nil(t, txn.Put([]byte("c"), []byte("txn-c")))
+	assert.Nil(t, txn.Delete([]byte("e")))
+	assert.Nil(t, txn.Put([]byte("f"), []byte("txn-f")))
+
+	iterator := txn.NewIterator(DefaultIteratorOptions)
+	var keys, values []string
+	for iterator.Rewind(); iterator.Valid(); iterator.Next() {
+		value, err := iterator.Value()
+		assert.Nil(t, err)
+		keys = append(keys, string(iterator.Key()))
+		values = append(values, string(value))
+	}
+	iterator.Close()
+	assert.Equal(t, []string{"a", "b", "c", "f"}, keys)
+	assert.Equal(t, []string{"db-a", "txn-b", "txn-c", "txn-f"}, values)
+
+	reverseOpts := DefaultIteratorOptions
+	reverseOpts.Reverse = true
+	iterator2 := txn.NewIterator(reverseOpts)
+	keys = nil
+	for iterator2.Seek([]byte("c")); iterator2.Valid(); iterator2.Next() {
+		keys = append(keys, string(iterator2.Key()))
+	}
+	iterator2.Close()
+	assert.Equal(t, []string{"c", "b", "a"}, keys)
+
+	//the key read by iterator is in the read set
+	assert.Nil(t, db.Put([]byte("a"), []byte("db-a2")))
+	assert.Equal(t, ErrTxnConflict, txn.Commit())
+
+	//the iterator of a finished txn is empty
+	iterator3 := txn.NewIterator(DefaultIteratorOptions)
+	iterator3.Rewind()
+	assert.False(t, iterator3.Valid())
+	iterator3.Close()
+}
@@ -0,0 +1,86 @@
+package bitcaskGo
+
+import (
+	"bitcaskGo/data"
+	"container/list"
+	"sync"
+)
+
+// the memory taken by a cache entry besides the value, roughly
+const valueCacheEntryOverhead = 64
+
+type valueCacheKey struct {
+	fileId uint32
+	offset int64
+}
+
+type valueCacheEntry struct {
+	key   valueCacheKey
+	value []byte
+}
+
+// LRU cache of the values read from data files, keyed by the position of logRecord,
+// the logRecord at a position never changes, thus the entries needn't be invalidated
+type valueCache struct {
+	mu       *sync.Mutex
+	capacity int64 //max bytes of the entries
+	size     int64
+	lru      *list.List //the most recently used entry is at front
+	entries  map[valueCacheKey]*list.Element
+	hits     uint64
+	misses   uint64
+}
+
+func newValueCache(capacity int64) *valueCache {
+	return &valueCache{
+		mu:       new(sync.Mutex),
+		capacity: capacity,
+		lru:      list.New(),
+		entries:  make(map[valueCacheKey]*list.Element),
+	}
+}
+
+// get the value at pos, the caller must not modify it
+func (vc *valueCache) get(pos *data.LogRecordPos) ([]byte, bool) {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+	elem, ok := vc.entries[valueCacheKey{fileId: pos.FileId, offset: pos.Offset}]
+	if !ok {
+		vc.misses++
+		return nil, false
+	}
+	vc.hits++
+	vc.lru.MoveToFront(elem)
+	return elem.Value.(*valueCacheEntry).value, true
+}
+
+// save the value at pos, the least recently used entries are evicted when the cache is full
+func (vc *valueCache) put(pos *data.LogRecordPos, value []byte) {
+	entrySize := int64(len(value)) + valueCacheEntryOverhead
+	//the value is too big to be cached
+	if entrySize > vc.capacity {
+		return
+	}
+	key := valueCacheKey{fileId: pos.FileId, offset: pos.Offset}
+
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+	if elem, ok := vc.entries[key]; ok {
+		vc.lru.MoveToFront(elem)
+		return
+	}
+	for vc.size+entrySize > vc.capacity {
+		oldest := vc.lru.Back()
+		entry := vc.lru.Remove(oldest).(*valueCacheEntry)
+		delete(vc.entries, entry.key)
+		vc.size -= int64(len(entry.value)) + valueCacheEntryOverhead
+	}
+	vc.entries[key] = vc.lru.PushFront(&valueCacheEntry{key: key, value: value})
+	vc.size += entrySize
+}
+
+func (vc *valueCache) stat() (hits uint64, misses uint64) {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+	return vc.hits, vc.misses
+}
@@ -0,0 +1,75 @@
+package bitcaskGo
+
+import (
+	"bitcaskGo/data"
+	"bitcaskGo/utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func TestValueCache_Evict(t *testing.T) {
+	vc := newValueCache(3 * (100 + valueCacheEntryOverhead))
+	for i := 0; i < 3; i++ {
+		vc.put(&data.LogRecordPos{FileId: 1, Offset: int64(i)}, make([]byte, 100))
+	}
+	//the first entry becomes the most recently used one
+	_, ok := vc.get(&data.LogRecordPos{FileId: 1, Offset: 0})
+	assert.True(t, ok)
+
+	vc.put(&data.LogRecordPos{FileId: 1, Offset: 3}, make([]byte, 100))
+	_, ok = vc.get(&data.LogRecordPos{FileId: 1, Offset: 1})
+	assert.False(t, ok)
+	_, ok = vc.get(&data.LogRecordPos{FileId: 1, Offset: 0})
+	assert.True(t, ok)
+	assert.Equal(t, int64(3*(100+valueCacheEntryOverhead)), vc.size)
+
+	//the value bigger than the cache is ignored
+	vc.put(&data.LogRecordPos{FileId: 2}, make([]byte, 1000))
+	_, ok = vc.get(&data.LogRecordPos{FileId: 2})
+	assert.False(t, ok)
+	hits, misses := vc.stat()
+	assert.Equal(t, uint64(2), hits)
+	assert.Equal(t, uint64(2), misses)
+}
+
+func TestDB_ValueCache(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-value-cache")
+	opts.DirPath = dir
+	opts.ValueCacheSize = 1024 * 1024
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 100; i++ {
+		err = db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+		assert.Nil(t, err)
+	}
+	for i := 0; i < 100; i++ {
+		val1, err := db.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+		val2, err := db.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+		assert.Equal(t, val1, val2)
+	}
+	stat := db.Stat()
+	assert.Equal(t, uint64(100), stat.ValueCacheHits)
+	assert.Equal(t, uint64(100), stat.ValueCacheMisses)
+
+	//the value returned can be modified by the caller
+	val, err := db.Get(utils.GetTestKey(0))
+	assert.Nil(t, err)
+	expected := append([]byte(nil), val...)
+	val[0] ^= 0xff
+	val, err = db.Get(utils.GetTestKey(0))
+	assert.Nil(t, err)
+	assert.Equal(t, expected, val)
+
+	//the new value has a new position
+	err = db.Put(utils.GetTestKey(0), []byte("new value"))
+	assert.Nil(t, err)
+	val, err = db.Get(utils.GetTestKey(0))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("new value"), val)
+}
@@ -0,0 +1,468 @@
+package bitcaskGo
+
+import (
+	"bitcaskGo/data"
+	"bitcaskGo/fileio"
+	"bitcaskGo/index"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// the valid logRecords of a broken file are copied into this file first, then it replaces the broken one
+const repairFileSuffix = ".repair"
+
+// the size of file read at once when searching the next valid logRecord after a broken one
+const scanWindowSize = 64 * 1024
+
+// CorruptRange a range of file which can't be decoded into logRecords
+type CorruptRange struct {
+	Start int64
+	End   int64
+	Err   error //the error met at Start
+}
+
+// String describe the corrupt range
+func (cr CorruptRange) String() string {
+	return fmt.Sprintf("[%d, %d): %v", cr.Start, cr.End, cr.Err)
+}
+
+// FileReport the verify result of a file
+type FileReport struct {
+	Name          string
+	Size          int64
+	RecordNum     int //number of valid logRecords
+	CorruptRanges []CorruptRange
+	Repaired      bool
+
+	validRanges [][2]int64 //[start, end) of the valid logRecords, used by repair
+}
+
+// Corrupted check if any part of the file is broken
+func (fr *FileReport) Corrupted() bool {
+	return len(fr.CorruptRanges) > 0
+}
+
+// VerifyReport the verify result of all the files in data directory
+type VerifyReport struct {
+	Files []*FileReport
+}
+
+// Corrupted check if any file is broken
+func (r *VerifyReport) Corrupted() bool {
+	for _, fr := range r.Files {
+		if fr.Corrupted() {
+			return true
+		}
+	}
+	return false
+}
+
+// Verify scan all the files of the open database, and report the broken ranges
+func (db *DB) Verify() (*VerifyReport, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	dataFiles := make([]*data.Datafile, 0, len(db.olderFiles)+1)
+	for _, dataFile := range db.olderFiles {
+		dataFiles = append(dataFiles, dataFile)
+	}
+	if db.activeFile != nil {
+		dataFiles = append(dataFiles, db.activeFile)
+	}
+	sort.Slice(dataFiles, func(i, j int) bool {
+		return dataFiles[i].Fileid < dataFiles[j].Fileid
+	})
+
+	report := &VerifyReport{}
+	for _, dataFile := range dataFiles {
+		fileName := data.GetFileName(db.options.DirPath, dataFile.Fileid)
+		fr, err := scanFile(dataFile, filepath.Base(fileName))
+		if err != nil {
+			return nil, err
+		}
+		report.Files = append(report.Files, fr)
+	}
+
+	blobReports, err := verifyBlobFiles(db.options.FileSystem, db.options.DirPath, db.cipher)
+	if err != nil {
+		return nil, err
+	}
+	report.Files = append(report.Files, blobReports...)
+
+	metaReports, err := verifyMetaFiles(db.options.FileSystem, db.options.DirPath, db.cipher)
+	if err != nil {
+		return nil, err
+	}
+	report.Files = append(report.Files, metaReports...)
+	return report, nil
+}
+
+// Verify scan all the files in the data directory without opening the database,
+// the database must be closed
+func Verify(options Options) (*VerifyReport, error) {
+	return checkDirectory(options, false)
+}
+
+// Repair verify the data directory, and fix the broken files, the database must be closed
+// a torn tail is truncated, the valid logRecords after a broken range are salvaged into a new file,
+// if a merged file or the hint file is broken, the hint file is dropped, the index is rebuilt from data files,
+// the index checkpoint is dropped if it or any data file is broken,
+// the data files indexed by b plus tree and the blob files only have their torn tails cut off,
+// the b plus tree index is found by its file in the directory, whatever IndexerType is
+func Repair(options Options) (*VerifyReport, error) {
+	return checkDirectory(options, true)
+}
+
+func checkDirectory(options Options, repair bool) (*VerifyReport, error) {
+	if options.FileSystem == nil {
+		options.FileSystem = fileio.OSFileSystem
+	}
+	fs := options.FileSystem
+	if _, err := fs.Stat(options.DirPath); err != nil {
+		return nil, err
+	}
+	var cipher *data.Cipher
+	if len(options.EncryptionKey) > 0 {
+		var err error
+		if cipher, err = data.NewCipher(options.EncryptionKey, options.OldEncryptionKeys...); err != nil {
+			return nil, err
+		}
+	}
+
+	//the files can't be checked while the database is using them
+	fileLock := fs.Lock(filepath.Join(options.DirPath, fileLockName))
+	hold, err := fileLock.TryLock()
+	if err != nil {
+		return nil, err
+	}
+	if !hold {
+		return nil, ErrDataBaseisUsing
+	}
+	defer func() {
+		_ = fileLock.Unlock()
+	}()
+
+	//the caller like the command line tool may not know the indexer, the b plus tree index file tells it
+	if _, err := fs.Stat(filepath.Join(options.DirPath, index.BPTreeIndexFileName)); err == nil {
+		options.IndexerType = BPTree
+	}
+
+	report := &VerifyReport{}
+	metaReports, err := verifyMetaFiles(fs, options.DirPath, cipher)
+	if err != nil {
+		return nil, err
+	}
+
+	//the data files before nonMergeFileId are indexed by the hint file
+	var dropHint, dropCheckpoint bool
+	var nonMergeFileId uint32
+	for _, fr := range metaReports {
+		if fr.Name == data.MergeFinishedFileName && !fr.Corrupted() {
+			db := &DB{options: options, cipher: cipher}
+			if nonMergeFileId, err = db.getNonMergeFileId(options.DirPath); err != nil {
+				return nil, err
+			}
+		}
+		if fr.Corrupted() && (fr.Name == data.HintFileName || fr.Name == data.MergeFinishedFileName) {
+			dropHint = true
+		}
+		if fr.Corrupted() && fr.Name == data.CheckpointFileName {
+			dropCheckpoint = true
+		}
+	}
+
+	fileIds, err := getDataFileIds(fs, options.DirPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, fid := range fileIds {
+		dataFile, err := data.OpenDataFile(fs, options.DirPath, uint32(fid), fileio.StandardFIO)
+		if err != nil {
+			return nil, err
+		}
+		dataFile.Cipher = cipher
+		fileName := data.GetFileName(options.DirPath, uint32(fid))
+		fr, err := scanFile(dataFile, filepath.Base(fileName))
+		_ = dataFile.Close()
+		if err != nil {
+			return nil, err
+		}
+		report.Files = append(report.Files, fr)
+
+		if repair && fr.Corrupted() {
+			//the b plus tree indexes keep the positions of logRecords, they can't be rebuilt from data files,
+			//thus the logRecords can't be moved, only the torn tail is cut off
+			if options.IndexerType == BPTree && !fr.tornTail() {
+				return nil, ErrRepairWithBPTree
+			}
+			if err := repairFile(fs, fileName, uint32(fid), cipher, fr); err != nil {
+				return nil, err
+			}
+			//the positions in hint file and checkpoint are invalid now
+			if uint32(fid) < nonMergeFileId {
+				dropHint = true
+			}
+			dropCheckpoint = true
+		}
+	}
+
+	blobReports, err := verifyBlobFiles(fs, options.DirPath, cipher)
+	if err != nil {
+		return nil, err
+	}
+	for _, fr := range blobReports {
+		report.Files = append(report.Files, fr)
+		//the blobs are found by their positions, thus they can't be moved, only the torn tail is cut off
+		if repair && fr.tornTail() {
+			fid, _ := strconv.Atoi(strings.TrimSuffix(fr.Name, data.BlobFileNameSuffix))
+			if err := repairFile(fs, filepath.Join(options.DirPath, fr.Name), uint32(fid), cipher, fr); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, fr := range metaReports {
+		report.Files = append(report.Files, fr)
+		if !repair {
+			continue
+		}
+		switch fr.Name {
+		case data.HintFileName, data.MergeFinishedFileName:
+			//without hint file and merge finished file, all the data files are loaded when open
+			if dropHint {
+				if err := fs.Remove(filepath.Join(options.DirPath, fr.Name)); err != nil {
+					return nil, err
+				}
+				fr.Repaired = true
+			}
+		case data.CheckpointFileName:
+			if dropCheckpoint {
+				if err := removeCheckpoint(fs, options.DirPath); err != nil {
+					return nil, err
+				}
+				fr.Repaired = true
+			}
+		default:
+			if fr.Corrupted() {
+				if err := repairFile(fs, filepath.Join(options.DirPath, fr.Name), 0, cipher, fr); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return report, nil
+}
+
+// scan the hint file, merge finished file, namespace file, seq no file, checkpoint and blob compacted file if they exist
+func verifyMetaFiles(fs fileio.FileSystem, dirPath string, cipher *data.Cipher) ([]*FileReport, error) {
+	metaFiles := []struct {
+		name string
+		open func(fs fileio.FileSystem, dirPath string) (*data.Datafile, error)
+	}{
+		{data.HintFileName, data.OpenHintFile},
+		{data.MergeFinishedFileName, data.OpenMergeFinishedFile},
+		{data.NamespaceFileName, data.OpenNamespaceFile},
+		{data.SeqNoFileName, data.OpenSeqNoFile},
+		{data.CheckpointFileName, data.OpenCheckpointFile},
+		{data.BlobCompactedFileName, data.OpenBlobCompactedFile},
+	}
+
+	var reports []*FileReport
+	for _, metaFile := range metaFiles {
+		if _, err := fs.Stat(filepath.Join(dirPath, metaFile.name)); os.IsNotExist(err) {
+			continue
+		}
+		file, err := metaFile.open(fs, dirPath)
+		if err != nil {
+			return nil, err
+		}
+		file.Cipher = cipher
+		fr, err := scanFile(file, metaFile.name)
+		_ = file.Close()
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, fr)
+	}
+	return reports, nil
+}
+
+// scan all the blob files in the directory
+func verifyBlobFiles(fs fileio.FileSystem, dirPath string, cipher *data.Cipher) ([]*FileReport, error) {
+	dirEntries, err := fs.ReadDir(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	var fileIds []int
+	for _, entry := range dirEntries {
+		if !strings.HasSuffix(entry.Name(), data.BlobFileNameSuffix) {
+			continue
+		}
+		fileId, err := strconv.Atoi(strings.TrimSuffix(entry.Name(), data.BlobFileNameSuffix))
+		if err != nil {
+			return nil, ErrDataDirectoryCorrupted
+		}
+		fileIds = append(fileIds, fileId)
+	}
+	sort.Ints(fileIds)
+
+	var reports []*FileReport
+	for _, fid := range fileIds {
+		blobFile, err := data.OpenBlobFile(fs, dirPath, uint32(fid))
+		if err != nil {
+			return nil, err
+		}
+		blobFile.Cipher = cipher
+		fr, err := scanFile(blobFile, filepath.Base(data.GetBlobFileName(dirPath, uint32(fid))))
+		_ = blobFile.Close()
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, fr)
+	}
+	return reports, nil
+}
+
+// read all the logRecords in file, when a logRecord is broken,
+// search the next valid logRecord byte by byte, the bytes skipped are reported as a corrupt range
+func scanFile(file *data.Datafile, name string) (*FileReport, error) {
+	size, err := file.IOManager.Size()
+	if err != nil {
+		return nil, err
+	}
+	fr := &FileReport{Name: name, Size: size}
+
+	var offset int64 = 0
+	for offset < size {
+		_, recordSize, err := file.ReadLogRecord(offset)
+		if err == nil {
+			fr.RecordNum++
+			fr.validRanges = append(fr.validRanges, [2]int64{offset, offset + recordSize})
+			offset += recordSize
+			continue
+		}
+		//EOF before the end of file means the logRecord is incomplete
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+
+		next, scanErr := nextLogRecordOffset(file, offset+1, size)
+		if scanErr != nil {
+			return nil, scanErr
+		}
+		fr.CorruptRanges = append(fr.CorruptRanges, CorruptRange{Start: offset, End: next, Err: err})
+		offset = next
+	}
+	return fr, nil
+}
+
+// search the first valid logRecord from offset byte by byte, the file is read window by window,
+// thus the logRecords tried are decoded from memory unless they cross the window
+func nextLogRecordOffset(file *data.Datafile, offset int64, size int64) (int64, error) {
+	window := &windowIO{IOManager: file.IOManager}
+	probe := &data.Datafile{Fileid: file.Fileid, IOManager: window, Cipher: file.Cipher}
+	for ; offset < size; offset++ {
+		if offset >= window.start+int64(len(window.buf)) {
+			if err := window.fill(offset, size); err != nil {
+				return 0, err
+			}
+		}
+		if _, _, err := probe.ReadLogRecord(offset); err == nil {
+			return offset, nil
+		}
+	}
+	return size, nil
+}
+
+// windowIO serves the reads inside the window from memory, the others from the file
+type windowIO struct {
+	fileio.IOManager
+	start int64
+	buf   []byte
+}
+
+// read the window starting from offset
+func (w *windowIO) fill(offset int64, size int64) error {
+	n := size - offset
+	if n > scanWindowSize {
+		n = scanWindowSize
+	}
+	buf := make([]byte, n)
+	if _, err := w.IOManager.Read(buf, offset); err != nil && err != io.EOF {
+		return err
+	}
+	w.start, w.buf = offset, buf
+	return nil
+}
+
+func (w *windowIO) Read(b []byte, offset int64) (int, error) {
+	if offset >= w.start && offset+int64(len(b)) <= w.start+int64(len(w.buf)) {
+		return copy(b, w.buf[offset-w.start:]), nil
+	}
+	return w.IOManager.Read(b, offset)
+}
+
+// check if only the tail of file is broken
+func (fr *FileReport) tornTail() bool {
+	return len(fr.CorruptRanges) == 1 && fr.CorruptRanges[0].End == fr.Size
+}
+
+// fix the broken file by its verify result
+func repairFile(fs fileio.FileSystem, fileName string, fileId uint32, cipher *data.Cipher, fr *FileReport) error {
+	//only the tail is broken, cut it off
+	if fr.tornTail() {
+		if err := fs.Truncate(fileName, fr.CorruptRanges[0].Start); err != nil {
+			return err
+		}
+		fr.Repaired = true
+		return nil
+	}
+
+	//copy the valid logRecords into a new file, the order of them is kept,
+	//the encrypted ones are sealed again, because their offsets are authenticated
+	srcIO, err := fs.OpenFile(fileName, fileio.StandardFIO)
+	if err != nil {
+		return err
+	}
+	src := &data.Datafile{Fileid: fileId, IOManager: srcIO, Cipher: cipher}
+	defer src.Close()
+	repairFileName := fileName + repairFileSuffix
+	//the file left by a broken repair
+	if err := fs.Remove(repairFileName); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	dstIO, err := fs.OpenFile(repairFileName, fileio.StandardFIO)
+	if err != nil {
+		return err
+	}
+	dst := &data.Datafile{Fileid: fileId, IOManager: dstIO, Cipher: cipher}
+	for _, r := range fr.validRanges {
+		encRecord, _, err := src.ReadEncodedLogRecord(r[0])
+		if err == nil {
+			err = dst.Write(encRecord)
+		}
+		if err != nil {
+			_ = dst.Close()
+			return err
+		}
+	}
+	if err := dst.Sync(); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+
+	//replace the broken file
+	if err := fs.Rename(repairFileName, fileName); err != nil {
+		return err
+	}
+	fr.Repaired = true
+	return nil
+}
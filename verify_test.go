@@ -0,0 +1,269 @@
+package bitcaskGo
+
+import (
+	"bitcaskGo/data"
+	"bitcaskGo/utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDB_Verify(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-verify")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	for i := 0; i < 100; i++ {
+		err = db.Put(utils.GetTestKey(i), utils.RandomValue(24))
+		assert.Nil(t, err)
+	}
+	report, err := db.Verify()
+	assert.Nil(t, err)
+	assert.False(t, report.Corrupted())
+	assert.Equal(t, "000000000.data", report.Files[0].Name)
+	assert.Equal(t, 100, report.Files[0].RecordNum)
+
+	//offline verify can't run while the database is open
+	_, err = Verify(opts)
+	assert.Equal(t, ErrDataBaseisUsing, err)
+}
+
+func TestRepair_TornTail(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-repair")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 100; i++ {
+		err = db.Put(utils.GetTestKey(i), utils.RandomValue(24))
+		assert.Nil(t, err)
+	}
+	err = db.Close()
+	assert.Nil(t, err)
+
+	//cut the last logRecord in half
+	fileName := data.GetFileName(dir, 0)
+	info, _ := os.Stat(fileName)
+	err = os.Truncate(fileName, info.Size()-10)
+	assert.Nil(t, err)
+
+	report, err := Verify(opts)
+	assert.Nil(t, err)
+	assert.True(t, report.Corrupted())
+	fr := report.Files[0]
+	assert.Equal(t, 99, fr.RecordNum)
+	assert.Equal(t, 1, len(fr.CorruptRanges))
+	assert.Equal(t, info.Size()-10, fr.CorruptRanges[0].End)
+
+	report, err = Repair(opts)
+	assert.Nil(t, err)
+	assert.True(t, report.Files[0].Repaired)
+	report, err = Verify(opts)
+	assert.Nil(t, err)
+	assert.False(t, report.Corrupted())
+
+	db2, err := Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 99; i++ {
+		_, err := db2.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+	}
+	_, err = db2.Get(utils.GetTestKey(99))
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Nil(t, db2.Close())
+}
+
+func TestRepair_SalvageAfterCorruption(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-repair")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 100; i++ {
+		err = db.Put(utils.GetTestKey(i), utils.RandomValue(24))
+		assert.Nil(t, err)
+	}
+	pos := db.index.Get(utils.GetTestKey(50))
+	err = db.Close()
+	assert.Nil(t, err)
+
+	//break a logRecord in the middle of the file
+	fileName := data.GetFileName(dir, 0)
+	content, err := os.ReadFile(fileName)
+	assert.Nil(t, err)
+	content[pos.Offset+int64(pos.Size)/2] ^= 0xff
+	err = os.WriteFile(fileName, content, 0644)
+	assert.Nil(t, err)
+
+	//loading stops at the broken logRecord
+	_, err = Open(opts)
+	assert.Equal(t, data.ErrInvalidCRC, err)
+
+	report, err := Verify(opts)
+	assert.Nil(t, err)
+	fr := report.Files[0]
+	assert.Equal(t, 99, fr.RecordNum)
+	assert.Equal(t, []CorruptRange{{Start: pos.Offset, End: pos.Offset + int64(pos.Size), Err: data.ErrInvalidCRC}}, fr.CorruptRanges)
+
+	_, err = Repair(opts)
+	assert.Nil(t, err)
+	db2, err := Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 100; i++ {
+		_, err := db2.Get(utils.GetTestKey(i))
+		if i == 50 {
+			assert.Equal(t, ErrKeyNotFound, err)
+		} else {
+			assert.Nil(t, err)
+		}
+	}
+	assert.Nil(t, db2.Close())
+}
+
+func TestRepair_SalvageEncrypted(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-repair-encrypted")
+	opts.DirPath = dir
+	opts.EncryptionKey = []byte(strings.Repeat("k", 32))
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 100; i++ {
+		err = db.Put(utils.GetTestKey(i), utils.RandomValue(24))
+		assert.Nil(t, err)
+	}
+	pos := db.index.Get(utils.GetTestKey(50))
+	err = db.Close()
+	assert.Nil(t, err)
+
+	fileName := data.GetFileName(dir, 0)
+	content, err := os.ReadFile(fileName)
+	assert.Nil(t, err)
+	content[pos.Offset+int64(pos.Size)/2] ^= 0xff
+	err = os.WriteFile(fileName, content, 0644)
+	assert.Nil(t, err)
+
+	//the logRecords after the broken one are moved, they're sealed again at their new offsets
+	_, err = Repair(opts)
+	assert.Nil(t, err)
+	report, err := Verify(opts)
+	assert.Nil(t, err)
+	assert.False(t, report.Corrupted())
+	assert.Equal(t, 99, report.Files[0].RecordNum)
+
+	db2, err := Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 100; i++ {
+		_, err := db2.Get(utils.GetTestKey(i))
+		if i == 50 {
+			assert.Equal(t, ErrKeyNotFound, err)
+		} else {
+			assert.Nil(t, err)
+		}
+	}
+	assert.Nil(t, db2.Close())
+}
+
+func TestRepair_BPTree(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-repair-bptree")
+	opts.DirPath = dir
+	opts.IndexerType = BPTree
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 100; i++ {
+		err = db.Put(utils.GetTestKey(i), utils.RandomValue(24))
+		assert.Nil(t, err)
+	}
+	pos := db.index.Get(utils.GetTestKey(50))
+	err = db.Close()
+	assert.Nil(t, err)
+
+	fileName := data.GetFileName(dir, 0)
+	content, err := os.ReadFile(fileName)
+	assert.Nil(t, err)
+	content[pos.Offset+int64(pos.Size)/2] ^= 0xff
+	err = os.WriteFile(fileName, content, 0644)
+	assert.Nil(t, err)
+
+	//the logRecords after the broken one can't be moved, the index points to them
+	_, err = Repair(opts)
+	assert.Equal(t, ErrRepairWithBPTree, err)
+	repaired, err := os.ReadFile(fileName)
+	assert.Nil(t, err)
+	assert.Equal(t, content, repaired)
+
+	//the b plus tree index is found by its file, though the caller doesn't tell it
+	btreeOpts := DefaultOptions
+	btreeOpts.DirPath = dir
+	_, err = Repair(btreeOpts)
+	assert.Equal(t, ErrRepairWithBPTree, err)
+	repaired, err = os.ReadFile(fileName)
+	assert.Nil(t, err)
+	assert.Equal(t, content, repaired)
+}
+
+func TestRepair_BlobFiles(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-repair-blob")
+	opts.DirPath = dir
+	opts.DataFileSize = 256 * 1024
+	opts.BlobThreshold = 1024
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 100; i++ {
+		err = db.Put(utils.GetTestKey(i), utils.RandomValue(8*1024))
+		assert.Nil(t, err)
+	}
+	for i := 0; i < 100; i++ {
+		err = db.Put(utils.GetTestKey(i), utils.RandomValue(8*1024))
+		assert.Nil(t, err)
+	}
+	err = db.CompactBlobs()
+	assert.Nil(t, err)
+	activeBlobFileName := data.GetBlobFileName(dir, db.activeBlobFile.Fileid)
+	err = db.Close()
+	assert.Nil(t, err)
+
+	//the blob files and the blob compacted file are verified
+	report, err := Verify(opts)
+	assert.Nil(t, err)
+	assert.False(t, report.Corrupted())
+	names := make(map[string]bool)
+	for _, fr := range report.Files {
+		names[fr.Name] = true
+	}
+	assert.True(t, names[data.BlobCompactedFileName])
+	assert.True(t, names[filepath.Base(activeBlobFileName)])
+
+	//the torn tail of blob file is cut off
+	info, _ := os.Stat(activeBlobFileName)
+	err = os.Truncate(activeBlobFileName, info.Size()-10)
+	assert.Nil(t, err)
+	report, err = Repair(opts)
+	assert.Nil(t, err)
+	for _, fr := range report.Files {
+		if fr.Name == filepath.Base(activeBlobFileName) {
+			assert.True(t, fr.Corrupted())
+			assert.True(t, fr.Repaired)
+		}
+	}
+	report, err = Verify(opts)
+	assert.Nil(t, err)
+	assert.False(t, report.Corrupted())
+}